@@ -0,0 +1,148 @@
+package main
+
+import (
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// fileHistoryLimit is the number of file history entries shown in the GUI.
+const fileHistoryLimit = 200
+
+// ListRemoteObjects returns a page of the backup bucket of a profile under prefix for the bucket browser.
+// When search is set, every object below prefix whose name contains it is returned instead of the direct
+// children. Pass the previous page's NextMarker as startAfter to fetch the next page.
+func (a *App) ListRemoteObjects(profileName, prefix, search, startAfter string) (*minisync.ObjectPage, error) {
+	_, profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return minioClient.ListPage(prefix, search, startAfter, minisync.DefaultPageSize)
+}
+
+// StatRemoteObject returns the metadata of a single object in the backup bucket of a profile.
+func (a *App) StatRemoteObject(profileName, key string) (*minisync.RemoteObject, error) {
+	_, profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return minioClient.StatRemoteObject(key)
+}
+
+// DownloadRemoteFile asks the user for a folder and downloads the object at key of a profile's bucket into
+// it, recording the download in the profile's file history. It returns the path of the downloaded file, or
+// an empty string if the user cancelled the dialog.
+func (a *App) DownloadRemoteFile(profileName, key string) (string, error) {
+	destFolder, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Download To",
+	})
+	if err != nil || destFolder == "" {
+		return "", err
+	}
+
+	cfg, profile, err := loadProfile(profileName)
+	if err != nil {
+		return "", err
+	}
+	history, err := fileHistory(cfg, profile)
+	if err != nil {
+		return "", err
+	}
+	defer history.Close()
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := minioClient.DownloadObject(key, destFolder)
+	recorded := target
+	if recorded == "" {
+		recorded = destFolder
+	}
+	recordErr := history.Downloaded(profile.Primary.Name, profile.BackupFolder, key, recorded, err)
+	if err != nil {
+		return "", err
+	}
+	return target, recordErr
+}
+
+// DownloadRemoteFolder asks the user for a folder and downloads every object of a profile's bucket under
+// prefix into it, recreating the folder structure and recording every download in the profile's file
+// history. It returns the number of files downloaded.
+func (a *App) DownloadRemoteFolder(profileName, prefix string) (int, error) {
+	destFolder, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Download To",
+	})
+	if err != nil || destFolder == "" {
+		return 0, err
+	}
+
+	cfg, profile, err := loadProfile(profileName)
+	if err != nil {
+		return 0, err
+	}
+	history, err := fileHistory(cfg, profile)
+	if err != nil {
+		return 0, err
+	}
+	defer history.Close()
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return 0, err
+	}
+
+	var recordErr error
+	count, err := minioClient.DownloadPrefix(prefix, destFolder, func(key, target string, err error) {
+		if err := history.Downloaded(profile.Primary.Name, profile.BackupFolder, key, target, err); err != nil && recordErr == nil {
+			recordErr = err
+		}
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, recordErr
+}
+
+// GetFileHistory returns the file history of a profile for a backed-up file or folder, given either its
+// local path or its object key, newest first. An empty path returns the history of every file.
+func (a *App) GetFileHistory(profileName, pathOrKey string) ([]minisync.AuditEntry, error) {
+	cfg, profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := minisync.ObjectKey(profile.BackupFolder, pathOrKey)
+	if err != nil {
+		return nil, err
+	}
+
+	stateFolder, err := cfg.StateFolder(profile.Name)
+	if err != nil {
+		return nil, err
+	}
+	return minisync.ReadFileHistory(stateFolder, key, fileHistoryLimit)
+}
+
+// fileHistory returns the file history of a profile, which downloads from the GUI are recorded in. The
+// caller must close it.
+func fileHistory(cfg *config.Config, profile *config.Profile) (*minisync.FileHistory, error) {
+	stateFolder, err := cfg.StateFolder(profile.Name)
+	if err != nil {
+		return nil, err
+	}
+	return minisync.AppendFileHistory(stateFolder, "gui"), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// BundleInfo describes a configuration bundle chosen for import, so that the frontend can ask for the
+// passphrase and the new location of every folder before importing it.
+type BundleInfo struct {
+	Path      string   `json:"path"`      // Path is the bundle file.
+	Encrypted bool     `json:"encrypted"` // Encrypted is true if the bundle holds secret keys protected by a passphrase.
+	Folders   []string `json:"folders"`   // Folders are the folder settings of the original machine.
+}
+
+// ExportConfig asks the user where to save the saved configuration as a bundle and writes it. With an
+// empty passphrase the secret keys are left out; otherwise they are encrypted with it. It returns the
+// path of the bundle, or an empty string if the user cancelled the dialog.
+func (a *App) ExportConfig(passphrase string) (string, error) {
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Configuration",
+		DefaultFilename: "minisync-config.json",
+		Filters:         []runtime.FileFilter{{DisplayName: "MiniSync Configuration (*.json)", Pattern: "*.json"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := config.ExportBundle(cfg, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return path, nil
+}
+
+// OpenBundle asks the user for a configuration bundle and describes it. It returns nil if the user
+// cancelled the dialog.
+func (a *App) OpenBundle() (*BundleInfo, error) {
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Configuration",
+		Filters: []runtime.FileFilter{{DisplayName: "MiniSync Configuration (*.json)", Pattern: "*.json"}},
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	bundle, err := readBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := openBundle(bundle, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &BundleInfo{Path: path, Encrypted: bundle.Encrypted(), Folders: cfg.Folders()}, nil
+}
+
+// ImportConfig reads the bundle at path and returns it as form data for pre-filling the setup form.
+// Nothing is saved until the form is submitted. folders maps folder settings of the original machine to
+// their location on this one. The secret keys are decrypted with passphrase, and left blank for the user
+// to enter if the bundle was exported without them or no passphrase is given.
+func (a *App) ImportConfig(path, passphrase string, folders map[string]string) (Config, error) {
+	bundle, err := readBundle(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := openBundle(bundle, passphrase)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.RemapFolders(folders)
+
+	form := fromConfig(cfg)
+	for i, p := range cfg.Profiles {
+		// Imported profiles are new on this machine, so their secret keys are not in the secret store.
+		form.Profiles[i].OriginalName = ""
+		form.Profiles[i].MinioSecret = p.Primary.SecretKey
+		for j, d := range p.Destinations {
+			form.Profiles[i].Destinations[j].SecretKey = d.SecretKey
+		}
+	}
+	return form, nil
+}
+
+// readBundle reads and decodes the bundle file at path.
+func readBundle(path string) (*config.Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return config.ParseBundle(data)
+}
+
+// openBundle returns the bundle's configuration. Without a passphrase an encrypted bundle is opened
+// without its secret keys.
+func openBundle(bundle *config.Bundle, passphrase string) (*config.Config, error) {
+	if passphrase == "" {
+		stripped := *bundle
+		stripped.Secrets = nil
+		return stripped.Open("")
+	}
+	return bundle.Open(passphrase)
+}
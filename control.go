@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/control"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Events emitted to the frontend while the service log is streamed.
+const (
+	logLineEvent  = "serviceLog"      // logLineEvent carries one line of the service log.
+	logEndedEvent = "serviceLogEnded" // logEndedEvent is emitted when the stream ends, with the error if any.
+)
+
+// Events emitted to the frontend while the service activity is streamed.
+const (
+	activityEvent      = "serviceActivity"      // activityEvent carries one event of the service activity.
+	activityResetEvent = "serviceActivityReset" // activityResetEvent is emitted before the recent activity is sent again on every connection.
+	activityEndedEvent = "serviceActivityEnded" // activityEndedEvent is emitted when the connection is lost, with the error if any.
+)
+
+// activityRetry is how long the activity stream waits before connecting to the service again.
+const activityRetry = 5 * time.Second
+
+// logStream is the service log stream opened by StartLogStream, if any.
+var logStream struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// activityStream is the service activity stream opened by StartActivityStream, if any.
+var activityStream struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// dialService connects to the control API of the running service.
+func dialService() (*control.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return control.Dial(cfg.LogFolder)
+}
+
+// SyncNow asks the running service to start a full sync cycle of the named profile.
+func (a *App) SyncNow(profileName string) error {
+	client, err := dialService()
+	if err != nil {
+		return err
+	}
+	return client.SyncNow(profileName)
+}
+
+// GetQueue returns the operations waiting for a destination of the named profile.
+func (a *App) GetQueue(profileName, destination string) ([]minisync.Operation, error) {
+	client, err := dialService()
+	if err != nil {
+		return nil, err
+	}
+	return client.Queue(profileName, destination)
+}
+
+// StartLogStream streams the service log to the frontend, one serviceLog event per line, replacing a
+// stream that is already open. serviceLogEnded is emitted when the stream ends.
+func (a *App) StartLogStream() error {
+	client, err := dialService()
+	if err != nil {
+		return err
+	}
+
+	a.StopLogStream()
+	ctx, cancel := context.WithCancel(a.ctx)
+	logStream.mu.Lock()
+	logStream.cancel = cancel
+	logStream.mu.Unlock()
+
+	go func() {
+		err := client.StreamLogs(ctx, func(line string) {
+			runtime.EventsEmit(a.ctx, logLineEvent, line)
+		})
+		message := ""
+		if err != nil {
+			log.Printf("Service log stream ended: %v", err)
+			message = err.Error()
+		}
+		if ctx.Err() == nil {
+			runtime.EventsEmit(a.ctx, logEndedEvent, message)
+		}
+	}()
+	return nil
+}
+
+// StartActivityStream streams the activity of the service to the frontend, one serviceActivity event per
+// event, replacing a stream that is already open. Every time the stream connects, serviceActivityReset is
+// emitted before the recent activity is sent again. When the service stops, serviceActivityEnded is emitted
+// and the stream connects again once the service is back.
+func (a *App) StartActivityStream() {
+	ctx, cancel := context.WithCancel(a.ctx)
+	activityStream.mu.Lock()
+	if activityStream.cancel != nil {
+		activityStream.cancel()
+	}
+	activityStream.cancel = cancel
+	activityStream.mu.Unlock()
+
+	go a.streamActivity(ctx)
+}
+
+// streamActivity emits the service activity until ctx is cancelled, connecting to the service again
+// whenever the connection is lost. serviceActivityEnded is emitted once per lost connection.
+func (a *App) streamActivity(ctx context.Context) {
+	connected := true
+	for {
+		client, err := dialService()
+		if err == nil {
+			runtime.EventsEmit(a.ctx, activityResetEvent)
+			connected = true
+			err = client.StreamActivity(ctx, func(activity control.Activity) {
+				runtime.EventsEmit(a.ctx, activityEvent, activity)
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			message := ""
+			if err != nil {
+				log.Printf("Service activity stream ended: %v", err)
+				message = err.Error()
+			}
+			runtime.EventsEmit(a.ctx, activityEndedEvent, message)
+			connected = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(activityRetry):
+		}
+	}
+}
+
+// StopLogStream closes the service log stream, if one is open.
+func (a *App) StopLogStream() {
+	logStream.mu.Lock()
+	defer logStream.mu.Unlock()
+	if logStream.cancel != nil {
+		logStream.cancel()
+		logStream.cancel = nil
+	}
+}
@@ -63,6 +63,569 @@ function refreshServiceStatus() {
     });
 }
 
+// refreshSyncStatus renders the components the watchdog restarted, the watcher health and full sync times of
+// every profile, the state of every destination and the most recent errors.
+function refreshSyncStatus() {
+    window.go.main.App.GetSyncStatus().then(status => {
+        $("div#serviceHealth").html(formatIncidents(status));
+
+        const profileRows = (status.profiles || []).map(p => `<tr>
+                <td>${p.name}</td>
+                <td>${formatWatcher(p.watcher)}</td>
+                <td>${p.watcher.events}</td>
+                <td>${formatTime(p.watcher.lastEvent)}</td>
+                <td>${formatNextSync(p.nextFullSync)}</td>
+            </tr>`).join("");
+        $("div#profileStatus").html(profileRows ? `<table class="table table-dark table-sm destination-table">
+                <thead><tr><th>Profile</th><th>Watcher</th><th>Changes</th><th>Last Change</th><th>Next Sync</th></tr></thead>
+                <tbody>${profileRows}</tbody>
+            </table>` : "");
+
+        const destinations = status.destinations || [];
+        const rows = destinations.map(d => `<tr>
+                <td>${d.profile}</td>
+                <td>${d.name}</td>
+                <td>${d.endpoint}/${d.bucketName}</td>
+                <td>${formatEndpoints(d.endpoints)}</td>
+                <td class="destination-pending" data-profile="${d.profile}" data-destination="${d.name}" title="Show the queue">${d.pending}</td>
+                <td>${formatLag(d.lagSeconds)}</td>
+                <td>${formatDestinationState(d)}</td>
+                <td>${d.uploadsToday} files, ${formatBytes(d.bytesToday)}</td>
+                <td>${formatTransfer(d.transfer)}</td>
+                <td title="${d.fullSyncError ? d.fullSyncError : ""}">${formatFullSync(d)}</td>
+                <td title="${d.lastError ? d.lastError : ""}">${d.lastError ? errorClassMessage(d.lastErrorClass) : ""}</td>
+            </tr>`).join("");
+
+        $("div#destinationStatus").html(`<table class="table table-dark table-sm destination-table">
+                <thead><tr><th>Profile</th><th>Destination</th><th>Target</th><th>Nodes</th><th>Pending</th><th>Lag</th><th>State</th><th>Today</th><th>Transfer</th><th>Last Full Sync</th><th>Last Error</th></tr></thead>
+                <tbody>${rows}</tbody>
+            </table>`);
+
+        const errors = destinations.flatMap(d => (d.recentErrors || []).map(e => ({ ...e, destination: `${d.profile}/${d.name}` })))
+            .sort((a, b) => new Date(b.time) - new Date(a.time))
+            .slice(0, 10);
+        $("div#recentErrors").html(errors.length ? `<table class="table table-dark table-sm queue-table">
+                <thead><tr><th>Time</th><th>Destination</th><th>Operation</th><th>File</th><th>Problem</th></tr></thead>
+                <tbody>${errors.map(e => `<tr>
+                    <td>${formatTime(e.time)}</td>
+                    <td>${e.destination}</td>
+                    <td>${e.operation}</td>
+                    <td>${e.relativePath}</td>
+                    <td title="${e.message}">${errorClassMessage(e.class)}</td>
+                </tr>`).join("")}</tbody>
+            </table>` : '<p class="usage-summary">No recent errors.</p>');
+    }).catch(error => {
+        $("div#serviceHealth").html("");
+        $("div#profileStatus").html("");
+        $("div#destinationStatus").html("");
+        $("div#recentErrors").html("");
+        console.error(`Error getting sync status: ${error}`);
+    });
+}
+
+// formatIncidents warns while the service is degraded and lists the components the watchdog restarted.
+function formatIncidents(status) {
+    const incidents = (status.incidents || []).slice(0, 5);
+    if (!status.degraded && !incidents.length) {
+        return "";
+    }
+    const title = status.degraded
+        ? "The service is degraded: stalled components were restarted."
+        : "Stalled components were restarted recently.";
+    return `<div class="alert ${status.degraded ? "alert-warning" : "alert-secondary"} mt-3 mb-0">
+            <strong>${title}</strong>
+            <ul class="mb-0">${incidents.map(i => `<li>${formatTime(i.time)}: ${i.component} of ${i.profile}${i.destination ? "/" + i.destination : ""}, ${i.problem}</li>`).join("")}</ul>
+        </div>`;
+}
+
+// formatWatcher shows whether the folder monitor of a profile is running, and its last error.
+function formatWatcher(watcher) {
+    if (!watcher.watching) {
+        return `<span class="text-danger" title="${watcher.lastError}">Stopped</span>`;
+    }
+    const folders = `Watching ${watcher.folders} folders`;
+    if (watcher.lastError) {
+        return `<span class="text-warning" title="${watcher.lastError}">${folders}</span>`;
+    }
+    return `<span class="text-success">${folders}</span>`;
+}
+
+// formatDestinationState shows whether a destination is reachable and applying changes.
+function formatDestinationState(destination) {
+    if (!destination.reachable) {
+        return '<span class="text-danger">Unreachable</span>';
+    }
+    return destination.retrying ? "Retrying" : "OK";
+}
+
+// formatTransfer shows the upload in progress as a progress bar.
+function formatTransfer(transfer) {
+    if (!transfer) {
+        return "-";
+    }
+    const percent = transfer.size > 0 ? Math.min(100, Math.round(transfer.sent * 100 / transfer.size)) : 100;
+    return `<div class="transfer-path" title="${transfer.relativePath}">${transfer.relativePath}</div>
+        <div class="progress transfer-progress" title="${formatBytes(transfer.sent)} of ${formatBytes(transfer.size)}">
+            <div class="progress-bar" role="progressbar" style="width: ${percent}%" aria-valuenow="${percent}" aria-valuemin="0" aria-valuemax="100"></div>
+        </div>`;
+}
+
+// formatFullSync shows when the last full sync cycle of a destination succeeded and how long it took.
+function formatFullSync(destination) {
+    if (destination.fullSyncError) {
+        return '<span class="text-danger">Failed</span>';
+    }
+    const time = formatTime(destination.lastFullSync);
+    if (time == "-") {
+        return time;
+    }
+    const took = destination.fullSyncTime < 1 ? "<1s" : formatLag(destination.fullSyncTime);
+    return `${time} (${took})`;
+}
+
+// formatTime shows a time reported by the service, which reports the zero time for "never".
+function formatTime(value) {
+    const time = new Date(value);
+    if (isNaN(time) || time.getFullYear() < 2) {
+        return "-";
+    }
+    return time.toLocaleString();
+}
+
+// errorClassMessage turns the class of a storage error into advice for the user.
+function errorClassMessage(errorClass) {
+    const messages = {
+        auth: "Access key or secret rejected. Check the MinIO credentials.",
+        permission: "Access denied. Check the bucket policy for this key.",
+        network: "Endpoint unreachable. Retrying when it is back online.",
+        notFound: "Object or bucket not found.",
+        quota: "Storage full or quota exceeded. Free up space on the server.",
+        throttled: "Server is busy. Retrying more slowly.",
+        invalidKey: "A file name is not a valid object key. Rename the file.",
+    };
+    return messages[errorClass] || "Unexpected error.";
+}
+
+// showQueue lists the operations waiting for a destination of a profile.
+function showQueue(profile, destination) {
+    window.go.main.App.GetQueue(profile, destination).then(queue => {
+        const rows = (queue || []).map(op => `<tr>
+                <td>${op.kind}</td>
+                <td>${op.relativePath}</td>
+                <td>${new Date(op.queued).toLocaleString()}</td>
+                <td>${op.attempts}</td>
+            </tr>`).join("");
+        $("#queueTitle").text(`${profile}/${destination}`);
+        $("div#queueEntries").html(rows ? `<table class="table table-dark table-sm queue-table">
+                <thead><tr><th>Operation</th><th>File</th><th>Queued</th><th>Attempts</th></tr></thead>
+                <tbody>${rows}</tbody>
+            </table>` : '<p class="usage-summary">Nothing is waiting.</p>');
+        $("div#queueView").show();
+    }).catch(error => {
+        console.error(`Error getting queue: ${error}`);
+        alert(`Error getting queue: ${error}`);
+    });
+}
+
+// maxLogLines is how many lines the service log panel keeps.
+const maxLogLines = 500;
+
+// appendLogLine adds a line to the service log panel, dropping the oldest lines beyond maxLogLines.
+function appendLogLine(line) {
+    const log = $("pre#serviceLog");
+    const lines = (log.text() + line + "\n").split("\n");
+    log.text(lines.slice(Math.max(0, lines.length - maxLogLines - 1)).join("\n"));
+    log.scrollTop(log.prop("scrollHeight"));
+}
+
+// maxActivity is how many events the activity timeline keeps.
+const maxActivity = 200;
+
+// activity holds the events of the service activity stream, newest first.
+var activity = [];
+
+// activityFrame is the pending render of the activity timeline, so that a burst of events renders once.
+var activityFrame = null;
+
+// addActivity adds an event pushed by the service to the activity timeline.
+function addActivity(event) {
+    activity.unshift(event);
+    if (activity.length > maxActivity) {
+        activity.pop();
+    }
+    if (activityFrame === null) {
+        activityFrame = requestAnimationFrame(renderActivity);
+    }
+}
+
+// renderActivity shows the events of the activity timeline that match the filters.
+function renderActivity() {
+    activityFrame = null;
+    const kind = $('#activityKind').val();
+    const search = $('#activitySearch').val().toLowerCase();
+    const shown = activity.filter(a => (!kind || (kind == "failed" ? a.failed : a.kind == kind))
+        && (!search || [a.profile, a.destination, a.path].some(value => (value || "").toLowerCase().includes(search))));
+    $("div#activityTimeline").html(shown.length ? shown.map(a => `<div class="activity-item${a.failed ? " text-danger" : ""}" title="${a.message || ""}">
+            <span class="activity-time">${new Date(a.time).toLocaleTimeString()}</span>
+            <i class="fa-sharp-duotone fa-solid ${activityIcon(a)}"></i> ${describeActivity(a)}
+        </div>`).join("") : '<p class="usage-summary">No activity to show.</p>');
+}
+
+// activityIcon returns the icon of an activity event.
+function activityIcon(a) {
+    if (a.kind == "incident") {
+        return "fa-triangle-exclamation";
+    } else if (a.kind == "fullSync") {
+        return "fa-arrows-rotate";
+    }
+    return a.operation.startsWith("delete") ? "fa-trash" : "fa-cloud-arrow-up";
+}
+
+// describeActivity describes an activity event in one line.
+function describeActivity(a) {
+    const target = a.destination ? `${a.profile}/${a.destination}` : a.profile;
+    const took = a.took < 1 ? "<1s" : formatLag(a.took);
+    if (a.kind == "incident") {
+        return `Restarted stalled ${a.operation} of ${target}: ${a.message}`;
+    } else if (a.kind == "fullSync") {
+        return a.failed ? `Full sync of ${target} failed: ${a.message}` : `Full sync of ${target} completed in ${took}`;
+    }
+    const verbs = { upload: "Uploaded", update: "Updated", delete: "Deleted", deleteDirectory: "Deleted folder" };
+    if (a.failed) {
+        return `${a.operation} of ${a.path} to ${target} failed: ${a.message}`;
+    }
+    const size = a.bytes ? `, ${formatBytes(a.bytes)}` : "";
+    return `${verbs[a.operation] || a.operation} ${a.path} on ${target} (${took}${size})`;
+}
+
+function formatEndpoints(endpoints) {
+    return (endpoints || []).map(e => {
+        const state = e.online ? "text-success" : "text-danger";
+        return `<span class="${state}" title="${e.online ? "Online" : "Offline"}">${e.active ? "<b>" + e.endpoint + "</b>" : e.endpoint}</span>`;
+    }).join("<br>");
+}
+
+function formatLag(seconds) {
+    if (seconds < 1) {
+        return "-";
+    } else if (seconds < 60) {
+        return `${Math.round(seconds)}s`;
+    } else if (seconds < 3600) {
+        return `${Math.round(seconds / 60)}m`;
+    }
+    return `${Math.round(seconds / 3600)}h`;
+}
+
+// formatNextSync shows when the next full sync cycle is due. The service reports the zero time while a
+// cycle is running.
+function formatNextSync(next) {
+    const time = new Date(next);
+    if (isNaN(time) || time.getFullYear() < 2) {
+        return "Running";
+    }
+    return time.toLocaleString();
+}
+
+function addDestinationRow(destination) {
+    const row = `<div class="input-group mb-3 destination-row">
+            <span class="input-group-text config-label">Destination</span>
+            <input type="text" class="form-control destination-name" placeholder="offsite" required>
+            <input type="text" class="form-control destination-endpoint" placeholder="backup.example.com:9000" required>
+            <input type="text" class="form-control destination-bucket" placeholder="minisync" required>
+            <input type="text" class="form-control destination-key" placeholder="Key" required>
+            <input type="password" class="form-control destination-secret" placeholder="Secret" autocomplete="off">
+            <button class="btn btn-outline-danger remove-destination" type="button"><i class="fa-sharp-duotone fa-solid fa-circle-x"></i></button>
+        </div>`;
+    $("div#destinations").append(row);
+
+    if (destination) {
+        const added = $("div#destinations .destination-row").last();
+        added.find('.destination-name').val(destination.name);
+        added.find('.destination-endpoint').val((destination.endpoints || []).join(','));
+        added.find('.destination-bucket').val(destination.bucketName);
+        added.find('.destination-key').val(destination.accessKey);
+        added.find('.destination-secret').attr('placeholder', 'Saved - leave blank to keep');
+    }
+}
+
+// destinationInputs maps destination setting names in validation errors to the input classes of a destination row.
+const destinationInputs = { name: "name", endpoints: "endpoint", bucketName: "bucket", accessKey: "key", secretKey: "secret" };
+
+// profiles holds the form data of every profile while the setup form shows the one at currentProfile.
+var profiles = [];
+var currentProfile = 0;
+
+// newProfile returns the form data of a profile with the default settings.
+function newProfile(name) {
+    return { originalName: "", name: name, mode: "mirror", minioEndpointStrategy: "failover", backupFrequencySeconds: "300", syncOnStart: "false", objectLockLegalHold: "false", destinations: [] };
+}
+
+// readProfile returns the form data of the profile shown in the setup form.
+function readProfile() {
+    return {
+        originalName: profiles[currentProfile] ? profiles[currentProfile].originalName : "",
+        name: $('#profileName').val(),
+        backupFolder: $('#backupFolder').val(),
+        mode: $('#mode').val(),
+        include: $('#include').val(),
+        exclude: $('#exclude').val(),
+        minioEndpoint: $('#minioEndpoint').val(),
+        minioEndpointStrategy: $('#minioEndpointStrategy').val(),
+        minioKey: $('#minioKey').val(),
+        minioSecret: $('#minioSecret').val(),
+        miniobucketName: $('#minioBucketName').val(),
+        backupFrequencySeconds: $('#backupFrequencySeconds').val(),
+        schedule: $('#schedule').val(),
+        syncOnStart: $('#syncOnStart').val(),
+        objectLockMode: $('#objectLockMode').val(),
+        objectLockDays: $('#objectLockDays').val(),
+        objectLockLegalHold: $('#objectLockLegalHold').val(),
+        objectLockRules: $('#objectLockRules').val(),
+        destinations: $('.destination-row').map(function () {
+            return {
+                name: $(this).find('.destination-name').val(),
+                endpoints: $(this).find('.destination-endpoint').val().split(',').map(e => e.trim()).filter(e => e !== ''),
+                bucketName: $(this).find('.destination-bucket').val(),
+                accessKey: $(this).find('.destination-key').val(),
+                secretKey: $(this).find('.destination-secret').val()
+            };
+        }).get()
+    };
+}
+
+// showProfile fills the setup form with the profile at index.
+function showProfile(index) {
+    currentProfile = index;
+    const profile = profiles[index];
+    const saved = profile.originalName !== "";
+    $('#profileName').val(profile.name);
+    $('#backupFolder').val(profile.backupFolder);
+    $('#mode').val(profile.mode || "mirror");
+    $('#include').val(profile.include);
+    $('#exclude').val(profile.exclude);
+    $('#minioEndpoint').val(profile.minioEndpoint);
+    $('#minioEndpointStrategy').val(profile.minioEndpointStrategy || "failover");
+    $('#minioKey').val(profile.minioKey);
+    $('#minioSecret').val(profile.minioSecret || '').attr('placeholder', saved && profile.minioKey ? 'Saved - leave blank to keep' : '');
+    $('#minioBucketName').val(profile.miniobucketName);
+    $('#backupFrequencySeconds').val(profile.backupFrequencySeconds);
+    $('#schedule').val(profile.schedule);
+    $('#syncOnStart').val(profile.syncOnStart || "false");
+    $('#objectLockMode').val(profile.objectLockMode || "");
+    $('#objectLockDays').val(profile.objectLockDays);
+    $('#objectLockLegalHold').val(profile.objectLockLegalHold || "false");
+    $('#objectLockRules').val(profile.objectLockRules);
+    $("div#destinations").empty();
+    (profile.destinations || []).forEach(d => addDestinationRow(d));
+    renderProfileSelect();
+}
+
+// switchProfile keeps the changes made to the current profile and shows the profile at index.
+function switchProfile(index) {
+    profiles[currentProfile] = readProfile();
+    showProfile(index);
+}
+
+// renderProfileSelect lists the profiles in the setup form's profile selector.
+function renderProfileSelect() {
+    $('#profileSelect').html(profiles.map((p, i) => `<option value="${i}">${p.name || "(unnamed)"}</option>`).join(""));
+    $('#profileSelect').val(String(currentProfile));
+    $('#removeProfile').prop('disabled', profiles.length < 2);
+}
+
+// renderActiveProfile lists the saved profiles in the status view, keeping the selection if it still exists.
+function renderActiveProfile() {
+    const selected = $('#activeProfile').val();
+    const names = profiles.filter(p => p.originalName !== "").map(p => p.originalName);
+    $('#activeProfile').empty().append(names.map(name => $('<option></option>').val(name).text(name)));
+    if (selected && names.includes(selected)) {
+        $('#activeProfile').val(selected);
+    }
+}
+
+// activeProfile returns the profile the status view's browser, usage report and share links work on.
+function activeProfile() {
+    return $('#activeProfile').val() || "";
+}
+
+// showFormErrors marks the inputs named by the validation errors as invalid and lists the errors above
+// the submit button. Errors of profile settings are prefixed with profiles[i]; the form switches to the
+// first profile with an error. An empty list clears the previous errors.
+function showFormErrors(errors) {
+    $('#backupForm .is-invalid').removeClass('is-invalid').removeAttr('title');
+    $('#formErrors').empty().hide();
+    if (errors.length === 0) {
+        return;
+    }
+
+    const first = errors.map(e => /^profiles\[(\d+)\]\./.exec(e.field || "")).find(m => m);
+    if (first && Number(first[1]) !== currentProfile) {
+        switchProfile(Number(first[1]));
+    }
+
+    const list = $('<ul class="mb-0"></ul>');
+    errors.forEach(e => {
+        let input = $();
+        let field = e.field || "";
+        let prefix = "";
+        const profileMatch = /^profiles\[(\d+)\]\.(.+)$/.exec(field);
+        if (profileMatch) {
+            const index = Number(profileMatch[1]);
+            prefix = `${profiles[index].name || "Profile " + (index + 1)} - `;
+            field = index === currentProfile ? profileMatch[2] : "";
+        }
+
+        let label = e.field;
+        const match = /^destinations\[(\d+)\]\.(\w+)$/.exec(field);
+        if (match) {
+            const row = $('.destination-row').eq(Number(match[1]));
+            input = row.find(`.destination-${destinationInputs[match[2]]}`);
+            label = `Destination ${row.find('.destination-name').val() || Number(match[1]) + 1}`;
+        } else if (field) {
+            input = $(`#${field}`);
+            label = input.closest('.input-group').find('.config-label').first().text() || field;
+        }
+        input.addClass('is-invalid').attr('title', e.message);
+        list.append($('<li></li>').text(prefix + (label ? `${label}: ${e.message}` : e.message)));
+    });
+    $('#formErrors').append(list).show();
+}
+
+// loadConfig fills the setup form and the status view's profile selector from the saved configuration file.
+function loadConfig() {
+    window.go.main.App.GetConfig().then(config => {
+        $('#logFolder').val(config.logFolder);
+        profiles = config.profiles && config.profiles.length ? config.profiles : [newProfile("default")];
+        showProfile(0);
+        renderActiveProfile();
+    }).catch(error => {
+        console.error(`Error loading configuration: ${error}`);
+    });
+}
+
+// pendingBundle is the configuration bundle chosen for import while its folders are being remapped.
+var pendingBundle = null;
+
+// showImportFolders lists the folders of the chosen bundle with an input for their location on this machine.
+function showImportFolders(bundle) {
+    pendingBundle = bundle;
+    $('#importFolderRows').empty().append((bundle.folders || []).map(folder => {
+        const row = $(`<div class="input-group mb-2 import-folder">
+                <span class="input-group-text config-label import-from"></span>
+                <input type="text" class="form-control import-to">
+                <button class="btn btn-secondary config-btn browse-import-folder" type="button">Browse</button>
+            </div>`);
+        row.find('.import-from').text(folder).attr('title', folder);
+        row.find('.import-to').val(folder).data('from', folder);
+        return row;
+    }));
+    let note = "Choose where the folders of the imported configuration are on this machine.";
+    if (bundle.encrypted && !$('#bundlePassphrase').val()) {
+        note += " The bundle contains secret keys; enter its passphrase above to import them, or leave it blank to enter them again.";
+    }
+    $('#importFolders .import-note').text(note);
+    $('#importFolders').show();
+}
+
+// browserState tracks the folder, search term and paging marker of the bucket browser.
+var browserState = { prefix: "", search: "", nextMarker: "" };
+
+function loadBrowserPage(append) {
+    const startAfter = append ? browserState.nextMarker : "";
+    window.go.main.App.ListRemoteObjects(activeProfile(), browserState.prefix, browserState.search, startAfter).then(page => {
+        const rows = page.objects.map(o => `<tr data-key="${o.key}" data-dir="${o.isDir}">
+                <td class="browser-name">${o.isDir ? '<i class="fa-sharp-duotone fa-solid fa-folder"></i>' : '<i class="fa-sharp-duotone fa-solid fa-file"></i>'} ${o.isDir ? o.name : (browserState.search ? o.key : o.name)}</td>
+                <td>${o.isDir ? "" : formatBytes(o.size)}</td>
+                <td>${o.isDir ? "" : new Date(o.lastModified).toLocaleString()}</td>
+                <td class="text-end">
+                    ${o.isDir ? "" : '<button type="button" class="btn btn-sm btn-outline-secondary browser-info-button">Info</button>'}
+                    <button type="button" class="btn btn-sm btn-outline-secondary browser-history">History</button>
+                    <button type="button" class="btn btn-sm btn-outline-secondary browser-download">Download</button>
+                </td>
+            </tr>`).join("");
+
+        if (append) {
+            $("tbody#browserEntries").append(rows);
+        } else {
+            $("tbody#browserEntries").html(rows);
+        }
+        browserState.nextMarker = page.nextMarker;
+        $("#browserMore").toggle(page.truncated);
+        $("#browserPath").text("/" + browserState.prefix);
+    }).catch(error => {
+        console.error(`Error listing backups: ${error}`);
+        alert(`Error listing backups: ${error}`);
+    });
+}
+
+function openBrowserFolder(prefix) {
+    browserState = { prefix: prefix, search: "", nextMarker: "" };
+    $("#browserSearch").val("");
+    $("#browserInfo").hide();
+    $("div#browserHistory").html("");
+    loadBrowserPage(false);
+}
+
+function refreshUsageReport() {
+    $("div#usageReport").html('<p class="usage-summary">Listing bucket...</p>');
+    window.go.main.App.GetUsageReport(activeProfile()).then(report => {
+        const table = (title, groups) => `<div class="col">
+                <table class="table table-dark table-sm usage-table">
+                    <thead><tr><th>${title}</th><th class="text-end">Files</th><th class="text-end">Size</th></tr></thead>
+                    <tbody>${groups.slice(0, 10).map(g => `<tr><td>${g.name}</td><td class="text-end">${g.objects}</td><td class="text-end">${formatBytes(g.bytes)}</td></tr>`).join("")}</tbody>
+                </table>
+            </div>`;
+
+        // Trend over the last recorded reports, scaled to the largest one
+        const history = (report.history || []).slice(-11).concat([{ time: report.generated, bytes: report.bytes }]);
+        const max = Math.max(...history.map(h => h.bytes), 1);
+        const trend = history.map(h => `<div class="usage-bar" style="height:${Math.max(2, Math.round(h.bytes / max * 60))}px"
+                title="${new Date(h.time).toLocaleString()}: ${formatBytes(h.bytes)}"></div>`).join("");
+
+        $("div#usageReport").html(`<p class="usage-summary">${report.objects} files, ${formatBytes(report.bytes)} in ${report.bucket}</p>
+            <div class="usage-trend">${trend}</div>
+            <div class="row">${table("Folder", report.byFolder)}${table("Type", report.byExtension)}${table("Age", report.byAge)}</div>`);
+    }).catch(error => {
+        $("div#usageReport").html("");
+        console.error(`Error getting usage report: ${error}`);
+        alert(`Error getting usage report: ${error}`);
+    });
+}
+
+// showFileHistory lists the recorded uploads, updates, deletes, copies and restores of a file or folder of
+// the active profile, given its local path or object key, in the element selected by target.
+function showFileHistory(pathOrKey, target) {
+    window.go.main.App.GetFileHistory(activeProfile(), pathOrKey).then(entries => {
+        entries = entries || [];
+        $(target).html(entries.length ? `<table class="table table-dark table-sm queue-table">
+                <thead><tr><th>Time</th><th>Action</th><th>File</th><th>Destination</th><th>Size</th><th>SHA-256</th><th>Result</th></tr></thead>
+                <tbody>${entries.map(e => `<tr>
+                    <td>${formatTime(e.time)}</td>
+                    <td>${e.action}</td>
+                    <td title="${e.localPath || ""}">${e.path}${e.folder ? "/" : ""}</td>
+                    <td>${e.destination}</td>
+                    <td>${e.action == "delete" ? "-" : formatBytes(e.size)}</td>
+                    <td class="history-hash" title="${e.hash || ""}">${e.hash ? e.hash.slice(0, 12) : "-"}</td>
+                    <td>${e.result == "success" ? "OK" : `<span class="text-danger" title="${e.error}">Failed</span>`}</td>
+                </tr>`).join("")}</tbody>
+            </table>` : '<p class="usage-summary">No history recorded.</p>');
+    }).catch(error => {
+        $(target).html("");
+        console.error(`Error getting file history: ${error}`);
+        alert(`Error getting file history: ${error}`);
+    });
+}
+
+function formatBytes(bytes) {
+    const units = ["B", "KB", "MB", "GB", "TB"];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+        bytes /= 1024;
+        i++;
+    }
+    return `${bytes.toFixed(i === 0 ? 0 : 1)} ${units[i]}`;
+}
+
 function updateStatusBar(serviceStatus, startClass, stopClass, statusText, isPaused = false) {
     const statusBar = `<div class="btn-toolbar" role="toolbar">
         <div class="btn-group me-2" role="group">
@@ -88,7 +651,109 @@ function updateStatusBar(serviceStatus, startClass, stopClass, statusText, isPau
 }
 
 $(document).ready(function () {
+    loadConfig();
     refreshServiceStatus();
+    refreshSyncStatus();
+    setInterval(refreshSyncStatus, 5000);
+
+    $('#profileSelect').change(function () {
+        switchProfile(Number($(this).val()));
+    });
+
+    $('#addProfile').click(function () {
+        profiles[currentProfile] = readProfile();
+        profiles.push(newProfile(`profile-${profiles.length + 1}`));
+        showProfile(profiles.length - 1);
+    });
+
+    $('#removeProfile').click(function () {
+        if (profiles.length < 2 || !confirm(`Remove profile ${profiles[currentProfile].name}?`)) {
+            return;
+        }
+        profiles.splice(currentProfile, 1);
+        showProfile(0);
+    });
+
+    $('#exportConfig').click(function () {
+        const passphrase = $('#bundlePassphrase').val();
+        window.go.main.App.ExportConfig(passphrase).then(path => {
+            if (path) {
+                alert(`Configuration exported to ${path}${passphrase ? "" : " without secret keys"}.`);
+            }
+        }).catch(error => {
+            alert(`Error exporting configuration: ${error}`);
+        });
+    });
+
+    $('#importConfig').click(function () {
+        window.go.main.App.OpenBundle().then(bundle => {
+            if (bundle) {
+                showImportFolders(bundle);
+            }
+        }).catch(error => {
+            alert(`Error reading configuration: ${error}`);
+        });
+    });
+
+    $('#importFolderRows').on('click', '.browse-import-folder', function () {
+        const input = $(this).closest('.import-folder').find('.import-to');
+        window.go.main.App.BrowseFolder().then(folder => {
+            if (folder) {
+                input.val(folder);
+            }
+        }).catch(error => {
+            console.error("Error browsing folder:", error);
+        });
+    });
+
+    $('#applyImport').click(function () {
+        const folders = {};
+        $('.import-to').each(function () {
+            folders[$(this).data('from')] = $(this).val();
+        });
+        window.go.main.App.ImportConfig(pendingBundle.path, $('#bundlePassphrase').val(), folders).then(config => {
+            $('#logFolder').val(config.logFolder);
+            profiles = config.profiles;
+            showProfile(0);
+            showFormErrors([]);
+            $('#importFolders').hide();
+            pendingBundle = null;
+        }).catch(error => {
+            alert(`Error importing configuration: ${error}`);
+        });
+    });
+
+    $('#cancelImport').click(function () {
+        $('#importFolders').hide();
+        pendingBundle = null;
+    });
+
+    $('#editConfig').click(function () {
+        loadConfig();
+        showFormErrors([]);
+        $("div#status").hide();
+        $("div#setup").show();
+    });
+
+    $('#cancelConfig').click(function () {
+        loadConfig();
+        showFormErrors([]);
+        refreshServiceStatus();
+    });
+
+    $('#activeProfile').change(function () {
+        $("div#usageReport").html("");
+        $("div#fileHistory").html("");
+        $("#shareResult").hide();
+    });
+
+    $('#addDestination').click(function () {
+        addDestinationRow(null);
+    });
+
+    $("#destinations").on("click", ".remove-destination", function () {
+        $(this).closest(".destination-row").remove();
+    });
 
     $("#statusControl").on("click", "#start, #continue, #pause, #stop, #uninstall", function () {
         const command = $(this).attr('id');
@@ -120,23 +785,184 @@ $(document).ready(function () {
         });
     });
 
+    $('#refreshUsage').click(function () {
+        refreshUsageReport();
+    });
+
+    $('#syncNow').click(function () {
+        window.go.main.App.SyncNow(activeProfile()).then(() => {
+            refreshSyncStatus();
+        }).catch(error => {
+            console.error(`Error starting sync: ${error}`);
+            alert(`Error starting sync: ${error}`);
+        });
+    });
+
+    $("div#destinationStatus").on("click", ".destination-pending", function () {
+        showQueue($(this).data("profile"), $(this).data("destination"));
+    });
+
+    $('#closeQueue').click(function () {
+        $("div#queueView").hide();
+    });
+
+    window.runtime.EventsOn("serviceActivityReset", function () {
+        activity = [];
+        $('#activityState').text("");
+        renderActivity();
+    });
+    window.runtime.EventsOn("serviceActivity", addActivity);
+    window.runtime.EventsOn("serviceActivityEnded", function (message) {
+        $('#activityState').text(message ? `Not connected to the service: ${message}` : "The service stopped. Waiting for it to start again.");
+    });
+    $('#activityKind').change(renderActivity);
+    $('#activitySearch').on("input", renderActivity);
+    window.go.main.App.StartActivityStream();
+
+    window.runtime.EventsOn("serviceLog", appendLogLine);
+    window.runtime.EventsOn("serviceLogEnded", function (message) {
+        appendLogLine(message ? `-- Log stream ended: ${message}` : "-- Log stream ended");
+        $('#toggleLog').text("Show");
+    });
+
+    $('#toggleLog').click(function () {
+        if ($(this).text() === "Hide") {
+            window.go.main.App.StopLogStream();
+            $("pre#serviceLog").hide();
+            $(this).text("Show");
+            return;
+        }
+        $("pre#serviceLog").text("").show();
+        window.go.main.App.StartLogStream().then(() => {
+            $('#toggleLog').text("Hide");
+        }).catch(error => {
+            appendLogLine(`-- ${error}`);
+        });
+    });
+
+    $('#openBrowser').click(function () {
+        $("div#status").hide();
+        $("div#browser").show();
+        openBrowserFolder("");
+    });
+
+    $('#closeBrowser').click(function () {
+        $("div#browser").hide();
+        $("div#status").show();
+    });
+
+    $('#browserPath').click(function () {
+        // Go up one folder
+        const parts = browserState.prefix.split("/").filter(p => p !== "");
+        parts.pop();
+        openBrowserFolder(parts.length ? parts.join("/") + "/" : "");
+    });
+
+    $('#browserSearchButton').click(function () {
+        browserState.search = $('#browserSearch').val();
+        browserState.nextMarker = "";
+        loadBrowserPage(false);
+    });
+
+    $('#browserMore').click(function () {
+        loadBrowserPage(true);
+    });
+
+    $("#browserEntries").on("click", ".browser-name", function () {
+        const row = $(this).closest("tr");
+        if (row.data("dir")) {
+            openBrowserFolder(row.data("key"));
+        }
+    });
+
+    $("#browserEntries").on("click", ".browser-info-button", function () {
+        window.go.main.App.StatRemoteObject(activeProfile(), $(this).closest("tr").data("key")).then(info => {
+            $("#browserInfo").text(JSON.stringify(info, null, 2)).show();
+        }).catch(error => {
+            console.error(`Error getting object info: ${error}`);
+        });
+    });
+
+    $("#browserEntries").on("click", ".browser-history", function () {
+        showFileHistory($(this).closest("tr").data("key"), "div#browserHistory");
+    });
+
+    $("#browserEntries").on("click", ".browser-download", function () {
+        const row = $(this).closest("tr");
+        const download = row.data("dir")
+            ? window.go.main.App.DownloadRemoteFolder(activeProfile(), row.data("key"))
+            : window.go.main.App.DownloadRemoteFile(activeProfile(), row.data("key"));
+        download.then(result => {
+            console.log("Downloaded:", result);
+        }).catch(error => {
+            alert(`Error downloading: ${error}`);
+        });
+    });
+
+    $('#browserDownloadFolder').click(function () {
+        window.go.main.App.DownloadRemoteFolder(activeProfile(), browserState.prefix).then(count => {
+            console.log(`Downloaded ${count} files`);
+        }).catch(error => {
+            alert(`Error downloading: ${error}`);
+        });
+    });
+
+    $('#browseShareFile').click(function () {
+        window.go.main.App.BrowseFile(activeProfile()).then(file => {
+            $('#sharePath').val(file);
+        }).catch(error => {
+            console.error("Error browsing file:", error);
+        });
+    });
+
+    $('#browseHistoryFile').click(function () {
+        window.go.main.App.BrowseFile(activeProfile()).then(file => {
+            $('#historyPath').val(file);
+        }).catch(error => {
+            console.error("Error browsing file:", error);
+        });
+    });
+
+    $('#showHistory').click(function () {
+        showFileHistory($('#historyPath').val(), "div#fileHistory");
+    });
+
+    $('#createShareLink').click(function () {
+        window.go.main.App.ShareLink(activeProfile(), $('#sharePath').val(), $('#shareExpiry').val()).then(link => {
+            $('#shareLink').val(link.url);
+            $('#shareExpires').text(`Expires ${new Date(link.expires).toLocaleString()}`);
+            $('#shareResult').show();
+        }).catch(error => {
+            console.error("Error creating share link:", error);
+            alert(`Error creating share link: ${error}`);
+        });
+    });
+
+    $('#copyShareLink').click(function () {
+        navigator.clipboard.writeText($('#shareLink').val());
+    });
+
     $('#backupForm').submit(function (event) {
         event.preventDefault();
+        profiles[currentProfile] = readProfile();
         const formData = {
-            backupFolder: $('#backupFolder').val(),
             logFolder: $('#logFolder').val(),
-            minioEndpoint: $('#minioEndpoint').val(),
-            minioKey: $('#minioKey').val(),
-            minioSecret: $('#minioSecret').val(),
-            minioBucketName: $('#minioBucketName').val(),
-            backupFrequencySeconds: $('#backupFrequencySeconds').val()
+            profiles: profiles
         };
-        window.go.main.App.SubmitForm(formData).then(response => {
-            console.log("Form submitted successfully:", response);
-            refreshServiceStatus();
-        }).catch(error => {
-            console.error("Error submitting form:", error);
-            alert("Error submitting form!");
+        window.go.main.App.ValidateForm(formData).then(errors => {
+            showFormErrors(errors || []);
+            if (errors && errors.length > 0) {
+                return;
+            }
+
+            window.go.main.App.SubmitForm(formData).then(response => {
+                console.log("Form submitted successfully:", response);
+                loadConfig();
+                refreshServiceStatus();
+            }).catch(error => {
+                console.error("Error submitting form:", error);
+                alert(`Error submitting form: ${error}`);
+            });
         });
     });
 });
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// BundleFormat identifies a configuration bundle file.
+const BundleFormat = "minisync-bundle"
+
+// bundleVersion is the bundle format version written by this release.
+const bundleVersion = 1
+
+// ErrPassphraseRequired is returned by Bundle.Open when the bundle holds encrypted secret keys but no
+// passphrase was given.
+var ErrPassphraseRequired = errors.New("the bundle contains encrypted secret keys: enter the passphrase it was exported with")
+
+// Bundle is a configuration exported to a single file, for copying MiniSync's settings to another
+// machine. Secret keys are either left out or encrypted with a passphrase chosen at export. The
+// configuration is kept in its own format and version, so that a bundle exported by an earlier release is
+// upgraded when it is opened.
+type Bundle struct {
+	Format   string          `json:"format"`            // Format is always BundleFormat.
+	Version  int             `json:"version"`           // Version is the bundle format version.
+	Exported time.Time       `json:"exported"`          // Exported is when the bundle was created.
+	Config   json.RawMessage `json:"config"`            // Config is the configuration without secret keys.
+	Secrets  *encryptedFile  `json:"secrets,omitempty"` // Secrets are the secret keys sealed with the export passphrase, if included.
+}
+
+// ExportBundle encodes cfg, whose secret keys have been resolved, as a bundle. With an empty passphrase
+// the secret keys are left out; otherwise they are encrypted with it.
+func ExportBundle(cfg *Config, passphrase string) ([]byte, error) {
+	stripped, secrets := splitSecrets(cfg)
+	stripped.Schema = ""
+	stripped.Version = CurrentVersion
+
+	data, err := json.Marshal(stripped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	bundle := Bundle{Format: BundleFormat, Version: bundleVersion, Exported: time.Now().UTC(), Config: data}
+
+	if passphrase != "" && len(secrets) > 0 {
+		bundle.Secrets, err = sealSecrets(passphrase, nil, secrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err = json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	return data, nil
+}
+
+// ParseBundle decodes a bundle file without opening its secrets.
+func ParseBundle(data []byte) (*Bundle, error) {
+	var bundle Bundle
+	err := json.Unmarshal(data, &bundle)
+	if err != nil || bundle.Format != BundleFormat {
+		return nil, errors.New("not a MiniSync configuration bundle")
+	}
+	if bundle.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d was written by a newer MiniSync (this release reads up to version %d)", bundle.Version, bundleVersion)
+	}
+	return &bundle, nil
+}
+
+// Encrypted reports whether the bundle holds secret keys, which need the export passphrase.
+func (b *Bundle) Encrypted() bool {
+	return b.Secrets != nil
+}
+
+// Open returns the bundle's configuration, upgraded to CurrentVersion. The secret keys are decrypted with
+// passphrase if the bundle holds any; otherwise they are left empty.
+func (b *Bundle) Open(passphrase string) (*Config, error) {
+	cfg, _, err := parse(b.Config)
+	if err != nil {
+		return nil, err
+	}
+	if b.Secrets == nil {
+		return cfg, nil
+	}
+
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	secrets, err := openSecrets(passphrase, b.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the secret keys: %w", err)
+	}
+	fillSecrets(cfg, secrets)
+	return cfg, nil
+}
+
+// Folders returns the distinct folder settings of cfg, the log folder and the backup folder of every
+// profile, in sorted order.
+func (c *Config) Folders() []string {
+	seen := map[string]bool{}
+	var folders []string
+	add := func(folder string) {
+		if folder != "" && !seen[folder] {
+			seen[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	add(c.LogFolder)
+	for _, p := range c.Profiles {
+		add(p.BackupFolder)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// RemapFolders rewrites the folder settings of cfg for another machine. mapping maps a folder on the
+// original machine to its replacement; an empty replacement keeps the folder. Every folder setting that
+// is a mapped folder or lies below one is moved, and the longest matching folder wins. Settings without a
+// match are left unchanged.
+func (c *Config) RemapFolders(mapping map[string]string) {
+	remap := func(folder string) string {
+		best := ""
+		for from, to := range mapping {
+			if from != "" && to != "" && isWithin(from, folder) && len(from) > len(best) {
+				best = from
+			}
+		}
+		if best == "" {
+			return folder
+		}
+		rel, ok := relativeTo(best, folder)
+		if !ok {
+			return folder
+		}
+		return filepath.Join(mapping[best], rel)
+	}
+
+	c.LogFolder = remap(c.LogFolder)
+	for i := range c.Profiles {
+		c.Profiles[i].BackupFolder = remap(c.Profiles[i].BackupFolder)
+	}
+}
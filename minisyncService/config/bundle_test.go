@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// bundleConfig returns a configuration with two profiles and resolved secret keys.
+func bundleConfig() *Config {
+	cfg := Default()
+	cfg.LogFolder = filepath.FromSlash("/srv/minisync/logs")
+	cfg.MetricsPort = 9100
+	cfg.Profiles[0].BackupFolder = filepath.FromSlash("/srv/data")
+	cfg.Profiles[0].Primary = minisync.DestinationConfig{Name: "primary", Endpoints: []string{"minio.local:9000"}, BucketName: "backups", AccessKey: "minisync", SecretKey: "s3cret"}
+	cfg.Profiles[0].Destinations = []minisync.DestinationConfig{{Name: "offsite", Endpoints: []string{"https://offsite.example.com"}, BucketName: "offsite", AccessKey: "remote", SecretKey: "an0ther"}}
+
+	photos := DefaultProfile("photos")
+	photos.BackupFolder = filepath.FromSlash("/srv/data/photos")
+	photos.Schedule = "@daily"
+	photos.Primary = minisync.DestinationConfig{Name: "primary", Endpoints: []string{"minio.local:9000"}, BucketName: "photos", AccessKey: "minisync", SecretKey: "ph0tos"}
+	cfg.Profiles = append(cfg.Profiles, *photos)
+	return cfg
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		passphrase  string
+		encrypted   bool
+		withSecrets bool
+	}{
+		{"with secrets", "export passphrase", true, true},
+		{"without secrets", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := bundleConfig()
+			data, err := ExportBundle(cfg, tt.passphrase)
+			if err != nil {
+				t.Fatalf("ExportBundle() error = %v", err)
+			}
+			for _, secret := range []string{"s3cret", "an0ther", "ph0tos"} {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("bundle holds secret key %q in plain text", secret)
+				}
+			}
+			if cfg.Profiles[0].Primary.SecretKey != "s3cret" {
+				t.Errorf("ExportBundle() cleared the secret keys of cfg")
+			}
+
+			bundle, err := ParseBundle(data)
+			if err != nil {
+				t.Fatalf("ParseBundle() error = %v", err)
+			}
+			if bundle.Encrypted() != tt.encrypted {
+				t.Errorf("Encrypted() = %v, want %v", bundle.Encrypted(), tt.encrypted)
+			}
+			if tt.encrypted {
+				if _, err := bundle.Open(""); !errors.Is(err, ErrPassphraseRequired) {
+					t.Errorf("Open() without a passphrase error = %v, want ErrPassphraseRequired", err)
+				}
+				if _, err := bundle.Open("wrong"); err == nil {
+					t.Errorf("Open() with the wrong passphrase succeeded")
+				}
+			}
+
+			got, err := bundle.Open(tt.passphrase)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			want := bundleConfig()
+			want.Schema = ""
+			if !tt.withSecrets {
+				for _, ref := range secretsOf(want) {
+					ref.destination.SecretKey = ""
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Open() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseBundleRejects(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"format": "something-else", "version": 1}`,
+		`{"format": "minisync-bundle", "version": 99}`,
+	} {
+		if _, err := ParseBundle([]byte(data)); err == nil {
+			t.Errorf("ParseBundle(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestRemapFolders(t *testing.T) {
+	from := filepath.FromSlash("/srv/data")
+	tests := []struct {
+		name        string
+		mapping     map[string]string
+		wantLog     string
+		wantBackups []string
+	}{
+		{"no mapping", nil, "/srv/minisync/logs", []string{"/srv/data", "/srv/data/photos"}},
+		{"empty replacement keeps the folder", map[string]string{from: ""}, "/srv/minisync/logs", []string{"/srv/data", "/srv/data/photos"}},
+		{"folders below move along", map[string]string{from: filepath.FromSlash("/home/me/data")}, "/srv/minisync/logs", []string{"/home/me/data", "/home/me/data/photos"}},
+		{"longest match wins", map[string]string{
+			from:                                   filepath.FromSlash("/home/me/data"),
+			filepath.FromSlash("/srv/data/photos"): filepath.FromSlash("/mnt/photos"),
+		}, "/srv/minisync/logs", []string{"/home/me/data", "/mnt/photos"}},
+		{"sibling with the same prefix is not moved", map[string]string{filepath.FromSlash("/srv/minisync/log"): filepath.FromSlash("/tmp")}, "/srv/minisync/logs", []string{"/srv/data", "/srv/data/photos"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := bundleConfig()
+			cfg.RemapFolders(tt.mapping)
+			if cfg.LogFolder != filepath.FromSlash(tt.wantLog) {
+				t.Errorf("log folder = %q, want %q", cfg.LogFolder, filepath.FromSlash(tt.wantLog))
+			}
+			for i, want := range tt.wantBackups {
+				if got := cfg.Profiles[i].BackupFolder; got != filepath.FromSlash(want) {
+					t.Errorf("backup folder of profile %d = %q, want %q", i, got, filepath.FromSlash(want))
+				}
+			}
+		})
+	}
+}
+
+func TestRemapFoldersIgnoresCaseOnWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("folder names are only case-insensitive on Windows")
+	}
+	cfg := bundleConfig()
+	cfg.Profiles[1].BackupFolder = `C:\Users\Me\Photos\Raw`
+	cfg.RemapFolders(map[string]string{`c:\users\me`: `D:\Me`})
+	if got, want := cfg.Profiles[1].BackupFolder, `D:\Me\Photos\Raw`; got != want {
+		t.Errorf("backup folder = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,390 @@
+// Package config reads and writes the MiniSync configuration file shared by the GUI and the service.
+//
+// The configuration is a versioned JSON document described by config.schema.json. Older versions are
+// upgraded when they are loaded, and the MINISYNC_* registry values used by earlier releases are
+// migrated into the file the first time it is loaded.
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mwiater/minisync/minisyncService/logging"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// CurrentVersion is the configuration format version written by this release. Version 2 introduced
+// profiles; a version 1 file becomes a single profile named DefaultProfileName.
+const CurrentVersion = 2
+
+// DefaultProfileName is the name of the profile created for a new installation or an upgraded
+// version 1 configuration.
+const DefaultProfileName = "default"
+
+// ServiceName is the name the MiniSync service is registered under. The GUI uses it to query and
+// control the service that the service binary installs.
+const ServiceName = "MiniSync"
+
+// LogFileName is the name of the service log in the log folder.
+const LogFileName = "MiniSync.log"
+
+// SchemaFileName is the name of the JSON schema written next to the configuration file.
+const SchemaFileName = "config.schema.json"
+
+// schema is the JSON schema describing the configuration file.
+//
+//go:embed config.schema.json
+var schema []byte
+
+// ErrNotConfigured is returned by Load when there is neither a configuration file nor legacy registry values.
+var ErrNotConfigured = errors.New("MiniSync is not configured")
+
+// Config is the MiniSync configuration: the settings shared by every profile, and the profiles.
+type Config struct {
+	Schema         string           `json:"$schema,omitempty"`        // Schema points editors at the JSON schema.
+	Version        int              `json:"version"`                  // Version is the configuration format version.
+	LogFolder      string           `json:"logFolder"`                // LogFolder is where logs, status and history files are written.
+	SecretStore    string           `json:"secretStore,omitempty"`    // SecretStore is where secret keys are kept: keyring (the default) or file.
+	MetricsAddress string           `json:"metricsAddress,omitempty"` // MetricsAddress is the IP address or host name Prometheus metrics are served on, 127.0.0.1 if empty.
+	MetricsPort    int              `json:"metricsPort,omitempty"`    // MetricsPort is the port Prometheus metrics are served on, or 0 to turn them off.
+	Logging        logging.Settings `json:"logging"`                  // Logging sets the format, levels and rotation of the service log.
+	Profiles       []Profile        `json:"profiles"`                 // Profiles are the independent backup jobs.
+}
+
+// Profile is an independent backup job: a local folder replicated to its own destinations on its own
+// schedule. Every profile runs with its own queues, monitor and full sync cycle.
+type Profile struct {
+	Name                   string                       `json:"name"`                   // Name identifies the profile in the GUI, logs and status output.
+	BackupFolder           string                       `json:"backupFolder"`           // BackupFolder is the local folder that is backed up.
+	BackupFrequencySeconds int                          `json:"backupFrequencySeconds"` // BackupFrequencySeconds is the interval between full sync cycles when there is no schedule.
+	Schedule               string                       `json:"schedule,omitempty"`     // Schedule is a cron expression for the full sync cycles, replacing the fixed interval.
+	SyncOnStart            bool                         `json:"syncOnStart,omitempty"`  // SyncOnStart runs a full sync cycle as soon as the profile starts.
+	Mode                   minisync.SyncMode            `json:"mode"`                   // Mode is mirror (deletes are replicated) or backup (they are not).
+	Filter                 minisync.Filter              `json:"filter"`                 // Filter selects the files that are backed up.
+	EndpointStrategy       minisync.EndpointStrategy    `json:"endpointStrategy"`       // EndpointStrategy is failover or roundrobin.
+	Primary                minisync.DestinationConfig   `json:"primary"`                // Primary is the main backup destination.
+	Destinations           []minisync.DestinationConfig `json:"destinations,omitempty"` // Destinations are additional backup destinations.
+	ObjectLock             *minisync.ObjectLock         `json:"objectLock,omitempty"`   // ObjectLock enables WORM retention when set.
+}
+
+// Default returns a configuration with a single profile and every optional setting at its default value.
+func Default() *Config {
+	return &Config{
+		Schema:   SchemaFileName,
+		Version:  CurrentVersion,
+		Profiles: []Profile{*DefaultProfile(DefaultProfileName)},
+	}
+}
+
+// DefaultProfile returns a profile with the given name and every optional setting at its default value.
+func DefaultProfile(name string) *Profile {
+	p := &Profile{Name: name}
+	p.applyDefaults()
+	return p
+}
+
+// applyDefaults fills in the optional settings that are not set.
+func (p *Profile) applyDefaults() {
+	if p.BackupFrequencySeconds == 0 {
+		p.BackupFrequencySeconds = 300
+	}
+	if p.Mode == "" {
+		p.Mode = minisync.Mirror
+	}
+	if p.EndpointStrategy == "" {
+		p.EndpointStrategy = minisync.Failover
+	}
+	if p.Primary.Name == "" {
+		p.Primary.Name = "primary"
+	}
+}
+
+// Profile returns the profile with the given name, or the first profile if name is empty. It returns
+// nil if there is no such profile.
+func (c *Config) Profile(name string) *Profile {
+	for i := range c.Profiles {
+		if name == "" || c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// StateFolder returns the folder in the log folder where the profile's own history files are kept, and
+// creates it if needed.
+func (c *Config) StateFolder(profile string) (string, error) {
+	dir := filepath.Join(c.LogFolder, "profiles", profile)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create state folder of profile %s: %w", profile, err)
+	}
+	return dir, nil
+}
+
+// AllDestinations returns the primary destination followed by the additional destinations.
+func (p *Profile) AllDestinations() []minisync.DestinationConfig {
+	return append([]minisync.DestinationConfig{p.Primary}, p.Destinations...)
+}
+
+// NewMinioClient creates a client for the destination d using the profile's endpoint strategy, creating
+// its bucket if needed. lock is the Object Lock configuration to enforce, or nil when WORM mode is disabled.
+func (p *Profile) NewMinioClient(d minisync.DestinationConfig, lock *minisync.ObjectLock) (*minisync.MinioClient, error) {
+	client, err := minisync.NewMinioClient(d.Endpoints, d.AccessKey, d.SecretKey, d.BucketName, lock)
+	if err != nil {
+		return nil, err
+	}
+	client.Strategy = p.EndpointStrategy
+	return client, nil
+}
+
+// NewReadOnlyMinioClient creates a client for browsing, sharing and reporting on the existing bucket of
+// the destination d, using the profile's endpoint strategy.
+func (p *Profile) NewReadOnlyMinioClient(d minisync.DestinationConfig) (*minisync.MinioClient, error) {
+	client, err := minisync.NewReadOnlyMinioClient(d.Endpoints, d.AccessKey, d.SecretKey, d.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	client.Strategy = p.EndpointStrategy
+	return client, nil
+}
+
+// upgrades holds the step that upgrades a decoded configuration from version i+1 to version i+2.
+// A new format version appends its step here, so that any older file can be brought up to date.
+var upgrades = []func(raw map[string]any) error{
+	upgradeToProfiles,
+}
+
+// upgradeToProfiles moves the settings of a version 1 configuration, apart from the log folder and the
+// secret store, into a single profile named DefaultProfileName.
+func upgradeToProfiles(raw map[string]any) error {
+	profile := map[string]any{"name": DefaultProfileName}
+	for key, value := range raw {
+		switch key {
+		case "$schema", "version", "logFolder", "secretStore":
+		default:
+			profile[key] = value
+			delete(raw, key)
+		}
+	}
+	raw["profiles"] = []any{profile}
+	return nil
+}
+
+// Load reads the configuration file at path and fills in the secret keys from the secret store. Secret
+// keys found in the file itself are moved into the secret store, and a file written by an earlier release
+// is rewritten in the current format. If the file does not exist, the legacy
+// registry values are migrated into a new file at path and removed. If neither exists, the default
+// configuration is returned together with ErrNotConfigured.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return migrateLegacy(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %s: %w", path, err)
+	}
+
+	cfg, upgradedFrom, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if upgradedFrom == 1 {
+		err = renameV1Secrets(path, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if upgradedFrom != 0 || hasSecrets(cfg) {
+		err = Save(path, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update the configuration file: %w", err)
+		}
+	}
+
+	err = ResolveSecrets(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read reads the configuration file at path and fills in the secret keys from the secret store like Load,
+// but never writes anything: a file written by an earlier release is only upgraded in memory and the
+// legacy registry values are read without being migrated. It is meant for checks, such as validating a
+// form, that must not change the saved configuration.
+func Read(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg, found, err := readLegacy()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read legacy configuration: %w", err)
+		}
+		if !found {
+			return Default(), ErrNotConfigured
+		}
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %s: %w", path, err)
+	}
+
+	cfg, upgradedFrom, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if upgradedFrom == 1 {
+		err = resolveV1Secrets(path, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ResolveSecrets(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parse decodes a configuration file, upgrading it to CurrentVersion and filling in defaults. It also
+// returns the version the file was upgraded from, or 0 if it was already current.
+func parse(data []byte) (*Config, int, error) {
+	var raw map[string]any
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse configuration file: %w", err)
+	}
+
+	version, _ := raw["version"].(float64)
+	if int(version) < 1 {
+		return nil, 0, fmt.Errorf("configuration file has no valid version")
+	}
+	if int(version) > CurrentVersion {
+		return nil, 0, fmt.Errorf("configuration file version %d was written by a newer MiniSync (this release reads up to version %d)", int(version), CurrentVersion)
+	}
+	for v := int(version); v < CurrentVersion; v++ {
+		err = upgrades[v-1](raw)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to upgrade configuration from version %d: %w", v, err)
+		}
+		raw["version"] = v + 1
+	}
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to upgrade configuration: %w", err)
+	}
+
+	cfg := &Config{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse configuration file: %w", err)
+	}
+	for i := range cfg.Profiles {
+		cfg.Profiles[i].applyDefaults()
+	}
+
+	upgradedFrom := 0
+	if int(version) < CurrentVersion {
+		upgradedFrom = int(version)
+	}
+	return cfg, upgradedFrom, nil
+}
+
+// Save writes the configuration to path, creating its folder if needed, and writes the JSON schema next
+// to it. Secret keys are written to the secret store instead of the file, and the secret keys of profiles
+// and destinations that the previous file had but cfg no longer has, for example because a profile was
+// renamed, are deleted. The file is replaced atomically so that a reader never sees a partial
+// configuration.
+func Save(path string, cfg *Config) error {
+	cfg.Schema = SchemaFileName
+	cfg.Version = CurrentVersion
+
+	var previous *Config
+	if data, err := os.ReadFile(path); err == nil {
+		previous, _, _ = parse(data)
+	}
+
+	stripped, err := storeSecrets(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(stripped, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create configuration folder %s: %w", dir, err)
+	}
+
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to replace configuration file: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, SchemaFileName), schema, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write configuration schema: %w", err)
+	}
+
+	if previous != nil {
+		err = deleteStaleSecrets(path, previous, cfg)
+		if err != nil {
+			return fmt.Errorf("configuration saved, but failed to delete stale secret keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes the configuration file at path, its schema and the secret keys of its destinations.
+func Remove(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if cfg, _, err := parse(data); err == nil {
+			err = deleteSecrets(path, cfg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove configuration file: %w", err)
+	}
+	os.Remove(filepath.Join(filepath.Dir(path), SchemaFileName))
+	return nil
+}
+
+// migrateLegacy converts the registry values of earlier releases into a configuration file at path and
+// removes them from the registry once the file has been written.
+func migrateLegacy(path string) (*Config, error) {
+	cfg, found, err := readLegacy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate legacy configuration: %w", err)
+	}
+	if !found {
+		return Default(), ErrNotConfigured
+	}
+
+	err = Save(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	removeLegacy()
+	return cfg, nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+func TestUpgradeToProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]any
+		want map[string]any
+	}{
+		{
+			"empty",
+			map[string]any{"version": 1.0},
+			map[string]any{"version": 1.0, "profiles": []any{map[string]any{"name": DefaultProfileName}}},
+		},
+		{
+			"shared settings stay at the top",
+			map[string]any{
+				"$schema":                SchemaFileName,
+				"version":                1.0,
+				"logFolder":              `C:\Logs`,
+				"secretStore":            "file",
+				"backupFolder":           `C:\Data`,
+				"backupFrequencySeconds": 60.0,
+				"primary":                map[string]any{"name": "primary", "bucketName": "backups"},
+			},
+			map[string]any{
+				"$schema":     SchemaFileName,
+				"version":     1.0,
+				"logFolder":   `C:\Logs`,
+				"secretStore": "file",
+				"profiles": []any{map[string]any{
+					"name":                   DefaultProfileName,
+					"backupFolder":           `C:\Data`,
+					"backupFrequencySeconds": 60.0,
+					"primary":                map[string]any{"name": "primary", "bucketName": "backups"},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := upgradeToProfiles(tt.raw)
+			if err != nil {
+				t.Fatalf("upgradeToProfiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.raw, tt.want) {
+				t.Errorf("upgradeToProfiles() = %v, want %v", tt.raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersion1(t *testing.T) {
+	data := []byte(`{
+		"version": 1,
+		"logFolder": "/var/log/minisync",
+		"backupFolder": "/data",
+		"mode": "backup",
+		"primary": {"name": "primary", "endpoints": ["minio.local:9000"], "bucketName": "backups", "accessKey": "minisync"}
+	}`)
+
+	cfg, upgradedFrom, err := parse(data)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if upgradedFrom != 1 {
+		t.Errorf("parse() upgraded from %d, want 1", upgradedFrom)
+	}
+
+	want := DefaultProfile(DefaultProfileName)
+	want.BackupFolder = "/data"
+	want.Mode = minisync.Backup
+	want.Primary = minisync.DestinationConfig{Name: "primary", Endpoints: []string{"minio.local:9000"}, BucketName: "backups", AccessKey: "minisync"}
+	if cfg.Version != CurrentVersion || cfg.LogFolder != "/var/log/minisync" || len(cfg.Profiles) != 1 {
+		t.Fatalf("parse() = %+v, want version %d with log folder /var/log/minisync and one profile", cfg, CurrentVersion)
+	}
+	if !reflect.DeepEqual(cfg.Profiles[0], *want) {
+		t.Errorf("parse() profile = %+v, want %+v", cfg.Profiles[0], *want)
+	}
+}
+
+func TestParseRejectsBadVersions(t *testing.T) {
+	for _, data := range []string{`{}`, `{"version": 0}`, `{"version": 99}`, `not json`} {
+		if _, _, err := parse([]byte(data)); err == nil {
+			t.Errorf("parse(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse")
+	dir := filepath.Join(t.TempDir(), "MiniSync")
+	path := filepath.Join(dir, "config.json")
+	cfg := Default()
+	cfg.SecretStore = FileSecrets
+	cfg.LogFolder = filepath.FromSlash("/var/log/minisync")
+	cfg.Profiles[0].BackupFolder = filepath.FromSlash("/data")
+	cfg.Profiles[0].Primary = minisync.DestinationConfig{Name: "primary", Endpoints: []string{"minio.local:9000"}, BucketName: "backups", AccessKey: "minisync", SecretKey: "s3cret"}
+	photos := DefaultProfile("photos")
+	photos.BackupFolder = filepath.FromSlash("/photos")
+	photos.Primary = minisync.DestinationConfig{Name: "primary", Endpoints: []string{"minio.local:9000"}, BucketName: "photos", AccessKey: "minisync", SecretKey: "ph0tos"}
+	cfg.Profiles = append(cfg.Profiles, *photos)
+
+	err := Save(path, cfg)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SchemaFileName)); err != nil {
+		t.Errorf("schema not written next to the configuration: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("configuration not written: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "ph0tos") {
+		t.Errorf("configuration file holds secret keys:\n%s", data)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("Load() = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestLoadUpgradesVersion1(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	err := os.WriteFile(path, []byte(`{
+		"version": 1,
+		"secretStore": "file",
+		"backupFolder": "/data",
+		"primary": {"name": "primary", "endpoints": ["minio.local:9000"], "bucketName": "backups", "accessKey": "minisync"},
+		"destinations": [{"name": "offsite", "endpoints": ["offsite:9000"], "bucketName": "offsite", "accessKey": "remote", "secretKey": "an0ther"}]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileStore(filepath.Join(dir, secretsFileName), "correct horse")
+	err = store.Set("destination/primary", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	p := cfg.Profile(DefaultProfileName)
+	if p == nil || p.Primary.SecretKey != "s3cret" || len(p.Destinations) != 1 || p.Destinations[0].SecretKey != "an0ther" {
+		t.Fatalf("Load() = %+v, want profile %s with both secret keys", cfg, DefaultProfileName)
+	}
+
+	if _, err := store.Get("destination/primary"); err != ErrSecretNotFound {
+		t.Errorf("version 1 secret name still stored: %v", err)
+	}
+	if secret, err := store.Get(secretName(DefaultProfileName, "offsite")); err != nil || secret != "an0ther" {
+		t.Errorf("secret key of offsite = %q, %v, want it moved into the store", secret, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, upgradedFrom, err := parse(data)
+	if err != nil || upgradedFrom != 0 || len(saved.Profiles) != 1 {
+		t.Errorf("configuration file not rewritten as version %d: %v\n%s", CurrentVersion, err, data)
+	}
+	if strings.Contains(string(data), "an0ther") {
+		t.Errorf("secret key left in the configuration file:\n%s", data)
+	}
+}
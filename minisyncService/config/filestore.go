@@ -0,0 +1,209 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// secretsFileName is the name of the file store next to the configuration file.
+const secretsFileName = "secrets.enc"
+
+// scrypt parameters for deriving the file store key from its passphrase.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// encryptedFile is the on-disk format of the file store, also used for the secrets of a configuration
+// bundle. Data is the JSON encoded map of secrets,
+// sealed with AES-256-GCM under a key derived from the passphrase and Salt.
+type encryptedFile struct {
+	Version int    `json:"version"` // Version is the file format version.
+	Salt    []byte `json:"salt"`    // Salt is the scrypt salt.
+	Nonce   []byte `json:"nonce"`   // Nonce is the GCM nonce of Data.
+	Data    []byte `json:"data"`    // Data is the sealed secrets.
+}
+
+// FileStore is a SecretStore that keeps every secret in a single file encrypted with a passphrase. It is
+// the fallback for systems without usable OS secret storage, such as a Linux server without a desktop
+// session. The whole file is re-encrypted with a fresh nonce on every change.
+type FileStore struct {
+	path       string
+	passphrase string
+	mu         sync.Mutex
+}
+
+// NewFileStore returns a file store at path protected by passphrase. The file is created on the first Set.
+func NewFileStore(path, passphrase string) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+// Get returns the secret stored under name, or ErrSecretNotFound.
+func (s *FileStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, _, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// Set stores value under name, replacing any previous value.
+func (s *FileStore) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, salt, err := s.read()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.write(secrets, salt)
+}
+
+// Delete removes the secret stored under name.
+func (s *FileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, salt, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return nil
+	}
+	delete(secrets, name)
+	return s.write(secrets, salt)
+}
+
+// read decrypts the store and returns its secrets and salt. A missing file yields no secrets and no salt,
+// so that the first write generates one.
+func (s *FileStore) read() (map[string]string, []byte, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read secret store: %w", err)
+	}
+
+	var file encryptedFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secret store: %w", err)
+	}
+
+	secrets, err := openSecrets(s.passphrase, &file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt secret store: %w", err)
+	}
+	return secrets, file.Salt, nil
+}
+
+// write encrypts secrets with a fresh nonce and replaces the store file atomically.
+func (s *FileStore) write(secrets map[string]string, salt []byte) error {
+	file, err := sealSecrets(s.passphrase, salt, secrets)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create secret store folder: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace secret store: %w", err)
+	}
+	return nil
+}
+
+// sealSecrets encrypts secrets under a key derived from passphrase and salt, with a fresh nonce. A nil
+// salt is replaced by a new random one.
+func sealSecrets(passphrase string, salt []byte, secrets map[string]string) (*encryptedFile, error) {
+	if salt == nil {
+		salt = make([]byte, 16)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode secrets: %w", err)
+	}
+
+	gcm, err := deriveCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &encryptedFile{Version: 1, Salt: salt, Nonce: nonce, Data: gcm.Seal(nil, nonce, plaintext, nil)}, nil
+}
+
+// openSecrets decrypts secrets sealed by sealSecrets.
+func openSecrets(passphrase string, file *encryptedFile) (map[string]string, error) {
+	gcm, err := deriveCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or damaged file")
+	}
+
+	secrets := map[string]string{}
+	err = json.Unmarshal(plaintext, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// deriveCipher derives the encryption key from the passphrase and salt.
+func deriveCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive secret store key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
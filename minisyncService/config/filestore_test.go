@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", secretsFileName)
+	store := NewFileStore(path, "correct horse")
+
+	if _, err := store.Get("profile/default/destination/primary"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Get() on a new store error = %v, want ErrSecretNotFound", err)
+	}
+	if err := store.Delete("profile/default/destination/primary"); err != nil {
+		t.Fatalf("Delete() of a missing secret error = %v", err)
+	}
+
+	secrets := map[string]string{
+		"profile/default/destination/primary": "s3cret",
+		"profile/default/destination/offsite": "an0ther",
+	}
+	for name, value := range secrets {
+		if err := store.Set(name, value); err != nil {
+			t.Fatalf("Set(%q) error = %v", name, err)
+		}
+	}
+	if err := store.Set("profile/default/destination/primary", "rotated"); err != nil {
+		t.Fatalf("Set() replacing a secret error = %v", err)
+	}
+	if err := store.Delete("profile/default/destination/offsite"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("store file not written: %v", err)
+	}
+	if strings.Contains(string(data), "rotated") || strings.Contains(string(data), "profile/default") {
+		t.Errorf("store file holds plain text: %s", data)
+	}
+
+	reopened := NewFileStore(path, "correct horse")
+	if value, err := reopened.Get("profile/default/destination/primary"); err != nil || value != "rotated" {
+		t.Errorf("Get() after reopening = %q, %v, want %q", value, err, "rotated")
+	}
+	if _, err := reopened.Get("profile/default/destination/offsite"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get() of a deleted secret error = %v, want ErrSecretNotFound", err)
+	}
+
+	wrong := NewFileStore(path, "wrong horse")
+	if _, err := wrong.Get("profile/default/destination/primary"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get() with the wrong passphrase error = %v, want a decryption error", err)
+	}
+}
+
+func TestOpenSecretStoreDefault(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows defaults to the keyring store")
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv(PassphraseEnv, "")
+	_, err := OpenSecretStore(path, &Config{})
+	if err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Fatalf("OpenSecretStore() without a passphrase error = %v, want one naming %s", err, PassphraseEnv)
+	}
+
+	t.Setenv(PassphraseEnv, "passphrase")
+	store, err := OpenSecretStore(path, &Config{})
+	if err != nil {
+		t.Fatalf("OpenSecretStore() error = %v", err)
+	}
+	if _, ok := store.(*FileStore); !ok {
+		t.Errorf("OpenSecretStore() = %T, want the file store", store)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package config
+
+import (
+	"errors"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"github.com/zalando/go-keyring"
+)
+
+// defaultSecretStore is the secret store used when the secretStore setting is empty. The file store is the
+// default outside Windows, because the Secret Service is not available to a system service without a
+// desktop session.
+const defaultSecretStore = FileSecrets
+
+// passphraseHint tells where to set PassphraseEnv for the service.
+const passphraseHint = "set it in " + minisync.DefaultEnvironmentFile + ", which the installed service reads, or in the environment of the run command"
+
+// keyringService is the service name MiniSync's secrets are stored under in the OS keyring.
+const keyringService = "MiniSync"
+
+// KeyringStore is a SecretStore backed by the OS keyring: the Secret Service on Linux and the Keychain
+// on macOS.
+type KeyringStore struct{}
+
+// NewKeyringStore returns the OS keyring store. dir is not used outside Windows.
+func NewKeyringStore(dir string) *KeyringStore {
+	return &KeyringStore{}
+}
+
+// Get returns the secret stored under name, or ErrSecretNotFound.
+func (s *KeyringStore) Get(name string) (string, error) {
+	value, err := keyring.Get(keyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrSecretNotFound
+	}
+	return value, err
+}
+
+// Set stores value under name, replacing any previous value.
+func (s *KeyringStore) Set(name, value string) error {
+	return keyring.Set(keyringService, name, value)
+}
+
+// Delete removes the secret stored under name.
+func (s *KeyringStore) Delete(name string) error {
+	err := keyring.Delete(keyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultSecretStore is the secret store used when the secretStore setting is empty.
+const defaultSecretStore = KeyringSecrets
+
+// passphraseHint tells where to set PassphraseEnv for the service.
+const passphraseHint = "set it in the environment of the service or choose the keyring store with the secretStore setting"
+
+// keyringFileName is the name of the DPAPI protected secrets file next to the configuration file.
+const keyringFileName = "secrets.dat"
+
+// keyringACL allows only LocalSystem and the Administrators group to access the secrets file.
+const keyringACL = "D:P(A;;FA;;;SY)(A;;FA;;;BA)"
+
+// keyringEntropy is mixed into every DPAPI blob, so that the blobs cannot be decrypted by a generic
+// CryptUnprotectData call without it.
+var keyringEntropy = []byte("MiniSync secret store")
+
+// KeyringStore is a SecretStore protected by the Windows Data Protection API. Secrets are encrypted with
+// the machine key, so that both the GUI, running as an administrator, and the service, running as
+// LocalSystem, can read them, while a copy of the file is useless on any other machine. The file is
+// restricted to LocalSystem and Administrators. The per-user Credential Manager cannot be used because
+// the GUI and the service run as different accounts.
+type KeyringStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewKeyringStore returns the DPAPI store kept in dir.
+func NewKeyringStore(dir string) *KeyringStore {
+	return &KeyringStore{path: filepath.Join(dir, keyringFileName)}
+}
+
+// Get returns the secret stored under name, or ErrSecretNotFound.
+func (s *KeyringStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blobs, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	blob, ok := blobs[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+
+	value, err := dpapi(windows.CryptUnprotectData, blob)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return string(value), nil
+}
+
+// Set stores value under name, replacing any previous value.
+func (s *KeyringStore) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blobs, err := s.read()
+	if err != nil {
+		return err
+	}
+	blob, err := dpapi(cryptProtect, []byte(value))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret %s: %w", name, err)
+	}
+	blobs[name] = blob
+	return s.write(blobs)
+}
+
+// Delete removes the secret stored under name.
+func (s *KeyringStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blobs, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := blobs[name]; !ok {
+		return nil
+	}
+	delete(blobs, name)
+	return s.write(blobs)
+}
+
+// read returns the encrypted secrets by name. A missing file yields no secrets.
+func (s *KeyringStore) read() (map[string][]byte, error) {
+	blobs := map[string][]byte{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return blobs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store: %w", err)
+	}
+	err = json.Unmarshal(data, &blobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secret store: %w", err)
+	}
+	return blobs, nil
+}
+
+// write replaces the secrets file atomically and restricts its access.
+func (s *KeyringStore) write(blobs map[string][]byte) error {
+	data, err := json.Marshal(blobs)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create secret store folder: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	err = restrictAccess(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace secret store: %w", err)
+	}
+	return nil
+}
+
+// restrictAccess replaces the permissions of path with keyringACL.
+func restrictAccess(path string) error {
+	sd, err := windows.SecurityDescriptorFromString(keyringACL)
+	if err != nil {
+		return fmt.Errorf("failed to build secret store permissions: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("failed to build secret store permissions: %w", err)
+	}
+	err = windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restrict secret store permissions: %w", err)
+	}
+	return nil
+}
+
+// cryptProtect adapts CryptProtectData to the signature of CryptUnprotectData.
+func cryptProtect(in *windows.DataBlob, name **uint16, entropy *windows.DataBlob, reserved uintptr, prompt *windows.CryptProtectPromptStruct, flags uint32, out *windows.DataBlob) error {
+	return windows.CryptProtectData(in, nil, entropy, reserved, prompt, flags, out)
+}
+
+// dpapi runs a DPAPI function with the machine key and keyringEntropy over data and returns its output.
+func dpapi(fn func(*windows.DataBlob, **uint16, *windows.DataBlob, uintptr, *windows.CryptProtectPromptStruct, uint32, *windows.DataBlob) error, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty secret")
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	entropy := windows.DataBlob{Size: uint32(len(keyringEntropy)), Data: &keyringEntropy[0]}
+	var out windows.DataBlob
+	err := fn(&in, nil, &entropy, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN|windows.CRYPTPROTECT_LOCAL_MACHINE, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
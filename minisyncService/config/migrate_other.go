@@ -0,0 +1,11 @@
+//go:build !windows
+
+package config
+
+// readLegacy reports that there is no legacy configuration; only Windows releases used the registry.
+func readLegacy() (*Config, bool, error) {
+	return nil, false, nil
+}
+
+// removeLegacy does nothing outside of Windows.
+func removeLegacy() {}
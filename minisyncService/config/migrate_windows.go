@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"golang.org/x/sys/windows/registry"
+)
+
+// legacyKeyPath is the registry key under which earlier releases stored their settings as system
+// environment variables.
+const legacyKeyPath = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+
+// Registry values written by earlier releases. Reading them through these constants, rather than
+// repeating the strings, keeps the names used for reading and for removal in step.
+const (
+	legacyBackupFolder     = "MINISYNC_BACKUPFOLDER"
+	legacyBackFolder       = "MINISYNC_BACKFOLDER"
+	legacyLogFolder        = "MINISYNC_LOGFOLDER"
+	legacyEndpoint         = "MINISYNC_MINIO_ENDPOINT"
+	legacyEndpointStrategy = "MINISYNC_MINIO_ENDPOINT_STRATEGY"
+	legacyBucketName       = "MINISYNC_MINIO_BUCKETNAME"
+	legacyFrequency        = "MINISYNC_MINIO_BACKUPFREQUENCYSECONDS"
+	legacyAccessKey        = "MINISYNC_MINIO_ACCESS_KEY"
+	legacySecretKey        = "MINISYNC_MINIO_SECRET_KEY"
+	legacyDestinations     = "MINISYNC_MINIO_DESTINATIONS"
+	legacyLockMode         = "MINISYNC_OBJECTLOCK_MODE"
+	legacyLockDays         = "MINISYNC_OBJECTLOCK_DAYS"
+	legacyLockLegalHold    = "MINISYNC_OBJECTLOCK_LEGALHOLD"
+	legacyLockRules        = "MINISYNC_OBJECTLOCK_RULES"
+)
+
+// legacyNames are the registry values written by earlier releases. The GUI wrote the backup folder as
+// MINISYNC_BACKFOLDER while the service read MINISYNC_BACKUPFOLDER, so both are migrated.
+var legacyNames = []string{
+	legacyBackupFolder,
+	legacyBackFolder,
+	legacyLogFolder,
+	legacyEndpoint,
+	legacyEndpointStrategy,
+	legacyBucketName,
+	legacyFrequency,
+	legacyAccessKey,
+	legacySecretKey,
+	legacyDestinations,
+	legacyLockMode,
+	legacyLockDays,
+	legacyLockLegalHold,
+	legacyLockRules,
+}
+
+// legacyDestination is the registry format of an additional destination, with a comma separated endpoint list.
+type legacyDestination struct {
+	Name       string `json:"name"`
+	Endpoint   string `json:"endpoint"`
+	BucketName string `json:"bucketName"`
+	AccessKey  string `json:"accessKey"`
+	SecretKey  string `json:"secretKey"`
+}
+
+// readLegacy builds a configuration from the registry values of earlier releases. It reports false if
+// none of them are set.
+func readLegacy() (*Config, bool, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, legacyKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open registry key: %w", err)
+	}
+	defer key.Close()
+
+	values := map[string]string{}
+	for _, name := range legacyNames {
+		value, _, err := key.GetStringValue(name)
+		if err == nil && value != "" {
+			values[name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+
+	cfg := Default()
+	cfg.LogFolder = values[legacyLogFolder]
+	p := &cfg.Profiles[0]
+	p.BackupFolder = values[legacyBackupFolder]
+	if p.BackupFolder == "" {
+		p.BackupFolder = values[legacyBackFolder]
+	}
+	p.Primary.Endpoints = minisync.ParseEndpoints(values[legacyEndpoint])
+	p.Primary.BucketName = values[legacyBucketName]
+	p.Primary.AccessKey = values[legacyAccessKey]
+	p.Primary.SecretKey = values[legacySecretKey]
+
+	if seconds, err := strconv.Atoi(values[legacyFrequency]); err == nil && seconds > 0 {
+		p.BackupFrequencySeconds = seconds
+	}
+
+	if strategy, err := minisync.ParseEndpointStrategy(values[legacyEndpointStrategy]); err == nil {
+		p.EndpointStrategy = strategy
+	}
+
+	lock, err := minisync.NewObjectLock(values[legacyLockMode], values[legacyLockDays], values[legacyLockLegalHold], values[legacyLockRules])
+	if err != nil {
+		log.Printf("Ignoring invalid legacy Object Lock settings: %v", err)
+	} else {
+		p.ObjectLock = lock
+	}
+
+	if value := values[legacyDestinations]; value != "" {
+		var destinations []legacyDestination
+		err := json.Unmarshal([]byte(value), &destinations)
+		if err != nil {
+			log.Printf("Ignoring invalid legacy destinations: %v", err)
+		}
+		for _, d := range destinations {
+			p.Destinations = append(p.Destinations, minisync.DestinationConfig{
+				Name:       d.Name,
+				Endpoints:  minisync.ParseEndpoints(d.Endpoint),
+				BucketName: d.BucketName,
+				AccessKey:  d.AccessKey,
+				SecretKey:  d.SecretKey,
+			})
+		}
+	}
+
+	return cfg, true, nil
+}
+
+// removeLegacy deletes the registry values of earlier releases, so that they no longer appear in the
+// environment of every process.
+func removeLegacy() {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, legacyKeyPath, registry.SET_VALUE)
+	if err != nil {
+		log.Printf("Failed to open registry key: %v", err)
+		return
+	}
+	defer key.Close()
+
+	for _, name := range legacyNames {
+		err := key.DeleteValue(name)
+		if err != nil && err != registry.ErrNotExist {
+			log.Printf("Failed to remove legacy registry value %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package config
+
+// DefaultPath returns the location of the configuration file, /etc/minisync/config.json.
+func DefaultPath() string {
+	return "/etc/minisync/config.json"
+}
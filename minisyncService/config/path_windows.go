@@ -0,0 +1,16 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultPath returns the location of the configuration file, %ProgramData%\MiniSync\config.json, which
+// is readable by both the GUI and the service running as LocalSystem.
+func DefaultPath() string {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		programData = `C:\ProgramData`
+	}
+	return filepath.Join(programData, "MiniSync", "config.json")
+}
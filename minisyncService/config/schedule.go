@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ParseSchedule parses a full sync schedule: a standard five-field cron expression such as
+// "0 */2 * * *", or a descriptor such as "@daily", "@hourly" or "@every 90m". Times are local unless the
+// expression starts with CRON_TZ=<zone>.
+func ParseSchedule(expression string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expression, err)
+	}
+	return schedule, nil
+}
+
+// NextRun returns when the next full sync cycle of the profile is due after the given time: the next
+// time matching its schedule if it has one, otherwise one backup frequency later.
+func (p *Profile) NextRun(after time.Time) time.Time {
+	if p.Schedule != "" {
+		schedule, err := ParseSchedule(p.Schedule)
+		if err == nil {
+			return schedule.Next(after)
+		}
+	}
+	return after.Add(time.Duration(p.BackupFrequencySeconds) * time.Second)
+}
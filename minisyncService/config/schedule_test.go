@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    bool
+	}{
+		{"0 */2 * * *", false},
+		{"30 1 * * 1-5", false},
+		{"@daily", false},
+		{"@every 90m", false},
+		{"CRON_TZ=Europe/Berlin 0 3 * * *", false},
+		{"", true},
+		{"every day", true},
+		{"0 */2 * *", true},
+		{"0 0 */2 * * *", true},
+		{"61 * * * *", true},
+		{"CRON_TZ=Nowhere/City 0 3 * * *", true},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.expression)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSchedule(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	after := time.Date(2024, 3, 1, 10, 17, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		schedule  string
+		frequency int
+		want      time.Time
+	}{
+		{"fixed frequency", "", 300, after.Add(5 * time.Minute)},
+		{"every two hours", "CRON_TZ=UTC 0 */2 * * *", 300, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"daily", "CRON_TZ=UTC @daily", 300, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"every 90 minutes", "@every 90m", 300, after.Add(90 * time.Minute)},
+		{"invalid schedule falls back to the frequency", "every day", 60, after.Add(time.Minute)},
+	}
+	for _, tt := range tests {
+		p := DefaultProfile("test")
+		p.Schedule = tt.schedule
+		p.BackupFrequencySeconds = tt.frequency
+		if got := p.NextRun(after); !got.Equal(tt.want) {
+			t.Errorf("%s: NextRun(%v) = %v, want %v", tt.name, after, got, tt.want)
+		}
+	}
+}
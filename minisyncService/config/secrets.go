@@ -0,0 +1,282 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// Secret store kinds, selected by the secretStore setting. Without one, Windows uses KeyringSecrets and
+// every other system FileSecrets.
+const (
+	KeyringSecrets = "keyring" // KeyringSecrets keeps secrets in the operating system's secret storage.
+	FileSecrets    = "file"    // FileSecrets keeps secrets in a passphrase-encrypted file next to the configuration.
+)
+
+// PassphraseEnv is the environment variable holding the passphrase of the file secret store.
+const PassphraseEnv = "MINISYNC_SECRETS_PASSPHRASE"
+
+// ErrSecretNotFound is returned by SecretStore.Get when no secret is stored under the name.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore keeps the MinIO secret keys out of the configuration file.
+type SecretStore interface {
+	// Get returns the secret stored under name, or ErrSecretNotFound.
+	Get(name string) (string, error)
+
+	// Set stores value under name, replacing any previous value.
+	Set(name, value string) error
+
+	// Delete removes the secret stored under name. Deleting a missing secret is not an error.
+	Delete(name string) error
+}
+
+// OpenSecretStore opens the secret store selected by cfg for the configuration file at path. The file
+// store reads its passphrase from the PassphraseEnv environment variable.
+func OpenSecretStore(path string, cfg *Config) (SecretStore, error) {
+	dir := filepath.Dir(path)
+	switch storeKind(cfg) {
+	case KeyringSecrets:
+		return NewKeyringStore(dir), nil
+	case FileSecrets:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("the file secret store needs a passphrase in the %s environment variable: %s", PassphraseEnv, passphraseHint)
+		}
+		return NewFileStore(filepath.Join(dir, secretsFileName), passphrase), nil
+	default:
+		return nil, fmt.Errorf("unknown secret store %q: must be %s or %s", cfg.SecretStore, KeyringSecrets, FileSecrets)
+	}
+}
+
+// secretName is the name the secret key of a profile's destination is stored under.
+func secretName(profile, destination string) string {
+	return "profile/" + profile + "/destination/" + destination
+}
+
+// secretRef is a destination of a profile whose secret key can be filled in or cleared.
+type secretRef struct {
+	profile     string
+	destination *minisync.DestinationConfig
+}
+
+// name returns the name the secret key is stored under.
+func (r secretRef) name() string {
+	return secretName(r.profile, r.destination.Name)
+}
+
+// secretsOf returns the primary and additional destinations of every profile of cfg.
+func secretsOf(cfg *Config) []secretRef {
+	var refs []secretRef
+	for i := range cfg.Profiles {
+		p := &cfg.Profiles[i]
+		refs = append(refs, secretRef{p.Name, &p.Primary})
+		for j := range p.Destinations {
+			refs = append(refs, secretRef{p.Name, &p.Destinations[j]})
+		}
+	}
+	return refs
+}
+
+// ResolveSecrets fills in every empty secret key of cfg from its secret store. Destinations without a
+// stored secret are left empty, so that Validate reports them.
+func ResolveSecrets(path string, cfg *Config) error {
+	store, err := OpenSecretStore(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range secretsOf(cfg) {
+		if ref.destination.SecretKey != "" {
+			continue
+		}
+		secret, err := store.Get(ref.name())
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the secret key of destination %s of profile %s: %w", ref.destination.Name, ref.profile, err)
+		}
+		ref.destination.SecretKey = secret
+	}
+	return nil
+}
+
+// splitSecrets returns a copy of cfg without secret keys, together with the secret keys by the name they
+// are stored under.
+func splitSecrets(cfg *Config) (*Config, map[string]string) {
+	stripped := *cfg
+	stripped.Profiles = make([]Profile, len(cfg.Profiles))
+	for i, p := range cfg.Profiles {
+		p.Destinations = append([]minisync.DestinationConfig(nil), p.Destinations...)
+		stripped.Profiles[i] = p
+	}
+
+	secrets := map[string]string{}
+	for _, ref := range secretsOf(&stripped) {
+		if ref.destination.SecretKey != "" {
+			secrets[ref.name()] = ref.destination.SecretKey
+			ref.destination.SecretKey = ""
+		}
+	}
+	return &stripped, secrets
+}
+
+// fillSecrets sets the secret keys of cfg from secrets, keyed by the name they are stored under.
+func fillSecrets(cfg *Config, secrets map[string]string) {
+	for _, ref := range secretsOf(cfg) {
+		if secret, ok := secrets[ref.name()]; ok {
+			ref.destination.SecretKey = secret
+		}
+	}
+}
+
+// storeSecrets moves the secret keys of cfg into its secret store and returns a copy of cfg without them,
+// ready to be written to the configuration file.
+func storeSecrets(path string, cfg *Config) (*Config, error) {
+	stripped, secrets := splitSecrets(cfg)
+	if len(secrets) == 0 {
+		return stripped, nil
+	}
+
+	store, err := OpenSecretStore(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for name, secret := range secrets {
+		err := store.Set(name, secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store secret %s: %w", name, err)
+		}
+	}
+	return stripped, nil
+}
+
+// deleteSecrets removes the secret keys of every destination of cfg from its secret store.
+func deleteSecrets(path string, cfg *Config) error {
+	store, err := OpenSecretStore(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range secretsOf(cfg) {
+		err := store.Delete(ref.name())
+		if err != nil {
+			return fmt.Errorf("failed to delete the secret key of destination %s of profile %s: %w", ref.destination.Name, ref.profile, err)
+		}
+	}
+	return nil
+}
+
+// deleteStaleSecrets removes from the secret store of previous the secret keys of destinations that cfg
+// no longer has under the same profile name, such as those of renamed or removed profiles and
+// destinations. If cfg uses another secret store, every secret key of previous is stale. The store is
+// only opened when there is something to delete.
+func deleteStaleSecrets(path string, previous, cfg *Config) error {
+	kept := map[string]bool{}
+	if storeKind(previous) == storeKind(cfg) {
+		for _, ref := range secretsOf(cfg) {
+			kept[ref.name()] = true
+		}
+	}
+
+	var stale []secretRef
+	for _, ref := range secretsOf(previous) {
+		if !kept[ref.name()] {
+			stale = append(stale, ref)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	store, err := OpenSecretStore(path, previous)
+	if err != nil {
+		return err
+	}
+	for _, ref := range stale {
+		err := store.Delete(ref.name())
+		if err != nil {
+			return fmt.Errorf("failed to delete the secret key of destination %s of profile %s: %w", ref.destination.Name, ref.profile, err)
+		}
+	}
+	return nil
+}
+
+// storeKind returns the secret store selected by cfg, with the default of the platform made explicit.
+func storeKind(cfg *Config) string {
+	if cfg.SecretStore == "" {
+		return defaultSecretStore
+	}
+	return cfg.SecretStore
+}
+
+// renameV1Secrets moves the secret keys stored by a version 1 configuration, which had no profiles, to
+// the names of the profile the configuration was upgraded into. Secret keys still in the file are left
+// for Save to store.
+func renameV1Secrets(path string, cfg *Config) error {
+	store, err := OpenSecretStore(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range secretsOf(cfg) {
+		oldName := "destination/" + ref.destination.Name
+		secret, err := store.Get(oldName)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the secret key of destination %s: %w", ref.destination.Name, err)
+		}
+		if ref.destination.SecretKey == "" {
+			err = store.Set(ref.name(), secret)
+			if err != nil {
+				return fmt.Errorf("failed to store the secret key of destination %s of profile %s: %w", ref.destination.Name, ref.profile, err)
+			}
+		}
+		err = store.Delete(oldName)
+		if err != nil {
+			return fmt.Errorf("failed to delete the secret key of destination %s: %w", ref.destination.Name, err)
+		}
+	}
+	return nil
+}
+
+// resolveV1Secrets fills in the empty secret keys of a configuration upgraded from version 1 from the
+// names that version stored them under, without moving them.
+func resolveV1Secrets(path string, cfg *Config) error {
+	store, err := OpenSecretStore(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range secretsOf(cfg) {
+		if ref.destination.SecretKey != "" {
+			continue
+		}
+		secret, err := store.Get("destination/" + ref.destination.Name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the secret key of destination %s: %w", ref.destination.Name, err)
+		}
+		ref.destination.SecretKey = secret
+	}
+	return nil
+}
+
+// hasSecrets reports whether cfg holds any secret key, as a configuration file written by an earlier
+// release or edited by hand may.
+func hasSecrets(cfg *Config) bool {
+	for _, ref := range secretsOf(cfg) {
+		if ref.destination.SecretKey != "" {
+			return true
+		}
+	}
+	return false
+}
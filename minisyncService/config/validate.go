@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+const (
+	// MinBackupFrequencySeconds is the shortest allowed interval between full sync cycles. Each cycle
+	// stats every file against the bucket, so shorter intervals only add load.
+	MinBackupFrequencySeconds = 10
+
+	// MaxBackupFrequencySeconds is the longest allowed interval between full sync cycles (one week).
+	MaxBackupFrequencySeconds = 7 * 24 * 60 * 60
+)
+
+// FieldError is a problem with a single configuration setting.
+type FieldError struct {
+	Field   string `json:"field"`   // Field is the JSON path of the setting, such as "profiles[0].primary.bucketName" or "profiles[1].destinations[0].endpoints".
+	Message string `json:"message"` // Message describes the problem.
+}
+
+// Error implements the error interface.
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors lists every problem found in a configuration. Validate returns it as its error, so
+// callers that show the problems next to the form fields can retrieve it with errors.As.
+type ValidationErrors []FieldError
+
+// Error implements the error interface, joining the individual problems.
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// Add records a problem with field.
+func (errs *ValidationErrors) Add(field, format string, args ...any) {
+	*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns errs as an error, or nil if there are no problems.
+func (errs ValidationErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Validate checks every setting and returns a ValidationErrors listing all problems, or nil. Besides
+// required values it checks that the folders exist and are accessible, that the log folder is not inside
+// a backup folder, that profile names are unique, that endpoints are host:port or http(s) URLs, that
+// bucket names follow the S3 naming rules, that schedules are valid cron expressions, that the backup
+// frequency is between MinBackupFrequencySeconds and MaxBackupFrequencySeconds, that the metrics address
+// and port are a valid address and port number and that the log format and levels are known.
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+
+	validateFolder(&errs, "logFolder", c.LogFolder, true)
+	if c.SecretStore != "" && c.SecretStore != KeyringSecrets && c.SecretStore != FileSecrets {
+		errs.Add("secretStore", "must be %s or %s", KeyringSecrets, FileSecrets)
+	}
+	if c.MetricsAddress != "" && net.ParseIP(c.MetricsAddress) == nil && strings.ContainsAny(c.MetricsAddress, ":/?#@[] ") {
+		errs.Add("metricsAddress", "must be an IP address or host name without a port")
+	}
+	if c.MetricsPort < 0 || c.MetricsPort > 65535 {
+		errs.Add("metricsPort", "must be a port number between 1 and 65535, or 0 to turn metrics off")
+	}
+	problems := c.Logging.Validate()
+	settings := make([]string, 0, len(problems))
+	for setting := range problems {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		errs.Add("logging."+setting, "%s", problems[setting])
+	}
+
+	if len(c.Profiles) == 0 {
+		errs.Add("profiles", "at least one profile is required")
+	}
+	names := map[string]bool{}
+	for i, p := range c.Profiles {
+		field := fmt.Sprintf("profiles[%d]", i)
+		p.validate(&errs, field)
+		if p.Name != "" && names[p.Name] {
+			errs.Add(field+".name", "%q is already used by another profile", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.BackupFolder != "" && c.LogFolder != "" && isWithin(p.BackupFolder, c.LogFolder) {
+			errs.Add("logFolder", "must not be inside the backup folder of profile %s, or the log files would be backed up as they are written", p.Name)
+		}
+	}
+
+	return errs.Err()
+}
+
+// validate checks the settings of a single profile; field is its JSON path.
+func (p *Profile) validate(errs *ValidationErrors, field string) {
+	if strings.TrimSpace(p.Name) == "" {
+		errs.Add(field+".name", "is required")
+	} else if strings.ContainsAny(p.Name, `/\:*?"<>|`) {
+		errs.Add(field+".name", "must not contain any of / \\ : * ? \" < > |")
+	}
+
+	validateFolder(errs, field+".backupFolder", p.BackupFolder, false)
+	if p.BackupFrequencySeconds < MinBackupFrequencySeconds || p.BackupFrequencySeconds > MaxBackupFrequencySeconds {
+		errs.Add(field+".backupFrequencySeconds", "must be between %d and %d seconds", MinBackupFrequencySeconds, MaxBackupFrequencySeconds)
+	}
+	if p.Schedule != "" {
+		if _, err := ParseSchedule(p.Schedule); err != nil {
+			errs.Add(field+".schedule", "must be a cron expression such as \"0 */2 * * *\" or a descriptor such as @daily")
+		}
+	}
+	if _, err := minisync.ParseSyncMode(string(p.Mode)); err != nil {
+		errs.Add(field+".mode", "must be %s or %s", minisync.Mirror, minisync.Backup)
+	}
+	if err := p.Filter.Validate(); err != nil {
+		errs.Add(field+".filter", "%v", err)
+	}
+	if _, err := minisync.ParseEndpointStrategy(string(p.EndpointStrategy)); err != nil {
+		errs.Add(field+".endpointStrategy", "must be failover or roundrobin")
+	}
+
+	validateDestination(errs, field+".primary", p.Primary)
+	names := map[string]bool{p.Primary.Name: true}
+	for i, d := range p.Destinations {
+		destinationField := fmt.Sprintf("%s.destinations[%d]", field, i)
+		validateDestination(errs, destinationField, d)
+		if d.Name != "" && names[d.Name] {
+			errs.Add(destinationField+".name", "%q is already used by another destination", d.Name)
+		}
+		names[d.Name] = true
+	}
+}
+
+// validateFolder checks that path is an existing, readable folder, and writable if writable is set.
+func validateFolder(errs *ValidationErrors, field, path string, writable bool) {
+	if path == "" {
+		errs.Add(field, "is required")
+		return
+	}
+	if !filepath.IsAbs(path) {
+		errs.Add(field, "must be an absolute path")
+		return
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		errs.Add(field, "%s does not exist", path)
+		return
+	}
+	if err != nil {
+		errs.Add(field, "cannot be accessed: %v", err)
+		return
+	}
+	if !info.IsDir() {
+		errs.Add(field, "%s is not a folder", path)
+		return
+	}
+
+	dir, err := os.Open(path)
+	if err == nil {
+		_, err = dir.Readdirnames(1)
+		dir.Close()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		errs.Add(field, "cannot be read: %v", err)
+		return
+	}
+
+	if writable {
+		f, err := os.CreateTemp(path, ".minisync-*")
+		if err != nil {
+			errs.Add(field, "cannot be written: %v", err)
+			return
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// validateDestination checks the settings of a single destination; field is its JSON path.
+func validateDestination(errs *ValidationErrors, field string, d minisync.DestinationConfig) {
+	if strings.TrimSpace(d.Name) == "" {
+		errs.Add(field+".name", "is required")
+	}
+
+	if len(d.Endpoints) == 0 {
+		errs.Add(field+".endpoints", "at least one endpoint is required")
+	}
+	for _, endpoint := range d.Endpoints {
+		if _, _, err := minisync.ParseEndpoint(endpoint); err != nil {
+			errs.Add(field+".endpoints", "%v", err)
+		}
+	}
+
+	if d.BucketName == "" {
+		errs.Add(field+".bucketName", "is required")
+	} else if err := s3utils.CheckValidBucketNameStrict(d.BucketName); err != nil {
+		errs.Add(field+".bucketName", "%v", err)
+	}
+
+	if d.AccessKey == "" {
+		errs.Add(field+".accessKey", "is required")
+	}
+	if d.SecretKey == "" {
+		errs.Add(field+".secretKey", "is required")
+	}
+}
+
+// isWithin reports whether child is parent or a folder below it. Windows paths are compared
+// case-insensitively.
+func isWithin(parent, child string) bool {
+	_, ok := relativeTo(parent, child)
+	return ok
+}
+
+// relativeTo returns the path of child relative to parent, and whether child is parent or a folder below
+// it. Windows paths are compared case-insensitively, and the returned path keeps the case of child.
+func relativeTo(parent, child string) (string, bool) {
+	parent, child = filepath.Clean(parent), filepath.Clean(child)
+	if runtime.GOOS != "windows" {
+		rel, err := filepath.Rel(parent, child)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return rel, true
+	}
+
+	if len(child) < len(parent) || !strings.EqualFold(child[:len(parent)], parent) {
+		return "", false
+	}
+	rest := child[len(parent):]
+	switch {
+	case rest == "":
+		return ".", true
+	case strings.HasSuffix(parent, string(filepath.Separator)):
+		// parent is a volume root such as C:\, so rest already starts below it.
+		return rest, true
+	case rest[0] == filepath.Separator:
+		return rest[1:], true
+	default:
+		return "", false
+	}
+}
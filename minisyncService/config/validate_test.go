@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// validConfig returns a configuration that passes Validate, with its folders in a temporary folder.
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	root := t.TempDir()
+	cfg := Default()
+	cfg.LogFolder = filepath.Join(root, "logs")
+	p := &cfg.Profiles[0]
+	p.BackupFolder = filepath.Join(root, "backup")
+	p.Primary = minisync.DestinationConfig{
+		Name:       "primary",
+		Endpoints:  []string{"minio.local:9000"},
+		BucketName: "backups",
+		AccessKey:  "minisync",
+		SecretKey:  "secret",
+	}
+	for _, dir := range []string{cfg.LogFolder, p.BackupFolder} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		fields []string
+	}{
+		{"valid", func(cfg *Config) {}, nil},
+		{"valid with everything optional set", func(cfg *Config) {
+			cfg.SecretStore = FileSecrets
+			cfg.MetricsAddress = "::1"
+			cfg.MetricsPort = 9100
+			cfg.Logging.Format = "json"
+			cfg.Profiles[0].Schedule = "@daily"
+			cfg.Profiles[0].EndpointStrategy = minisync.RoundRobin
+			cfg.Profiles[0].Primary.Endpoints = []string{"https://minio.local", "http://10.0.0.5:9000"}
+			second := *DefaultProfile("second")
+			second.BackupFolder = cfg.Profiles[0].BackupFolder
+			second.Primary = cfg.Profiles[0].Primary
+			second.Destinations = []minisync.DestinationConfig{{Name: "offsite", Endpoints: []string{"offsite:9000"}, BucketName: "offsite", AccessKey: "a", SecretKey: "s"}}
+			cfg.Profiles = append(cfg.Profiles, second)
+		}, nil},
+		{"missing log folder", func(cfg *Config) { cfg.LogFolder = "" }, []string{"logFolder"}},
+		{"relative log folder", func(cfg *Config) { cfg.LogFolder = "logs" }, []string{"logFolder"}},
+		{"log folder does not exist", func(cfg *Config) { cfg.LogFolder = filepath.Join(cfg.LogFolder, "missing") }, []string{"logFolder"}},
+		{"log folder inside backup folder", func(cfg *Config) {
+			cfg.LogFolder = cfg.Profiles[0].BackupFolder
+		}, []string{"logFolder"}},
+		{"unknown secret store", func(cfg *Config) { cfg.SecretStore = "vault" }, []string{"secretStore"}},
+		{"metrics address with port", func(cfg *Config) { cfg.MetricsAddress = "0.0.0.0:9100" }, []string{"metricsAddress"}},
+		{"metrics address as URL", func(cfg *Config) { cfg.MetricsAddress = "http://monitor" }, []string{"metricsAddress"}},
+		{"metrics port out of range", func(cfg *Config) { cfg.MetricsPort = 70000 }, []string{"metricsPort"}},
+		{"unknown log format", func(cfg *Config) { cfg.Logging.Format = "xml" }, []string{"logging.format"}},
+		{"no profiles", func(cfg *Config) { cfg.Profiles = nil }, []string{"profiles"}},
+		{"missing profile name", func(cfg *Config) { cfg.Profiles[0].Name = " " }, []string{"profiles[0].name"}},
+		{"profile name with slash", func(cfg *Config) { cfg.Profiles[0].Name = "a/b" }, []string{"profiles[0].name"}},
+		{"duplicate profile name", func(cfg *Config) {
+			cfg.Profiles = append(cfg.Profiles, cfg.Profiles[0])
+		}, []string{"profiles[1].name"}},
+		{"backup folder is a file", func(cfg *Config) {
+			file := filepath.Join(cfg.LogFolder, "file.txt")
+			os.WriteFile(file, nil, 0644)
+			cfg.Profiles[0].BackupFolder = file
+		}, []string{"profiles[0].backupFolder"}},
+		{"frequency too short", func(cfg *Config) { cfg.Profiles[0].BackupFrequencySeconds = 5 }, []string{"profiles[0].backupFrequencySeconds"}},
+		{"frequency too long", func(cfg *Config) {
+			cfg.Profiles[0].BackupFrequencySeconds = MaxBackupFrequencySeconds + 1
+		}, []string{"profiles[0].backupFrequencySeconds"}},
+		{"bad schedule", func(cfg *Config) { cfg.Profiles[0].Schedule = "every day" }, []string{"profiles[0].schedule"}},
+		{"unknown mode", func(cfg *Config) { cfg.Profiles[0].Mode = "copy" }, []string{"profiles[0].mode"}},
+		{"bad filter", func(cfg *Config) { cfg.Profiles[0].Filter.Include = []string{"["} }, []string{"profiles[0].filter"}},
+		{"unknown endpoint strategy", func(cfg *Config) { cfg.Profiles[0].EndpointStrategy = "random" }, []string{"profiles[0].endpointStrategy"}},
+		{"missing destination settings", func(cfg *Config) {
+			cfg.Profiles[0].Primary = minisync.DestinationConfig{}
+		}, []string{
+			"profiles[0].primary.name",
+			"profiles[0].primary.endpoints",
+			"profiles[0].primary.bucketName",
+			"profiles[0].primary.accessKey",
+			"profiles[0].primary.secretKey",
+		}},
+		{"bad endpoint", func(cfg *Config) { cfg.Profiles[0].Primary.Endpoints = []string{"minio.local"} }, []string{"profiles[0].primary.endpoints"}},
+		{"bad bucket name", func(cfg *Config) { cfg.Profiles[0].Primary.BucketName = "My_Bucket" }, []string{"profiles[0].primary.bucketName"}},
+		{"duplicate destination name", func(cfg *Config) {
+			cfg.Profiles[0].Destinations = []minisync.DestinationConfig{cfg.Profiles[0].Primary}
+		}, []string{"profiles[0].destinations[0].name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			var fields []string
+			var errs ValidationErrors
+			if errors.As(err, &errs) {
+				for _, e := range errs {
+					fields = append(fields, e.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate() error = %v, want a ValidationErrors", err)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("Validate() reported %q, want %q (%v)", fields, tt.fields, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package control
+
+// restrictAccess does nothing outside Windows, where the control file is created with mode 0600.
+func restrictAccess(path string) error {
+	return nil
+}
@@ -0,0 +1,29 @@
+package control
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// controlFileACL allows only LocalSystem, the Administrators group and the owner of the control file, the
+// account the service runs as, to access it. File modes are ignored on Windows, so without it the file
+// would inherit the permissions of the log folder, which ordinary users can often read.
+const controlFileACL = "D:P(A;;FA;;;SY)(A;;FA;;;BA)(A;;FA;;;OW)"
+
+// restrictAccess replaces the permissions of path with controlFileACL.
+func restrictAccess(path string) error {
+	sd, err := windows.SecurityDescriptorFromString(controlFileACL)
+	if err != nil {
+		return fmt.Errorf("failed to build permissions: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("failed to build permissions: %w", err)
+	}
+	err = windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restrict permissions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package control
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// Kinds of activity.
+const (
+	OperationActivity = "operation" // OperationActivity is an upload, update or delete applied to a destination.
+	FullSyncActivity  = "fullSync"  // FullSyncActivity is a full sync cycle that compared a folder with a destination.
+	IncidentActivity  = "incident"  // IncidentActivity is a stalled component restarted by the watchdog.
+)
+
+// Activity is a single event of the running service, as streamed to clients.
+type Activity struct {
+	Time        time.Time `json:"time"`                  // Time is when the event happened.
+	Kind        string    `json:"kind"`                  // Kind is OperationActivity, FullSyncActivity or IncidentActivity.
+	Profile     string    `json:"profile"`               // Profile is the profile the event belongs to.
+	Destination string    `json:"destination,omitempty"` // Destination is the destination involved, if any.
+	Operation   string    `json:"operation,omitempty"`   // Operation is the kind of operation, or the component of an incident.
+	Path        string    `json:"path,omitempty"`        // Path is the object key of an operation.
+	Bytes       int64     `json:"bytes,omitempty"`       // Bytes is the number of bytes uploaded.
+	Took        float64   `json:"took,omitempty"`        // Took is how many seconds the operation or full sync cycle took.
+	Failed      bool      `json:"failed"`                // Failed is true for failed operations and full sync cycles, and for incidents.
+	Message     string    `json:"message,omitempty"`     // Message is the error or the problem found.
+}
+
+// ActivityFeed keeps the recent activity of the service and passes every new event on to the activity
+// streams of connected clients, one JSON line per event. It implements minisync.Observer.
+type ActivityFeed struct {
+	lines *LogHub
+}
+
+// NewActivityFeed returns an empty ActivityFeed.
+func NewActivityFeed() *ActivityFeed {
+	return &ActivityFeed{lines: NewLogHub()}
+}
+
+// Publish sends an event to every client, setting its time if it is not set.
+func (f *ActivityFeed) Publish(activity Activity) {
+	if activity.Time.IsZero() {
+		activity.Time = time.Now()
+	}
+	data, err := json.Marshal(activity)
+	if err != nil {
+		controlLog.Warn("Failed to encode activity", "error", err)
+		return
+	}
+	f.lines.Write(append(data, '\n'))
+}
+
+// Applied publishes an attempt of a destination to apply an operation.
+func (f *ActivityFeed) Applied(profile, destination string, op minisync.Operation, bytes int64, took time.Duration, err error) {
+	activity := Activity{Kind: OperationActivity, Profile: profile, Destination: destination, Operation: string(op.Kind),
+		Path: op.RelativePath, Bytes: bytes, Took: took.Seconds()}
+	if err != nil {
+		activity.Failed, activity.Message = true, err.Error()
+	}
+	f.Publish(activity)
+}
+
+// FullSync publishes a full sync cycle of a destination that took took and failed with err, if not nil.
+func (f *ActivityFeed) FullSync(profile, destination string, took time.Duration, err error) {
+	activity := Activity{Kind: FullSyncActivity, Profile: profile, Destination: destination, Took: took.Seconds()}
+	if err != nil {
+		activity.Failed, activity.Message = true, err.Error()
+	}
+	f.Publish(activity)
+}
+
+// Incident publishes a stalled component restarted by the watchdog.
+func (f *ActivityFeed) Incident(incident Incident) {
+	f.Publish(Activity{Time: incident.Time, Kind: IncidentActivity, Profile: incident.Profile, Destination: incident.Destination,
+		Operation: incident.Component, Failed: true, Message: incident.Problem})
+}
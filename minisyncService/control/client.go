@@ -0,0 +1,168 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// requestTimeout bounds every request except log and activity streams.
+const requestTimeout = 10 * time.Second
+
+// Client calls the API of the running service.
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// Dial reads the control file the service published in logFolder and returns a client for its API. It
+// returns ErrNotRunning if there is no control file.
+func Dial(logFolder string) (*Client, error) {
+	data, err := os.ReadFile(filepath.Join(logFolder, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotRunning
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read control file: %w", err)
+	}
+
+	var e endpoint
+	err = json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control file: %w", err)
+	}
+	return &Client{base: "http://" + e.Address, token: e.Token, http: &http.Client{}}, nil
+}
+
+// Status returns the state of the service and of every destination.
+func (c *Client) Status() (*Status, error) {
+	var status Status
+	err := c.call(http.MethodGet, "/v1/status", nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Pause pauses syncing. Changes are still queued and applied on Resume.
+func (c *Client) Pause() error {
+	return c.call(http.MethodPost, "/v1/pause", nil, nil)
+}
+
+// Resume resumes syncing after Pause.
+func (c *Client) Resume() error {
+	return c.call(http.MethodPost, "/v1/resume", nil, nil)
+}
+
+// SyncNow starts a full sync cycle of the named profile, or of every profile if profile is empty.
+func (c *Client) SyncNow(profile string) error {
+	return c.call(http.MethodPost, "/v1/sync", url.Values{"profile": {profile}}, nil)
+}
+
+// Queue returns the operations waiting for a destination of a profile.
+func (c *Client) Queue(profile, destination string) ([]minisync.Operation, error) {
+	var queue []minisync.Operation
+	err := c.call(http.MethodGet, "/v1/queue", url.Values{"profile": {profile}, "destination": {destination}}, &queue)
+	return queue, err
+}
+
+// StreamLogs calls line with the recent lines of the service log and then with every new line, until ctx
+// is cancelled or the service stops.
+func (c *Client) StreamLogs(ctx context.Context, line func(string)) error {
+	response, err := c.do(ctx, http.MethodGet, "/v1/logs", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line(scanner.Text())
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// StreamActivity calls activity with the recent activity of the service and then with every new event,
+// until ctx is cancelled or the service stops.
+func (c *Client) StreamActivity(ctx context.Context, activity func(Activity)) error {
+	response, err := c.do(ctx, http.MethodGet, "/v1/activity", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		var event Activity
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			activity(event)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// call sends a request and decodes the JSON response into result, unless it is nil.
+func (c *Client) call(method, path string, query url.Values, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	response, err := c.do(ctx, method, path, query)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode control response: %w", err)
+	}
+	return nil
+}
+
+// do sends an authorized request and turns error responses into errors. A service that does not answer
+// is reported as ErrNotRunning, as its control file may be left over from a crash.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	target := c.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+		}
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("control request %s failed: %s", path, strings.TrimSpace(string(message)))
+	}
+	return response, nil
+}
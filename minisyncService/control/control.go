@@ -0,0 +1,71 @@
+// Package control is the local API between the MiniSync service and its clients such as the GUI. The
+// service listens on a random port of the loopback interface and writes the address together with a
+// random access token to a file in its log folder; clients read that file to connect. Every request must
+// carry the token, so only users who can read that file, the service's account and on Windows the
+// administrators, can control the service.
+package control
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// FileName is the name of the file in the log folder that tells clients where the API listens.
+const FileName = "MiniSyncControl.json"
+
+// ErrNotRunning is returned by Dial when the service is not running, or does not offer the API.
+var ErrNotRunning = errors.New("the MiniSync service is not running")
+
+// Service is the running sync engine as seen by the API.
+type Service interface {
+	// Status returns the state of the engine and of every destination.
+	Status() Status
+	// SetPaused pauses or resumes uploads, deletes and full sync cycles. Changes are still queued.
+	SetPaused(paused bool)
+	// SyncNow starts a full sync cycle of the named profile, or of every profile if name is empty.
+	SyncNow(profile string) error
+	// Queue returns the operations waiting for a destination of a profile.
+	Queue(profile, destination string) ([]minisync.Operation, error)
+}
+
+// Status is the state of the running service.
+type Status struct {
+	Started      time.Time                    `json:"started"`      // Started is when the service started.
+	Paused       bool                         `json:"paused"`       // Paused is true while syncing is paused.
+	Degraded     bool                         `json:"degraded"`     // Degraded is true while the watchdog finds stalled components or a restarted schedule has not shown progress.
+	Incidents    []Incident                   `json:"incidents"`    // Incidents are the most recent stalls found by the watchdog, newest first.
+	Profiles     []ProfileStatus              `json:"profiles"`     // Profiles is the status of every profile.
+	Destinations []minisync.DestinationStatus `json:"destinations"` // Destinations is the status of every destination of every profile.
+}
+
+// ProfileStatus is the state of a single profile.
+type ProfileStatus struct {
+	Name         string                 `json:"name"`         // Name is the name of the profile.
+	Watcher      minisync.WatcherStatus `json:"watcher"`      // Watcher is the health of the profile's folder monitor.
+	NextFullSync time.Time              `json:"nextFullSync"` // NextFullSync is when the next full sync cycle is due.
+}
+
+// Components the watchdog watches.
+const (
+	WatcherComponent   = "watcher"   // WatcherComponent is the folder monitor of a profile.
+	SchedulerComponent = "scheduler" // SchedulerComponent is the full sync schedule of a profile.
+	WorkerComponent    = "worker"    // WorkerComponent is the worker of a destination.
+)
+
+// Incident is a stalled component found and restarted by the watchdog.
+type Incident struct {
+	Time        time.Time `json:"time"`                  // Time is when the stall was found.
+	Component   string    `json:"component"`             // Component is the watcher, the scheduler or a worker.
+	Profile     string    `json:"profile"`               // Profile is the profile the component belongs to.
+	Destination string    `json:"destination,omitempty"` // Destination is the destination of a worker.
+	Problem     string    `json:"problem"`               // Problem describes what the watchdog found.
+}
+
+// endpoint is the content of the control file.
+type endpoint struct {
+	Address string `json:"address"` // Address is the host:port the API listens on.
+	Token   string `json:"token"`   // Token must be sent as a bearer token with every request.
+	PID     int    `json:"pid"`     // PID is the process ID of the service.
+}
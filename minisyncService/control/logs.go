@@ -0,0 +1,65 @@
+package control
+
+import (
+	"strings"
+	"sync"
+)
+
+// logBacklog is how many recent log lines a new log stream starts with.
+const logBacklog = 200
+
+// LogHub is an io.Writer for the service log that keeps the most recent lines and passes every new line
+// on to the log streams of connected clients. A client that cannot keep up misses lines rather than
+// holding up the service.
+type LogHub struct {
+	mu          sync.Mutex
+	partial     string
+	recent      []string
+	subscribers map[chan string]bool
+}
+
+// NewLogHub returns an empty LogHub.
+func NewLogHub() *LogHub {
+	return &LogHub{subscribers: map[chan string]bool{}}
+}
+
+// Write splits p into lines and publishes every complete line.
+func (h *LogHub) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lines := strings.Split(h.partial+string(p), "\n")
+	h.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		h.recent = append(h.recent, line)
+		if len(h.recent) > logBacklog {
+			h.recent = h.recent[len(h.recent)-logBacklog:]
+		}
+		for subscriber := range h.subscribers {
+			select {
+			case subscriber <- line:
+			default:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Subscribe returns the recent lines and a channel that receives every later line. cancel stops the
+// subscription and closes the channel.
+func (h *LogHub) Subscribe() (recent []string, lines <-chan string, cancel func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscriber := make(chan string, logBacklog)
+	h.subscribers[subscriber] = true
+	cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.subscribers[subscriber] {
+			delete(h.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return append([]string(nil), h.recent...), subscriber, cancel
+}
@@ -0,0 +1,207 @@
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mwiater/minisync/minisyncService/logging"
+)
+
+// controlLog is the log of the control API.
+var controlLog = logging.For(logging.Control)
+
+// Server serves the API of a running service.
+type Server struct {
+	service  Service
+	logs     *LogHub
+	activity *ActivityFeed
+	token    string
+	http     *http.Server
+
+	mu       sync.Mutex
+	listener net.Listener
+	file     string
+}
+
+// Listen starts the API for service on a random loopback port and publishes its address and a new token
+// in logFolder. logs is streamed to clients that ask for the log, and activity to clients that ask for the
+// activity.
+func Listen(logFolder string, service Service, logs *LogHub, activity *ActivityFeed) (*Server, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control token: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for control requests: %w", err)
+	}
+
+	s := &Server{service: service, logs: logs, activity: activity, token: hex.EncodeToString(secret), listener: listener}
+	s.http = &http.Server{Handler: s.authorize(s.routes())}
+	err = s.Publish(logFolder)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	go func() {
+		err := s.http.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			controlLog.Error("Control API stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// Publish writes the address and token to the control file in logFolder and removes the file from the
+// previous log folder. The file is readable only by the service's user, and on Windows also by LocalSystem
+// and the Administrators group.
+func (s *Server) Publish(logFolder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(endpoint{Address: s.listener.Addr().String(), Token: s.token, PID: os.Getpid()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode control file: %w", err)
+	}
+
+	file := filepath.Join(logFolder, FileName)
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err == nil {
+		err = restrictAccess(tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write control file: %w", err)
+	}
+
+	if s.file != "" && s.file != file {
+		os.Remove(s.file)
+	}
+	s.file = file
+	return nil
+}
+
+// Close stops the API, ending open log and activity streams, and removes the control file.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	os.Remove(s.file)
+	return s.http.Close()
+}
+
+// routes returns the handler of every API request.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.service.Status())
+	}))
+	mux.HandleFunc("/v1/pause", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		s.service.SetPaused(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/v1/resume", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		s.service.SetPaused(false)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/v1/sync", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		err := s.service.SyncNow(r.URL.Query().Get("profile"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	mux.HandleFunc("/v1/queue", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		queue, err := s.service.Queue(r.URL.Query().Get("profile"), r.URL.Query().Get("destination"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, queue)
+	}))
+	mux.HandleFunc("/v1/logs", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		stream(w, r, s.logs, "text/plain; charset=utf-8")
+	}))
+	mux.HandleFunc("/v1/activity", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		stream(w, r, s.activity.lines, "application/x-ndjson")
+	}))
+	return mux
+}
+
+// only rejects requests with a method other than method.
+func only(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// authorize rejects requests without the bearer token.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "invalid control token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stream sends the recent lines of hub followed by every new line until the client disconnects.
+func stream(w http.ResponseWriter, r *http.Request, hub *LogHub, contentType string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	recent, lines, cancel := hub.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", contentType)
+	for _, line := range recent {
+		fmt.Fprintln(w, line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			fmt.Fprintln(w, line)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeJSON sends value as a JSON response.
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		controlLog.Warn("Failed to send control response", "error", err)
+	}
+}
@@ -0,0 +1,241 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// fakeService records the calls of the API.
+type fakeService struct {
+	mu     sync.Mutex
+	paused bool
+	synced []string
+}
+
+// Status returns the paused state.
+func (s *fakeService) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{Paused: s.paused, Profiles: []ProfileStatus{{Name: "default"}}}
+}
+
+// SetPaused records paused.
+func (s *fakeService) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// SyncNow records profile and fails for unknown profiles.
+func (s *fakeService) SyncNow(profile string) error {
+	if profile != "" && profile != "default" {
+		return errors.New("unknown profile " + profile)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced = append(s.synced, profile)
+	return nil
+}
+
+// Queue returns a single upload for the primary destination of the default profile.
+func (s *fakeService) Queue(profile, destination string) ([]minisync.Operation, error) {
+	if profile != "default" || destination != "primary" {
+		return nil, errors.New("unknown destination " + destination)
+	}
+	return []minisync.Operation{{Kind: minisync.OpUpload, RelativePath: "a.txt"}}, nil
+}
+
+// listen starts a server for service in a temporary log folder and returns it with the folder.
+func listen(t *testing.T, service Service, activity *ActivityFeed) (*Server, string) {
+	t.Helper()
+	logFolder := t.TempDir()
+	s, err := Listen(logFolder, service, NewLogHub(), activity)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, logFolder
+}
+
+func TestServerRequests(t *testing.T) {
+	service := &fakeService{}
+	_, logFolder := listen(t, service, NewActivityFeed())
+	client, err := Dial(logFolder)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	if err := client.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !status.Paused || len(status.Profiles) != 1 || status.Profiles[0].Name != "default" {
+		t.Errorf("Status() after Pause() = %+v, want the paused default profile", status)
+	}
+	if err := client.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if status, err := client.Status(); err != nil || status.Paused {
+		t.Errorf("Status() after Resume() = %+v, %v, want it resumed", status, err)
+	}
+
+	if err := client.SyncNow(""); err != nil {
+		t.Errorf("SyncNow() error = %v", err)
+	}
+	if err := client.SyncNow("photos"); err == nil || !strings.Contains(err.Error(), "unknown profile photos") {
+		t.Errorf("SyncNow() of an unknown profile error = %v, want the service's error", err)
+	}
+	if !reflect.DeepEqual(service.synced, []string{""}) {
+		t.Errorf("synced profiles = %q, want only the sync of every profile", service.synced)
+	}
+
+	queue, err := client.Queue("default", "primary")
+	if err != nil || len(queue) != 1 || queue[0].RelativePath != "a.txt" {
+		t.Errorf("Queue() = %+v, %v, want the upload of a.txt", queue, err)
+	}
+	if _, err := client.Queue("default", "offsite"); err == nil {
+		t.Errorf("Queue() of an unknown destination succeeded")
+	}
+}
+
+func TestServerRejectsUnauthorizedRequests(t *testing.T) {
+	s, _ := listen(t, &fakeService{}, NewActivityFeed())
+	url := "http://" + s.listener.Addr().String() + "/v1/status"
+
+	for _, authorization := range []string{"", "Bearer wrong", s.token, "Bearer " + s.token + "x"} {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("request error = %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("request with authorization %q = %s, want 401", authorization, response.Status)
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+s.token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed || response.Header.Get("Allow") != http.MethodGet {
+		t.Errorf("POST /v1/status = %s, want 405 allowing GET", response.Status)
+	}
+}
+
+func TestServerPublish(t *testing.T) {
+	s, logFolder := listen(t, &fakeService{}, NewActivityFeed())
+	file := filepath.Join(logFolder, FileName)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("control file not published: %v", err)
+	}
+	var e endpoint
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("control file is not JSON: %v", err)
+	}
+	if e.Address != s.listener.Addr().String() || e.Token != s.token || e.PID != os.Getpid() {
+		t.Errorf("control file = %+v, want the address, token and PID of the server", e)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("control file mode = %v, want 0600", mode)
+		}
+	}
+
+	moved := t.TempDir()
+	if err := s.Publish(moved); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("control file left in the previous log folder: %v", err)
+	}
+	if _, err := Dial(moved); err != nil {
+		t.Errorf("Dial() of the new log folder error = %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := Dial(moved); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Dial() after Close() error = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestClientStreamsActivity(t *testing.T) {
+	activity := NewActivityFeed()
+	activity.Publish(Activity{Kind: FullSyncActivity, Profile: "default"})
+	_, logFolder := listen(t, &fakeService{}, activity)
+	client, err := Dial(logFolder)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []Activity
+	err = client.StreamActivity(ctx, func(event Activity) {
+		events = append(events, event)
+		if len(events) == 1 {
+			activity.Applied("default", "primary", minisync.Operation{Kind: minisync.OpDelete, RelativePath: "a.txt"}, 0, 0, errors.New("denied"))
+		} else {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("StreamActivity() error = %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != FullSyncActivity || events[1].Path != "a.txt" || !events[1].Failed || events[1].Message != "denied" {
+		t.Errorf("streamed activity = %+v, want the recent full sync and the new failed delete", events)
+	}
+}
+
+func TestDialWithoutService(t *testing.T) {
+	if _, err := Dial(t.TempDir()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Dial() without a control file error = %v, want ErrNotRunning", err)
+	}
+
+	logFolder := t.TempDir()
+	data := []byte(`{"address": "127.0.0.1:1", "token": "stale"}`)
+	if err := os.WriteFile(filepath.Join(logFolder, FileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial(logFolder)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if _, err := client.Status(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Status() of a stale control file error = %v, want ErrNotRunning", err)
+	}
+}
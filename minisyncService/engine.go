@@ -0,0 +1,951 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/control"
+	"github.com/mwiater/minisync/minisyncService/logging"
+	"github.com/mwiater/minisync/minisyncService/metrics"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// reloadDelay is how long the configuration file must be quiet before it is reloaded, so that one save
+// triggers one reload.
+const reloadDelay = time.Second
+
+// Watchdog timing. A full sync schedule beats at least every heartbeatInterval while it waits, and for
+// every file while it runs a cycle; it, or a destination worker whose operation in flight uploads nothing,
+// counts as stalled after stallTimeout.
+const (
+	watchdogInterval  = time.Minute
+	heartbeatInterval = time.Minute
+	stallTimeout      = 10 * time.Minute
+)
+
+// recentIncidents is the number of watchdog incidents kept for the status.
+const recentIncidents = 20
+
+// serviceLog is the log of the engine and the service around it.
+var serviceLog = logging.For(logging.Service)
+
+// cycleFunc runs a full sync cycle of a profile against one of its destinations until ctx is cancelled,
+// logging to log, which carries the profile, the destination and the ID of the cycle. It calls beat as it
+// makes progress, so that the watchdog can tell a long cycle from a stuck one.
+type cycleFunc func(ctx context.Context, log *slog.Logger, beat func(), profile config.Profile, destination *minisync.Destination) error
+
+// engine is the running state of the service: the log file, the status writer, the control API, the
+// metrics endpoint and a runner for every profile. apply brings it in line with a changed configuration, touching only what
+// changed, so that the queues of unchanged destinations survive a reload.
+type engine struct {
+	mu         sync.Mutex
+	applying   sync.Mutex // applying serialises apply and retry, which connect to destinations without holding mu.
+	cfg        *config.Config
+	console    bool // console keeps the log on standard output instead of the log file.
+	logFile    *logging.File
+	logs       *control.LogHub
+	activity   *control.ActivityFeed
+	control    *control.Server
+	metrics    *metrics.Metrics
+	metricsAPI *metrics.Server
+	stopStatus context.CancelFunc
+	runners    map[string]*runner
+	cycle      cycleFunc
+	paused     bool
+	started    time.Time
+	degraded   bool               // degraded is set while the last watchdog check found a stalled component.
+	incidents  []control.Incident // incidents are the most recent stalls found by the watchdog, newest first.
+	done       chan struct{}      // done is closed once the engine has stopped.
+}
+
+// runner runs a single profile with its own replicator, folder monitor and full sync schedule, so that
+// profiles never share queues or state.
+type runner struct {
+	mu            sync.Mutex
+	profile       config.Profile
+	replicator    *minisync.Replicator
+	history       *minisync.FileHistory
+	stopMonitor   context.CancelFunc
+	health        *minisync.WatcherHealth
+	stopCycles    context.CancelFunc
+	cycles        uint64    // cycles is the generation of the current full sync schedule, counted up by startCycles.
+	cyclesStarted time.Time // cyclesStarted is when the current full sync schedule was started.
+	restarted     bool      // restarted is set once the watchdog restarted the schedule, until the new one beats the heartbeat.
+	cycle         cycleFunc
+	heartbeat     minisync.Heartbeat // heartbeat is beaten by the current full sync schedule.
+	failed        map[string]bool    // failed holds the destinations whose settings are not applied because they failed to connect.
+	metrics       *metrics.Metrics
+	activity      *control.ActivityFeed
+	reschedule    chan struct{}
+	trigger       chan struct{}
+	nextRun       time.Time
+	paused        bool
+}
+
+// startEngine opens the log file, unless console is set, and starts a runner for every profile. cycle is
+// called for every destination of a profile on the profile's schedule.
+func startEngine(cfg *config.Config, console bool, cycle cycleFunc) (*engine, error) {
+	e := &engine{cfg: cfg, console: console, logs: control.NewLogHub(), activity: control.NewActivityFeed(), runners: map[string]*runner{}, cycle: cycle, started: time.Now(), done: make(chan struct{})}
+	e.metrics = metrics.New(e.Status)
+
+	err := e.openLog(cfg.LogFolder, cfg.Logging)
+	if err != nil {
+		return nil, err
+	}
+	serviceLog.Info("Starting MiniSync service")
+
+	for _, p := range cfg.Profiles {
+		clients, err := connect(p, p.AllDestinations())
+		var r *runner
+		if err == nil {
+			r, err = startRunner(cfg, p, clients, cycle, e.metrics, e.activity)
+		}
+		if err != nil {
+			closeClients(clients)
+			e.stop()
+			return nil, err
+		}
+		e.runners[p.Name] = r
+	}
+
+	e.startStatus(cfg.LogFolder)
+
+	server, err := control.Listen(cfg.LogFolder, e, e.logs, e.activity)
+	if err != nil {
+		serviceLog.Warn("The control API is not available", "error", err)
+	}
+	e.control = server
+	e.serveMetrics(cfg.MetricsAddress, cfg.MetricsPort)
+	return e, nil
+}
+
+// apply reconfigures the running engine. A new log folder reopens the log, added and removed profiles
+// are started and stopped, and every other profile applies its own changes. Destinations are connected
+// before the engine is locked and removed profiles and destinations are stopped once it is unlocked, so that
+// neither a slow endpoint nor waiting for an operation in flight holds up status requests or the watchdog.
+func (e *engine) apply(cfg *config.Config) {
+	e.applying.Lock()
+	defer e.applying.Unlock()
+	e.update(cfg)
+}
+
+// retry applies the current configuration again if a profile failed to start or a destination failed to
+// connect when it was applied, so that the watchdog retries them until they connect.
+func (e *engine) retry() {
+	e.applying.Lock()
+	defer e.applying.Unlock()
+	e.mu.Lock()
+	cfg, pending := e.cfg, e.pending()
+	e.mu.Unlock()
+	if pending {
+		serviceLog.Info("Retrying profiles and destinations that failed to connect")
+		e.update(cfg)
+	}
+}
+
+// pending reports whether a profile of the configuration is not running or has destinations whose settings
+// are not applied. e.mu must be held.
+func (e *engine) pending() bool {
+	for _, p := range e.cfg.Profiles {
+		r, ok := e.runners[p.Name]
+		if !ok {
+			return true
+		}
+		r.mu.Lock()
+		failed := len(r.failed) > 0
+		r.mu.Unlock()
+		if failed {
+			return true
+		}
+	}
+	return false
+}
+
+// update applies cfg for apply and retry: it connects the destinations that need a new client, applies cfg
+// with them, closes the clients left unused and stops what was removed.
+func (e *engine) update(cfg *config.Config) {
+	conns := e.connect(cfg)
+	runners, destinations := e.reconfigure(cfg, conns)
+	for _, clients := range conns.clients {
+		closeClients(clients)
+	}
+	for _, r := range runners {
+		r.stop()
+	}
+	for _, destination := range destinations {
+		destination.Stop()
+		destination.Client().Close()
+	}
+}
+
+// connections holds the clients connected for a configuration before it is applied, by profile and
+// destination name, and the error of each profile that failed to connect a destination. Applying the
+// configuration takes the clients it uses out of the maps.
+type connections struct {
+	clients map[string]map[string]*minisync.MinioClient
+	errs    map[string]error
+}
+
+// connect connects, without holding the engine's lock, every destination of cfg that applying it needs a new
+// client for: all destinations of profiles that are not running yet, and the destinations runner.changed
+// returns for the others.
+func (e *engine) connect(cfg *config.Config) connections {
+	conns := connections{clients: map[string]map[string]*minisync.MinioClient{}, errs: map[string]error{}}
+	for _, p := range cfg.Profiles {
+		e.mu.Lock()
+		r := e.runners[p.Name]
+		e.mu.Unlock()
+
+		ds := p.AllDestinations()
+		if r != nil {
+			r.mu.Lock()
+			ds = r.changed(p)
+			r.mu.Unlock()
+		}
+		conns.clients[p.Name], conns.errs[p.Name] = connect(p, ds)
+	}
+	return conns
+}
+
+// connect creates a client for each of the destinations ds of profile p. It returns the clients by
+// destination name and an error for the first destination that failed to connect; the others are still
+// connected.
+func connect(p config.Profile, ds []minisync.DestinationConfig) (map[string]*minisync.MinioClient, error) {
+	clients := map[string]*minisync.MinioClient{}
+	var first error
+	for _, d := range ds {
+		serviceLog.Info("Connecting to destination", "profile", p.Name, "destination", d.Name, "target", d.String())
+		client, err := p.NewMinioClient(d, p.ObjectLock)
+		if err != nil {
+			serviceLog.Error("Failed to connect to destination", "profile", p.Name, "destination", d.Name, "error", err)
+			if first == nil {
+				first = fmt.Errorf("failed to create Minio client for destination %s of profile %s: %w", d.Name, p.Name, err)
+			}
+			continue
+		}
+		clients[d.Name] = client
+	}
+	return clients, first
+}
+
+// closeClients closes every client in clients.
+func closeClients(clients map[string]*minisync.MinioClient) {
+	for _, client := range clients {
+		client.Close()
+	}
+}
+
+// reconfigure applies cfg to the engine for update with the clients connected for it, and returns the
+// runners of removed profiles and the destinations removed from the profiles that are kept, which the caller
+// must stop.
+func (e *engine) reconfigure(cfg *config.Config, conns connections) ([]*runner, []*minisync.Destination) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	previous := e.cfg
+
+	if cfg.LogFolder != previous.LogFolder {
+		err := e.openLog(cfg.LogFolder, cfg.Logging)
+		if err != nil {
+			serviceLog.Error("Failed to switch log folder, keeping the previous one", "folder", cfg.LogFolder, "previous", previous.LogFolder, "error", err)
+			cfg.LogFolder = previous.LogFolder
+		} else {
+			e.startStatus(cfg.LogFolder)
+			for name, r := range e.runners {
+				stateFolder, err := cfg.StateFolder(name)
+				if err != nil {
+					serviceLog.Error("Failed to move the file history, keeping the previous folder", "profile", name, "error", err)
+					continue
+				}
+				r.history.SetFolder(stateFolder)
+			}
+			if e.control != nil {
+				err = e.control.Publish(cfg.LogFolder)
+				if err != nil {
+					serviceLog.Error("Failed to move the control file", "folder", cfg.LogFolder, "error", err)
+				}
+			}
+		}
+	} else if !reflect.DeepEqual(cfg.Logging, previous.Logging) {
+		serviceLog.Info("Applying log settings")
+		err := e.configureLog(cfg.Logging)
+		if err != nil {
+			serviceLog.Error("Failed to apply log settings", "error", err)
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.Logging, previous.Logging) {
+		for _, r := range e.runners {
+			r.history.SetLimits(cfg.Logging)
+		}
+	}
+
+	if cfg.MetricsAddress != previous.MetricsAddress || cfg.MetricsPort != previous.MetricsPort {
+		e.serveMetrics(cfg.MetricsAddress, cfg.MetricsPort)
+	}
+
+	var removed []*minisync.Destination
+	kept := map[string]bool{}
+	for _, p := range cfg.Profiles {
+		kept[p.Name] = true
+		if r, ok := e.runners[p.Name]; ok {
+			removed = append(removed, r.apply(p, conns.clients[p.Name])...)
+			continue
+		}
+
+		serviceLog.Info("Adding profile", "profile", p.Name)
+		err := conns.errs[p.Name]
+		var r *runner
+		if err == nil {
+			r, err = startRunner(cfg, p, conns.clients[p.Name], e.cycle, e.metrics, e.activity)
+		}
+		if err != nil {
+			serviceLog.Error("Failed to start profile, retrying on the next watchdog check", "profile", p.Name, "error", err)
+			continue
+		}
+		r.setPaused(e.paused)
+		e.runners[p.Name] = r
+	}
+
+	var stopped []*runner
+	for name, r := range e.runners {
+		if !kept[name] {
+			serviceLog.Info("Removing profile", "profile", name)
+			stopped = append(stopped, r)
+			delete(e.runners, name)
+		}
+	}
+
+	e.cfg = cfg
+	return stopped, removed
+}
+
+// stop stops every runner, the status writer, the control API and the metrics endpoint. Each destination cancels the
+// operation it is working on; queued operations are left to the next full sync cycle. The runners are stopped without
+// holding the engine's lock, so that the status stays available meanwhile.
+func (e *engine) stop() {
+	e.mu.Lock()
+	runners := make([]*runner, 0, len(e.runners))
+	for _, r := range e.runners {
+		runners = append(runners, r)
+	}
+	e.mu.Unlock()
+	for _, r := range runners {
+		r.stop()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopStatus != nil {
+		e.stopStatus()
+	}
+	if e.control != nil {
+		e.control.Close()
+	}
+	if e.metricsAPI != nil {
+		e.metricsAPI.Close()
+	}
+}
+
+// Status returns whether the engine is paused, the watcher health and schedule of every profile and the
+// status of every destination.
+func (e *engine) Status() control.Status {
+	destinations := e.status()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := control.Status{Started: e.started, Paused: e.paused, Degraded: e.degraded, Incidents: e.incidents, Destinations: destinations}
+	for _, p := range e.cfg.Profiles {
+		if r, ok := e.runners[p.Name]; ok {
+			status.Profiles = append(status.Profiles, control.ProfileStatus{Name: p.Name, Watcher: r.watcher(), NextFullSync: r.next()})
+		}
+	}
+	return status
+}
+
+// SetPaused pauses or resumes every profile. While paused, changes are queued but not applied and full
+// sync cycles are skipped.
+func (e *engine) SetPaused(paused bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if paused == e.paused {
+		return
+	}
+	if paused {
+		serviceLog.Info("Pausing sync")
+	} else {
+		serviceLog.Info("Resuming sync")
+	}
+	e.paused = paused
+	for _, r := range e.runners {
+		r.setPaused(paused)
+	}
+}
+
+// SyncNow starts a full sync cycle of the named profile, or of every profile if name is empty.
+func (e *engine) SyncNow(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.paused {
+		return fmt.Errorf("sync is paused")
+	}
+	if name == "" {
+		for _, r := range e.runners {
+			r.syncNow()
+		}
+		return nil
+	}
+	r, ok := e.runners[name]
+	if !ok {
+		return fmt.Errorf("there is no profile named %q", name)
+	}
+	r.syncNow()
+	return nil
+}
+
+// Queue returns the operations waiting for the named destination of the named profile.
+func (e *engine) Queue(name, destination string) ([]minisync.Operation, error) {
+	e.mu.Lock()
+	r, ok := e.runners[name]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("there is no profile named %q", name)
+	}
+	d := r.replicator.Destination(destination)
+	if d == nil {
+		return nil, fmt.Errorf("profile %s has no destination named %q", name, destination)
+	}
+	return d.Queue(), nil
+}
+
+// checkLiveness looks for a stopped folder monitor, a stuck full sync schedule or a stuck destination
+// worker in every profile, restarts what it finds, and records an incident for each. The engine is marked
+// degraded until a check finds nothing and every restarted full sync schedule has beaten its heartbeat. It
+// returns the incidents found.
+func (e *engine) checkLiveness() []control.Incident {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var found []control.Incident
+	recovering := false
+	for _, p := range e.cfg.Profiles {
+		if r, ok := e.runners[p.Name]; ok {
+			incidents, restarting := r.checkLiveness()
+			found = append(found, incidents...)
+			recovering = recovering || restarting
+		}
+	}
+	for _, incident := range found {
+		serviceLog.Warn("Watchdog restarted a stalled component", "component", incident.Component, "profile", incident.Profile, "destination", incident.Destination, "problem", incident.Problem)
+		e.metrics.Restarted(incident.Profile, incident.Component)
+		e.activity.Incident(incident)
+	}
+
+	e.degraded = len(found) > 0 || recovering
+	if len(found) > 0 {
+		incidents := append(append([]control.Incident{}, found...), e.incidents...)
+		if len(incidents) > recentIncidents {
+			incidents = incidents[:recentIncidents]
+		}
+		e.incidents = incidents
+	}
+	return found
+}
+
+// status returns the status of the destinations of every profile.
+func (e *engine) status() []minisync.DestinationStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var statuses []minisync.DestinationStatus
+	for _, p := range e.cfg.Profiles {
+		if r, ok := e.runners[p.Name]; ok {
+			next := r.next()
+			for _, status := range r.replicator.Status() {
+				status.NextFullSync = next
+				statuses = append(statuses, status)
+			}
+		}
+	}
+	return statuses
+}
+
+// openLog directs the log to the service log file in logFolder, rotated as settings say, and closes the
+// previous log file. On the console the log stays on standard output.
+func (e *engine) openLog(logFolder string, settings logging.Settings) error {
+	previous := e.logFile
+	if !e.console {
+		logFile, err := logging.OpenFile(filepath.Join(logFolder, config.LogFileName), settings)
+		if err != nil {
+			return err
+		}
+		e.logFile = logFile
+	}
+
+	err := e.configureLog(settings)
+	if err != nil {
+		if previous != e.logFile {
+			e.logFile.Close()
+			e.logFile = previous
+		}
+		return err
+	}
+	if previous != nil && previous != e.logFile {
+		previous.Close()
+	}
+	return nil
+}
+
+// configureLog applies the format, levels and rotation limits of settings to the open log. The log is
+// also sent to the control API's log stream.
+func (e *engine) configureLog(settings logging.Settings) error {
+	var out io.Writer = os.Stdout
+	if e.logFile != nil {
+		e.logFile.SetLimits(settings)
+		out = e.logFile
+	}
+	return logging.Configure(io.MultiWriter(out, e.logs), settings)
+}
+
+// serveMetrics (re)starts the metrics endpoint on port of address, or stops it if port is 0. An address
+// or port that cannot be used is logged and leaves the endpoint off, as metrics are not needed to sync.
+func (e *engine) serveMetrics(address string, port int) {
+	if e.metricsAPI != nil {
+		e.metricsAPI.Close()
+		e.metricsAPI = nil
+	}
+	if port == 0 {
+		return
+	}
+	server, err := e.metrics.Serve(address, port)
+	if err != nil {
+		serviceLog.Warn("The metrics endpoint is not available", "address", address, "port", port, "error", err)
+		return
+	}
+	serviceLog.Info("Serving metrics", "url", server.URL())
+	e.metricsAPI = server
+}
+
+// startStatus (re)starts the status file writer for logFolder.
+func (e *engine) startStatus(logFolder string) {
+	if e.stopStatus != nil {
+		e.stopStatus()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stopStatus = cancel
+	go minisync.WriteStatusFile(ctx, logFolder, e.status)
+}
+
+// startRunner starts every destination of the profile with its client from clients, taking them out of the
+// map, starts monitoring its backup folder and schedules its full sync cycles. Operations and full sync
+// cycles are counted in m and published to activity, and operations are recorded in the profile's file
+// history in its state folder of cfg.
+func startRunner(cfg *config.Config, p config.Profile, clients map[string]*minisync.MinioClient, cycle cycleFunc, m *metrics.Metrics, activity *control.ActivityFeed) (*runner, error) {
+	for _, d := range p.AllDestinations() {
+		if clients[d.Name] == nil {
+			return nil, fmt.Errorf("destination %s of profile %s is not connected", d.Name, p.Name)
+		}
+	}
+	stateFolder, err := cfg.StateFolder(p.Name)
+	if err != nil {
+		return nil, err
+	}
+	history := minisync.NewFileHistory(stateFolder, "service", cfg.Logging)
+
+	replicator := minisync.NewReplicator()
+	replicator.Profile = p.Name
+	replicator.Observer = minisync.Observers{m, history, activity}
+	replicator.SetPolicy(p.Filter, p.Mode)
+
+	for _, d := range p.AllDestinations() {
+		replicator.Add(minisync.NewDestination(d.Name, clients[d.Name]))
+		delete(clients, d.Name)
+	}
+	replicator.Start()
+
+	r := &runner{profile: p, replicator: replicator, history: history, cycle: cycle, metrics: m, activity: activity, reschedule: make(chan struct{}, 1), trigger: make(chan struct{}, 1)}
+	r.startMonitor(p.BackupFolder)
+	r.startCycles(p.SyncOnStart)
+	return r, nil
+}
+
+// apply reconfigures the running profile with the clients connected for the destinations changed returns,
+// taking the ones it uses out of clients. A new backup folder restarts the monitor, added destinations are
+// started, and destinations whose endpoints, bucket or credentials changed switch to their new client while
+// keeping their queue. A destination without a client failed to connect: it keeps its previous client, or is
+// not added yet, and is recorded in failed so that changed returns it again. Removed destinations are
+// returned for the caller to stop and close once it holds no lock.
+func (r *runner) apply(p config.Profile, clients map[string]*minisync.MinioClient) []*minisync.Destination {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous := r.profile
+
+	failed := map[string]bool{}
+	for _, d := range r.changed(p) {
+		destination := r.replicator.Destination(d.Name)
+		client := clients[d.Name]
+		if client == nil {
+			serviceLog.Warn("Destination settings not applied, retrying on the next watchdog check", "profile", p.Name, "destination", d.Name)
+			failed[d.Name] = true
+			continue
+		}
+		delete(clients, d.Name)
+		if destination == nil {
+			serviceLog.Info("Adding destination", "profile", p.Name, "destination", d.Name, "target", d.String())
+			r.replicator.Add(minisync.NewDestination(d.Name, client))
+		} else {
+			serviceLog.Info("Reconnecting destination", "profile", p.Name, "destination", d.Name, "target", d.String())
+			destination.SetClient(client).Close()
+		}
+	}
+	r.failed = failed
+
+	kept := map[string]bool{}
+	for _, d := range p.AllDestinations() {
+		kept[d.Name] = true
+	}
+	var removed []*minisync.Destination
+	for _, destination := range r.replicator.Destinations() {
+		if !kept[destination.Name] {
+			serviceLog.Info("Removing destination", "profile", p.Name, "destination", destination.Name)
+			removed = append(removed, r.replicator.Remove(destination.Name))
+		}
+	}
+
+	if !reflect.DeepEqual(p.Filter, previous.Filter) || p.Mode != previous.Mode {
+		serviceLog.Info("Sync policy changed", "profile", p.Name, "mode", p.Mode, "include", p.Filter.Include, "exclude", p.Filter.Exclude)
+		r.replicator.SetPolicy(p.Filter, p.Mode)
+	}
+
+	if p.BackupFolder != previous.BackupFolder {
+		serviceLog.Info("Backup folder changed", "profile", p.Name, "folder", p.BackupFolder, "previous", previous.BackupFolder)
+		r.startMonitor(p.BackupFolder)
+	}
+
+	r.profile = p
+
+	if p.Schedule != previous.Schedule || p.BackupFrequencySeconds != previous.BackupFrequencySeconds {
+		if p.Schedule != "" {
+			serviceLog.Info("Full sync schedule changed", "profile", p.Name, "schedule", p.Schedule)
+		} else {
+			serviceLog.Info("Full sync interval changed", "profile", p.Name, "seconds", p.BackupFrequencySeconds)
+		}
+		// A reschedule that runFullSync has not picked up yet already covers this one.
+		select {
+		case r.reschedule <- struct{}{}:
+		default:
+		}
+	}
+	return removed
+}
+
+// changed returns the destinations of p that need a new client to apply p: new ones, those whose settings
+// changed or failed to connect before, and all of them if the endpoint strategy or the Object Lock settings
+// changed. r.mu must be held.
+func (r *runner) changed(p config.Profile) []minisync.DestinationConfig {
+	previous := r.profile
+	reconnectAll := p.EndpointStrategy != previous.EndpointStrategy || !reflect.DeepEqual(p.ObjectLock, previous.ObjectLock)
+	configured := map[string]minisync.DestinationConfig{}
+	for _, d := range previous.AllDestinations() {
+		configured[d.Name] = d
+	}
+
+	var changed []minisync.DestinationConfig
+	for _, d := range p.AllDestinations() {
+		if reconnectAll || r.failed[d.Name] || r.replicator.Destination(d.Name) == nil || !reflect.DeepEqual(configured[d.Name], d) {
+			changed = append(changed, d)
+		}
+	}
+	return changed
+}
+
+// stop stops the monitor, the full sync schedule and every destination of the profile. The destinations are
+// stopped without holding the runner's lock, which the watchdog and status requests need.
+func (r *runner) stop() {
+	r.mu.Lock()
+	r.stopMonitor()
+	r.stopCycles()
+	r.mu.Unlock()
+
+	r.replicator.Stop()
+	for _, destination := range r.replicator.Destinations() {
+		destination.Client().Close()
+	}
+	r.history.Close()
+}
+
+// config returns the profile settings the runner is currently running with.
+func (r *runner) config() config.Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.profile
+}
+
+// setPaused pauses or resumes the profile's destinations and full sync cycles.
+func (r *runner) setPaused(paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = paused
+	r.replicator.SetPaused(paused)
+}
+
+// isPaused reports whether the profile is paused.
+func (r *runner) isPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused
+}
+
+// syncNow asks runFullSync to start a full sync cycle right away. A request that has not been picked up yet
+// already covers this one.
+func (r *runner) syncNow() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// next returns when the next full sync cycle is due, or the zero time while a cycle is running.
+func (r *runner) next() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nextRun
+}
+
+// setNext records when the next full sync cycle of the schedule of generation is due, unless a newer
+// schedule replaced it.
+func (r *runner) setNext(generation uint64, next time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation == r.cycles {
+		r.nextRun = next
+	}
+}
+
+// beat beats the heartbeat for the full sync schedule of generation, unless a newer schedule replaced it.
+func (r *runner) beat(generation uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation == r.cycles {
+		r.heartbeat.Beat()
+	}
+}
+
+// watcher returns the health of the folder monitor.
+func (r *runner) watcher() minisync.WatcherStatus {
+	r.mu.Lock()
+	health := r.health
+	r.mu.Unlock()
+	return health.Status()
+}
+
+// startMonitor (re)starts monitoring backupFolder, stopping the previous monitor.
+func (r *runner) startMonitor(backupFolder string) {
+	if r.stopMonitor != nil {
+		r.stopMonitor()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stopMonitor = cancel
+	health := &minisync.WatcherHealth{}
+	r.health = health
+	name := r.profile.Name
+	go func() {
+		err := minisync.MonitorDirectory(ctx, backupFolder, r.replicator, health)
+		if err != nil {
+			serviceLog.Error("Stopped monitoring", "profile", name, "folder", backupFolder, "error", err)
+		}
+	}()
+}
+
+// startCycles (re)starts the full sync schedule, cancelling the previous one without waiting for it, since a
+// cycle stuck in a call that ignores its context may never return. Each schedule runs as the generation it
+// was started with, and one that a newer schedule replaced no longer beats the heartbeat or records the next
+// run, so that it cannot pass for the new one while it winds down. With syncNow the first cycle runs right
+// away.
+func (r *runner) startCycles(syncNow bool) {
+	if r.stopCycles != nil {
+		r.stopCycles()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cycles++
+	r.stopCycles, r.cyclesStarted = cancel, time.Now()
+	go r.runFullSync(ctx, r.cycles, syncNow)
+}
+
+// checkLiveness restarts the folder monitor if it stopped, the full sync schedule if it has not beaten for
+// stallTimeout since it was started, and every destination worker whose operation in flight has made no
+// progress for as long. It returns an incident for each restart, and whether a full sync schedule the
+// watchdog restarted has not beaten the heartbeat yet.
+func (r *runner) checkLiveness() ([]control.Incident, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	name := r.profile.Name
+
+	var found []control.Incident
+	// A monitor that has not reported yet is still starting.
+	if watcher := r.health.Status(); !watcher.Watching && !watcher.Since.IsZero() {
+		problem := "folder monitor stopped"
+		if watcher.LastError != "" {
+			problem += ": " + watcher.LastError
+		}
+		r.startMonitor(r.profile.BackupFolder)
+		found = append(found, control.Incident{Time: now, Component: control.WatcherComponent, Profile: name, Problem: problem})
+	}
+
+	last := r.heartbeat.Last()
+	if !last.Before(r.cyclesStarted) {
+		r.restarted = false
+	} else {
+		last = r.cyclesStarted
+	}
+	if now.Sub(last) > stallTimeout {
+		r.startCycles(false)
+		r.restarted = true
+		found = append(found, control.Incident{Time: now, Component: control.SchedulerComponent, Profile: name,
+			Problem: fmt.Sprintf("full sync schedule made no progress for %s", now.Sub(last).Round(time.Second))})
+	}
+
+	for _, stall := range r.replicator.RestartStalled(stallTimeout) {
+		found = append(found, control.Incident{Time: now, Component: control.WorkerComponent, Profile: name, Destination: stall.Destination,
+			Problem: fmt.Sprintf("%s of %s made no progress for %s", stall.Operation.Kind, stall.Operation.RelativePath, now.Sub(stall.Since).Round(time.Second))})
+	}
+	return found, r.restarted
+}
+
+// runFullSync runs the full sync schedule of generation: a full sync cycle for every destination on the
+// profile's schedule, or at its backup frequency if it has none, until ctx is cancelled. With syncNow the
+// first cycle runs right away. It beats the runner's heartbeat at least every heartbeatInterval.
+func (r *runner) runFullSync(ctx context.Context, generation uint64, syncNow bool) {
+	if syncNow {
+		r.runCycle(ctx, generation)
+	}
+
+	beat := time.NewTicker(heartbeatInterval)
+	defer beat.Stop()
+	for ctx.Err() == nil {
+		r.beat(generation)
+		profile := r.config()
+		next := profile.NextRun(time.Now())
+		r.setNext(generation, next)
+		if !r.wait(ctx, generation, beat, time.NewTimer(time.Until(next))) {
+			return
+		}
+	}
+}
+
+// wait waits for the next full sync cycle of the schedule of generation to be due, triggered or
+// rescheduled, beating the heartbeat on every tick of beat, and runs the cycle unless it was rescheduled.
+// It returns false once ctx is cancelled.
+func (r *runner) wait(ctx context.Context, generation uint64, beat *time.Ticker, timer *time.Timer) bool {
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-beat.C:
+			r.beat(generation)
+		case <-r.reschedule:
+			return true
+		case <-r.trigger:
+			if ctx.Err() != nil {
+				// Leave the trigger to the schedule that replaced this one.
+				r.syncNow()
+				return false
+			}
+			r.runCycle(ctx, generation)
+			return true
+		case <-timer.C:
+			r.runCycle(ctx, generation)
+			return true
+		}
+	}
+}
+
+// runCycle runs a full sync cycle of the schedule of generation for every destination of the profile,
+// unless it is paused, and records its outcome in the destination's status.
+func (r *runner) runCycle(ctx context.Context, generation uint64) {
+	profile := r.config()
+	if r.isPaused() {
+		serviceLog.Info("Skipping full sync cycle while paused", "profile", profile.Name)
+		return
+	}
+	r.setNext(generation, time.Time{})
+	beat := func() { r.beat(generation) }
+	for _, destination := range r.replicator.Destinations() {
+		if ctx.Err() != nil {
+			return
+		}
+		started := time.Now()
+		log := logging.For(logging.FullSync).With("profile", profile.Name, "destination", destination.Name, "cycle", logging.NewID())
+		beat()
+		err := r.cycle(ctx, log, beat, profile, destination)
+		if ctx.Err() != nil {
+			log.Info("Full sync cycle cancelled")
+			return
+		}
+		took := time.Since(started)
+		destination.RecordFullSync(started, err)
+		r.metrics.FullSync(profile.Name, destination.Name, took, err)
+		r.activity.FullSync(profile.Name, destination.Name, took, err)
+	}
+}
+
+// watchConfig calls reload whenever the configuration file at path changes, until ctx is cancelled. The
+// folder is watched rather than the file, because Save replaces the file by renaming a temporary file over
+// it.
+func watchConfig(ctx context.Context, path string, reload func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration watcher: %w", err)
+	}
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch configuration folder: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		var timer *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !sameFile(event.Name, path) || event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				serviceLog.Warn("Configuration watcher error", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// sameFile reports whether a and b name the same path.
+func sameFile(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
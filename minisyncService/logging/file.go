@@ -0,0 +1,232 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation defaults for Settings left at zero.
+const (
+	defaultMaxSizeMB  = 10
+	defaultMaxAgeDays = 7
+	defaultKeepDays   = 30
+)
+
+// rotatedTimeFormat is the timestamp added to the name of a rotated log file.
+const rotatedTimeFormat = "2006-01-02T15-04-05"
+
+// firstTime finds the timestamp of the first record of a log file in either format.
+var firstTime = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+// File is a log file that is rotated once it grows beyond a maximum size or gets older than a maximum age.
+// The rotated file is renamed with the time of the rotation, compressed with gzip in the background, and
+// deleted once it is older than the retention period, unless the file is an archive. It is safe for
+// concurrent use.
+type File struct {
+	path     string
+	archive  bool // archive is set for a file opened with OpenArchive, whose rotated files are never deleted.
+	maxSize  int64
+	maxAge   time.Duration
+	keep     time.Duration
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	started  time.Time
+	rotating sync.WaitGroup
+}
+
+// OpenFile opens the log file at path for appending, with the rotation limits of settings.
+func OpenFile(path string, settings Settings) (*File, error) {
+	f := &File{path: path}
+	f.SetLimits(settings)
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenArchive opens the log file at path for appending like OpenFile, for records that must be kept, such
+// as an audit trail: its rotated files are compressed but never deleted, whatever the retention period of
+// settings.
+func OpenArchive(path string, settings Settings) (*File, error) {
+	f := &File{path: path, archive: true}
+	f.SetLimits(settings)
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetLimits applies the rotation limits of settings, using the defaults for limits that are not set.
+func (f *File) SetLimits(settings Settings) {
+	maxSize, maxAge, keep := settings.MaxSizeMB, settings.MaxAgeDays, settings.KeepDays
+	if maxSize == 0 {
+		maxSize = defaultMaxSizeMB
+	}
+	if maxAge == 0 {
+		maxAge = defaultMaxAgeDays
+	}
+	if keep == 0 {
+		keep = defaultKeepDays
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxSize = int64(maxSize) << 20
+	f.maxAge = time.Duration(maxAge) * 24 * time.Hour
+	f.keep = time.Duration(keep) * 24 * time.Hour
+}
+
+// Write appends p to the log file, first rotating it if it is full or too old.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || time.Since(f.started) > f.maxAge) {
+		err := f.rotate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %s: %v\n", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file and waits for rotated files to be compressed.
+func (f *File) Close() error {
+	f.mu.Lock()
+	err := f.file.Close()
+	f.mu.Unlock()
+	f.rotating.Wait()
+	return err
+}
+
+// open opens the log file and reads its size and the time of its first record, which the age of the file
+// is counted from.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.started = time.Now()
+	if f.size > 0 {
+		f.started = startedAt(f.path, info.ModTime())
+	}
+	return nil
+}
+
+// startedAt returns the time of the first record of the log file at path, or fallback if it has none.
+func startedAt(path string, fallback time.Time) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer file.Close()
+
+	line, _ := bufio.NewReader(io.LimitReader(file, 4096)).ReadString('\n')
+	if match := firstTime.FindString(line); match != "" {
+		if started, err := time.Parse(time.RFC3339Nano, match); err == nil {
+			return started
+		}
+	}
+	return fallback
+}
+
+// rotate renames the log file with the current time, opens a new one, and compresses the renamed file and,
+// unless the file is an archive, deletes the expired ones in the background.
+func (f *File) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(f.path)
+	rotated := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(rotatedTimeFormat) + ext
+	renameErr := os.Rename(f.path, rotated)
+
+	err = f.open()
+	if err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.rotating.Add(1)
+	go func(keep time.Duration) {
+		defer f.rotating.Done()
+		err := compress(rotated)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compress log file %s: %v\n", rotated, err)
+		}
+		if !f.archive {
+			f.prune(keep)
+		}
+	}(f.keep)
+	return nil
+}
+
+// compress replaces the file at path by a gzip-compressed copy with a .gz extension.
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
+
+// prune deletes the rotated log files that were last written more than keep ago.
+func (f *File) prune(keep time.Duration) {
+	ext := filepath.Ext(f.path)
+	rotated, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext + ".gz")
+	if err != nil {
+		return
+	}
+	for _, path := range rotated {
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) > keep {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotatedFiles returns the compressed rotated files of the log file at path.
+func rotatedFiles(t *testing.T, path string) []string {
+	t.Helper()
+	ext := filepath.Ext(path)
+	files, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// readGzip returns the decompressed contents of the file at path.
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s is not gzip-compressed: %v", path, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MiniSync.log")
+	f, err := OpenFile(path, Settings{MaxSizeMB: 1})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+
+	var written bytes.Buffer
+	line := strings.Repeat("x", 1000)
+	for i := 0; i < 1100; i++ {
+		record := fmt.Sprintf("time=%s n=%d %s\n", time.Now().Format(time.RFC3339), i, line)
+		written.WriteString(record)
+		if _, err := f.Write([]byte(record)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rotated := rotatedFiles(t, path)
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %q, want one", rotated)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) >= 1<<20 {
+		t.Errorf("current log file is %d bytes, want it rotated below 1 MB", len(current))
+	}
+	if got := readGzip(t, rotated[0]) + string(current); got != written.String() {
+		t.Errorf("rotated and current log files hold %d bytes, want the %d bytes written", len(got), written.Len())
+	}
+	if _, err := os.Stat(strings.TrimSuffix(rotated[0], ".gz")); !os.IsNotExist(err) {
+		t.Errorf("uncompressed rotated file left behind: %v", err)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MiniSync.log")
+	old := time.Now().Add(-8 * 24 * time.Hour).Format(time.RFC3339)
+	err := os.WriteFile(path, []byte("time="+old+" level=INFO msg=old\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFile(path, Settings{MaxAgeDays: 7})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if _, err := f.Write([]byte("level=INFO msg=new\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rotated := rotatedFiles(t, path)
+	if len(rotated) != 1 || !strings.Contains(readGzip(t, rotated[0]), "msg=old") {
+		t.Fatalf("rotated files = %q, want one holding the old record", rotated)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "level=INFO msg=new\n" {
+		t.Errorf("current log file = %q, want only the new record", current)
+	}
+}
+
+func TestFileKeepsRecentFileOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MiniSync.log")
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	err := os.WriteFile(path, []byte("time="+recent+" level=INFO msg=recent\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFile(path, Settings{})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if _, err := f.Write([]byte("level=INFO msg=new\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if rotated := rotatedFiles(t, path); len(rotated) != 0 {
+		t.Errorf("rotated files = %q, want none", rotated)
+	}
+}
+
+func TestFilePrunesExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "MiniSync.log")
+	expired := filepath.Join(dir, "MiniSync-2020-01-01T00-00-00.log.gz")
+	kept := filepath.Join(dir, "MiniSync-2020-02-01T00-00-00.log.gz")
+	other := filepath.Join(dir, "Other-2020-01-01T00-00-00.log.gz")
+	for _, file := range []string{expired, kept, other} {
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	longAgo := time.Now().Add(-40 * 24 * time.Hour)
+	for _, file := range []string{expired, other} {
+		if err := os.Chtimes(file, longAgo, longAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lately := time.Now().Add(-10 * 24 * time.Hour)
+	if err := os.Chtimes(kept, lately, lately); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFile(path, Settings{MaxSizeMB: 1, KeepDays: 30})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	record := []byte(strings.Repeat("x", 600<<10) + "\n")
+	for i := 0; i < 2; i++ {
+		if _, err := f.Write(record); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired rotated file not deleted: %v", err)
+	}
+	for _, file := range []string{kept, other} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s deleted, want it kept: %v", filepath.Base(file), err)
+		}
+	}
+	if rotated := rotatedFiles(t, path); len(rotated) != 2 {
+		t.Errorf("rotated files = %q, want the kept one and the new one", rotated)
+	}
+}
@@ -0,0 +1,221 @@
+// Package logging is the structured log of the MiniSync service. Every subsystem logs through its own
+// slog.Logger, returned by For, whose minimum level can be set separately. Configure directs all of them,
+// and the standard log package, to a single text or JSON handler; until it is called they write to the
+// default slog logger, so that the GUI, which shares the sync packages, logs as before.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Subsystems that log through For. Their levels can be set in Settings.Levels.
+const (
+	Service    = "service"    // Service is the service start-up, the configuration and the engine.
+	Monitor    = "monitor"    // Monitor is the folder watcher.
+	Replicator = "replicator" // Replicator is the per-destination queues and workers.
+	FullSync   = "fullsync"   // FullSync is the full sync cycles that compare the folder with the bucket.
+	MinIO      = "minio"      // MinIO is the MinIO clients.
+	Control    = "control"    // Control is the local control API.
+	Metrics    = "metrics"    // Metrics is the Prometheus metrics endpoint.
+)
+
+// Subsystems lists every subsystem that can be given its own level.
+var Subsystems = []string{Service, Monitor, Replicator, FullSync, MinIO, Control, Metrics}
+
+// Output formats.
+const (
+	TextFormat = "text" // TextFormat writes key=value lines.
+	JSONFormat = "json" // JSONFormat writes a JSON object per line.
+)
+
+// Settings configures the log. The zero value writes text lines at the info level and rotates the log
+// file at the default size and age.
+type Settings struct {
+	Format     string            `json:"format,omitempty"`     // Format is text (the default) or json.
+	Level      string            `json:"level,omitempty"`      // Level is the minimum level logged: debug, info (the default), warn or error.
+	Levels     map[string]string `json:"levels,omitempty"`     // Levels overrides Level for individual subsystems.
+	MaxSizeMB  int               `json:"maxSizeMB,omitempty"`  // MaxSizeMB is the size at which the log file is rotated, 10 MB by default.
+	MaxAgeDays int               `json:"maxAgeDays,omitempty"` // MaxAgeDays is the age at which the log file is rotated, 7 days by default.
+	KeepDays   int               `json:"keepDays,omitempty"`   // KeepDays is how long rotated, compressed log files are kept, 30 days by default.
+}
+
+// Validate checks the format, the levels and the subsystem names and returns a problem per setting,
+// keyed by the setting's JSON name.
+func (s Settings) Validate() map[string]string {
+	problems := map[string]string{}
+	if s.Format != "" && s.Format != TextFormat && s.Format != JSONFormat {
+		problems["format"] = fmt.Sprintf("must be %s or %s", TextFormat, JSONFormat)
+	}
+	if _, err := ParseLevel(s.Level); err != nil {
+		problems["level"] = err.Error()
+	}
+	for subsystem, level := range s.Levels {
+		if !isSubsystem(subsystem) {
+			problems["levels."+subsystem] = fmt.Sprintf("is not a subsystem, use one of %s", strings.Join(Subsystems, ", "))
+		} else if _, err := ParseLevel(level); err != nil {
+			problems["levels."+subsystem] = err.Error()
+		}
+	}
+	if s.MaxSizeMB < 0 {
+		problems["maxSizeMB"] = "must not be negative"
+	}
+	if s.MaxAgeDays < 0 {
+		problems["maxAgeDays"] = "must not be negative"
+	}
+	if s.KeepDays < 0 {
+		problems["keepDays"] = "must not be negative"
+	}
+	return problems
+}
+
+// ParseLevel parses debug, info, warn or error. An empty level is info.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown level %q, use debug, info, warn or error", level)
+}
+
+// isSubsystem reports whether name is one of Subsystems.
+func isSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if subsystem == name {
+			return true
+		}
+	}
+	return false
+}
+
+// state is the handler and levels set by Configure, shared by every logger returned by For.
+var state struct {
+	mu         sync.RWMutex
+	configured bool
+	handler    slog.Handler
+	level      slog.Level
+	levels     map[string]slog.Level
+}
+
+// Configure writes the log to w in the format of settings, and applies its levels to every subsystem. The
+// standard log package and the default slog logger are redirected to the same output. Configure can be
+// called again to apply changed settings; loggers returned by For before follow the change.
+func Configure(w io.Writer, settings Settings) error {
+	level, err := ParseLevel(settings.Level)
+	if err != nil {
+		return err
+	}
+	levels := map[string]slog.Level{}
+	for subsystem, name := range settings.Levels {
+		levels[subsystem], err = ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("level of %s: %w", subsystem, err)
+		}
+	}
+
+	// The handler passes every record; the loggers decide by subsystem what is enabled. Durations are
+	// written as text such as 1.5s rather than as nanoseconds.
+	options := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if a.Value.Kind() == slog.KindDuration {
+			return slog.String(a.Key, a.Value.Duration().String())
+		}
+		return a
+	}}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if settings.Format == JSONFormat {
+		handler = slog.NewJSONHandler(w, options)
+	}
+
+	state.mu.Lock()
+	state.configured = true
+	state.handler = handler
+	state.level = level
+	state.levels = levels
+	state.mu.Unlock()
+
+	slog.SetDefault(slog.New(&subsystemHandler{}))
+	return nil
+}
+
+// For returns the logger of a subsystem. Its records carry the subsystem as an attribute and are logged
+// at or above the subsystem's level.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+// NewID returns a short random ID to correlate the log records of one operation or full sync cycle.
+func NewID() string {
+	id := make([]byte, 4)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(id)
+}
+
+// subsystemHandler filters records by the level of its subsystem and passes them to the configured
+// handler. The attributes and groups added with WithAttrs and WithGroup are replayed on the configured
+// handler, so that a later Configure applies to loggers derived before it.
+type subsystemHandler struct {
+	subsystem string
+	with      []func(slog.Handler) slog.Handler
+}
+
+// current returns the configured handler, or the handler of the default logger before Configure, and
+// the minimum level of the subsystem.
+func (h *subsystemHandler) current() (slog.Handler, slog.Level) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if !state.configured {
+		return slog.Default().Handler(), slog.LevelInfo
+	}
+	if level, ok := state.levels[h.subsystem]; ok {
+		return state.handler, level
+	}
+	return state.handler, state.level
+}
+
+// Enabled reports whether records at level are logged for the subsystem.
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	_, minimum := h.current()
+	return level >= minimum
+}
+
+// Handle logs r with the subsystem and the attributes of the logger.
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	handler, _ := h.current()
+	if h.subsystem != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	}
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.derive(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+// WithGroup returns a handler that puts the attributes of every record in the group name.
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.derive(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// derive returns a copy of the handler that applies with after its own attributes and groups.
+func (h *subsystemHandler) derive(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &subsystemHandler{subsystem: h.subsystem, with: append(h.with[:len(h.with):len(h.with)], with)}
+}
@@ -0,0 +1,223 @@
+// Package metrics exports the activity of the MiniSync service in the Prometheus text format. Counters and
+// histograms are updated as operations and full sync cycles finish; queue depths, watcher events and the
+// time since the last success are read from the service status whenever Prometheus scrapes.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/control"
+	"github.com/mwiater/minisync/minisyncService/logging"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric.
+const namespace = "minisync"
+
+// DefaultAddress is the address the metrics are served on when none is configured, so that they are only
+// reachable from the local machine.
+const DefaultAddress = "127.0.0.1"
+
+// metricsLog is the log of the metrics endpoint.
+var metricsLog = logging.For(logging.Metrics)
+
+// Metrics collects the metrics of a running service. It implements minisync.Observer.
+type Metrics struct {
+	registry       *prometheus.Registry
+	uploads        *prometheus.CounterVec
+	deletes        *prometheus.CounterVec
+	bytes          *prometheus.CounterVec
+	errors         *prometheus.CounterVec
+	operationTime  *prometheus.HistogramVec
+	fullSyncs      *prometheus.CounterVec
+	fullSyncTime   *prometheus.HistogramVec
+	restarts       *prometheus.CounterVec
+	status         func() control.Status
+	queueDepth     *prometheus.Desc
+	reachable      *prometheus.Desc
+	sinceSuccess   *prometheus.Desc
+	sinceFullSync  *prometheus.Desc
+	watcherUp      *prometheus.Desc
+	watcherEvents  *prometheus.Desc
+	watchedFolders *prometheus.Desc
+	paused         *prometheus.Desc
+	degraded       *prometheus.Desc
+}
+
+// New creates the metrics of a service whose state is returned by status.
+func New(status func() control.Status) *Metrics {
+	destination := []string{"profile", "destination"}
+	profile := []string{"profile"}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "uploads_total", Help: "Files uploaded to a destination.",
+		}, destination),
+		deletes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "deletes_total", Help: "Files and folders deleted from a destination.",
+		}, destination),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "uploaded_bytes_total", Help: "Bytes uploaded to a destination.",
+		}, destination),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "errors_total", Help: "Failed operations and full sync cycles, by error class.",
+		}, append(destination, "class")),
+		operationTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "operation_duration_seconds", Help: "Time taken to apply an operation to a destination.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		}, append(destination, "operation")),
+		fullSyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "full_syncs_total", Help: "Full sync cycles run against a destination, by result.",
+		}, append(destination, "result")),
+		fullSyncTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "full_sync_duration_seconds", Help: "Time taken by a full sync cycle of a destination.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}, destination),
+		restarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "watchdog_restarts_total", Help: "Stalled components restarted by the watchdog, by component.",
+		}, append(profile, "component")),
+		status: status,
+		queueDepth: prometheus.NewDesc(namespace+"_queue_depth",
+			"Operations waiting for a destination.", destination, nil),
+		reachable: prometheus.NewDesc(namespace+"_destination_reachable",
+			"1 while at least one node of a destination is online.", destination, nil),
+		sinceSuccess: prometheus.NewDesc(namespace+"_seconds_since_last_success",
+			"Seconds since a destination last applied an operation.", destination, nil),
+		sinceFullSync: prometheus.NewDesc(namespace+"_seconds_since_last_full_sync",
+			"Seconds since the last successful full sync cycle of a destination.", destination, nil),
+		watcherUp: prometheus.NewDesc(namespace+"_watcher_up",
+			"1 while the folder monitor of a profile is running.", profile, nil),
+		watcherEvents: prometheus.NewDesc(namespace+"_watcher_events_total",
+			"Change events handled by the folder monitor of a profile since it started.", profile, nil),
+		watchedFolders: prometheus.NewDesc(namespace+"_watched_folders",
+			"Folders watched by the folder monitor of a profile.", profile, nil),
+		paused: prometheus.NewDesc(namespace+"_paused",
+			"1 while syncing is paused.", nil, nil),
+		degraded: prometheus.NewDesc(namespace+"_degraded",
+			"1 while the watchdog finds stalled components or waits for a restarted full sync schedule to show progress.", nil, nil),
+	}
+
+	m.registry.MustRegister(m.uploads, m.deletes, m.bytes, m.errors, m.operationTime, m.fullSyncs, m.fullSyncTime, m.restarts, m,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Applied counts an attempt to apply an operation to a destination.
+func (m *Metrics) Applied(profile, destination string, op minisync.Operation, bytes int64, took time.Duration, err error) {
+	m.operationTime.WithLabelValues(profile, destination, string(op.Kind)).Observe(took.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(profile, destination, string(minisync.Classify(err))).Inc()
+		return
+	}
+	switch op.Kind {
+	case minisync.OpUpload, minisync.OpUpdate:
+		m.uploads.WithLabelValues(profile, destination).Inc()
+		m.bytes.WithLabelValues(profile, destination).Add(float64(bytes))
+	case minisync.OpDelete, minisync.OpDeleteDirectory:
+		m.deletes.WithLabelValues(profile, destination).Inc()
+	}
+}
+
+// FullSync counts a full sync cycle of a destination that took took and failed with err, if not nil.
+func (m *Metrics) FullSync(profile, destination string, took time.Duration, err error) {
+	if err != nil {
+		m.fullSyncs.WithLabelValues(profile, destination, "failure").Inc()
+		m.errors.WithLabelValues(profile, destination, string(minisync.Classify(err))).Inc()
+		return
+	}
+	m.fullSyncs.WithLabelValues(profile, destination, "success").Inc()
+	m.fullSyncTime.WithLabelValues(profile, destination).Observe(took.Seconds())
+}
+
+// Restarted counts a component of a profile restarted by the watchdog.
+func (m *Metrics) Restarted(profile, component string) {
+	m.restarts.WithLabelValues(profile, component).Inc()
+}
+
+// Describe sends the descriptions of the metrics read from the service status.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{m.queueDepth, m.reachable, m.sinceSuccess, m.sinceFullSync, m.watcherUp, m.watcherEvents, m.watchedFolders, m.paused, m.degraded} {
+		ch <- desc
+	}
+}
+
+// Collect reads the service status and sends the metrics derived from it. The times since the last
+// success are left out for destinations that have not succeeded yet.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	status := m.status()
+	ch <- prometheus.MustNewConstMetric(m.paused, prometheus.GaugeValue, boolValue(status.Paused))
+	ch <- prometheus.MustNewConstMetric(m.degraded, prometheus.GaugeValue, boolValue(status.Degraded))
+
+	for _, p := range status.Profiles {
+		ch <- prometheus.MustNewConstMetric(m.watcherUp, prometheus.GaugeValue, boolValue(p.Watcher.Watching), p.Name)
+		ch <- prometheus.MustNewConstMetric(m.watcherEvents, prometheus.CounterValue, float64(p.Watcher.Events), p.Name)
+		ch <- prometheus.MustNewConstMetric(m.watchedFolders, prometheus.GaugeValue, float64(p.Watcher.Folders), p.Name)
+	}
+
+	for _, d := range status.Destinations {
+		ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(d.Pending), d.Profile, d.Name)
+		ch <- prometheus.MustNewConstMetric(m.reachable, prometheus.GaugeValue, boolValue(d.Reachable), d.Profile, d.Name)
+		if !d.LastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(m.sinceSuccess, prometheus.GaugeValue, time.Since(d.LastSuccess).Seconds(), d.Profile, d.Name)
+		}
+		if !d.LastFullSync.IsZero() {
+			ch <- prometheus.MustNewConstMetric(m.sinceFullSync, prometheus.GaugeValue, time.Since(d.LastFullSync).Seconds(), d.Profile, d.Name)
+		}
+	}
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Server serves the metrics on a port of a local address.
+type Server struct {
+	Address string // Address is the IP address or host name the metrics are served on.
+	Port    int    // Port is the port the metrics are served on.
+	http    *http.Server
+}
+
+// Serve starts serving the metrics at /metrics on port of address, or of DefaultAddress if address is
+// empty.
+func (m *Metrics) Serve(address string, port int) (*Server, error) {
+	if address == "" {
+		address = DefaultAddress
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics requests: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	s := &Server{Address: address, Port: port, http: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}}
+	go func() {
+		err := s.http.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			metricsLog.Error("Metrics endpoint stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// URL returns the address of the metrics endpoint.
+func (s *Server) URL() string {
+	return "http://" + net.JoinHostPort(s.Address, strconv.Itoa(s.Port)) + "/metrics"
+}
+
+// Close stops serving the metrics.
+func (s *Server) Close() error {
+	return s.http.Close()
+}
@@ -0,0 +1,178 @@
+package minisync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultPageSize is the number of entries returned by ListPage when no page size is given.
+const DefaultPageSize = 100
+
+// RemoteObject is an entry in the bucket browser: either an object or a folder (common prefix).
+type RemoteObject struct {
+	Key          string            `json:"key"`          // Key is the full object key, ending in "/" for folders.
+	Name         string            `json:"name"`         // Name is the last element of the key.
+	IsDir        bool              `json:"isDir"`        // IsDir is true for folders.
+	Size         int64             `json:"size"`         // Size is the object size in bytes.
+	LastModified time.Time         `json:"lastModified"` // LastModified is when the object was last written.
+	ETag         string            `json:"etag"`         // ETag is the object's entity tag.
+	ContentType  string            `json:"contentType"`  // ContentType is the object's MIME type.
+	VersionID    string            `json:"versionId"`    // VersionID is the object version, on versioned buckets.
+	Metadata     map[string]string `json:"metadata"`     // Metadata is the user metadata, returned by StatRemoteObject only.
+}
+
+// ObjectPage is a page of bucket browser entries.
+type ObjectPage struct {
+	Prefix     string         `json:"prefix"`     // Prefix is the folder that was listed.
+	Search     string         `json:"search"`     // Search is the name filter that was applied.
+	Objects    []RemoteObject `json:"objects"`    // Objects are the entries on this page.
+	NextMarker string         `json:"nextMarker"` // NextMarker is passed as startAfter to fetch the next page.
+	Truncated  bool           `json:"truncated"`  // Truncated is true when there are more entries.
+}
+
+// ListPage lists one page of the bucket under prefix, starting after the key startAfter. Without a
+// search term only the direct children of prefix are listed, with sub-folders as folder entries. With a
+// search term every object below prefix whose name contains it (case-insensitively) is listed.
+func (c *MinioClient) ListPage(prefix, search, startAfter string, pageSize int) (*ObjectPage, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	page := &ObjectPage{Prefix: prefix, Search: search, Objects: []RemoteObject{}}
+	needle := strings.ToLower(search)
+	objectCh := c.Client().ListObjects(ctx, c.BucketName, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  search != "",
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, wrapError("list", prefix, object.Err)
+		}
+
+		entry := toRemoteObject(object)
+		if needle != "" && !strings.Contains(strings.ToLower(entry.Name), needle) {
+			continue
+		}
+
+		if len(page.Objects) == pageSize {
+			page.Truncated = true
+			break
+		}
+		page.Objects = append(page.Objects, entry)
+		page.NextMarker = object.Key
+	}
+
+	return page, nil
+}
+
+// StatRemoteObject returns the metadata of a single object, including its user metadata.
+func (c *MinioClient) StatRemoteObject(key string) (*RemoteObject, error) {
+	info, err := c.StatObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := toRemoteObject(info)
+	entry.Metadata = info.UserMetadata
+	return &entry, nil
+}
+
+// DownloadObject downloads the object at key into destFolder, keeping its file name, and returns the
+// path of the downloaded file.
+func (c *MinioClient) DownloadObject(key, destFolder string) (string, error) {
+	target, err := downloadTarget(destFolder, objectName(key))
+	if err != nil {
+		return "", err
+	}
+
+	err = c.Client().FGetObject(context.Background(), c.BucketName, key, target, minio.GetObjectOptions{})
+	if err != nil {
+		return "", wrapError("download", key, err)
+	}
+	return target, nil
+}
+
+// DownloadPrefix downloads every object under prefix into destFolder, recreating the folder structure
+// below prefix, and returns the number of files downloaded. A prefix without a trailing slash is taken as
+// a folder, so that "docs" does not also download "docs-old". If downloaded is not nil, it is called after
+// every attempted download with the object key, the local file and the error, if the download failed.
+func (c *MinioClient) DownloadPrefix(prefix, destFolder string, downloaded func(key, target string, err error)) (int, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := 0
+	objectCh := c.Client().ListObjects(ctx, c.BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for object := range objectCh {
+		if object.Err != nil {
+			return count, wrapError("list", prefix, object.Err)
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+
+		target, err := downloadTarget(destFolder, normalizeKey(strings.TrimPrefix(object.Key, prefix)))
+		if err != nil {
+			return count, err
+		}
+
+		err = c.Client().FGetObject(ctx, c.BucketName, object.Key, target, minio.GetObjectOptions{})
+		if err != nil {
+			err = wrapError("download", object.Key, err)
+		}
+		if downloaded != nil {
+			downloaded(object.Key, target, err)
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// downloadTarget returns the local path for relativePath below destFolder. It refuses keys that would
+// escape destFolder, such as ones containing "..".
+func downloadTarget(destFolder, relativePath string) (string, error) {
+	target := filepath.Join(destFolder, filepath.FromSlash(relativePath))
+	rel, err := filepath.Rel(destFolder, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to download %q outside of %s", relativePath, destFolder)
+	}
+	return target, os.MkdirAll(filepath.Dir(target), 0755)
+}
+
+// toRemoteObject converts a MinIO listing entry to a bucket browser entry.
+func toRemoteObject(object minio.ObjectInfo) RemoteObject {
+	isDir := strings.HasSuffix(object.Key, "/")
+	return RemoteObject{
+		Key:          object.Key,
+		Name:         objectName(object.Key),
+		IsDir:        isDir,
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		ETag:         object.ETag,
+		ContentType:  object.ContentType,
+		VersionID:    object.VersionID,
+	}
+}
+
+// objectName returns the last element of a key, treating both slash styles as separators.
+func objectName(key string) string {
+	return path.Base(normalizeKey(strings.TrimSuffix(key, "/")))
+}
@@ -0,0 +1,55 @@
+package minisync
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadPrefixTakesPrefixAsFolder(t *testing.T) {
+	objects := map[string]string{"docs/a.txt": "a", "docs/sub/b.txt": "b", "docs-old/c.txt": "c"}
+	client := newFakeS3(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>backups</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>`, prefix)
+			for key, content := range objects {
+				if strings.HasPrefix(key, prefix) {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, key, len(content))
+				}
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		content, ok := objects[strings.TrimPrefix(r.URL.Path, "/backups/")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		fmt.Fprint(w, content)
+	})
+
+	destFolder := t.TempDir()
+	count, err := client.DownloadPrefix("docs", destFolder, nil)
+	if err != nil {
+		t.Fatalf("DownloadPrefix() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("DownloadPrefix() downloaded %d files, want 2", count)
+	}
+	for path, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		got, err := os.ReadFile(filepath.Join(destFolder, filepath.FromSlash(path)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if entries, _ := os.ReadDir(destFolder); len(entries) != 2 {
+		t.Errorf("destination folder holds %d entries, want a.txt and sub", len(entries))
+	}
+}
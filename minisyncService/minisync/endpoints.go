@@ -0,0 +1,164 @@
+package minisync
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// EndpointStrategy controls how a MinioClient spreads requests over the nodes of a cluster.
+type EndpointStrategy string
+
+const (
+	// Failover sends every request to the first healthy node in the configured order.
+	Failover EndpointStrategy = "failover"
+
+	// RoundRobin rotates requests over all healthy nodes.
+	RoundRobin EndpointStrategy = "roundrobin"
+)
+
+// healthCheckInterval is how often an offline node is probed to see if it has come back.
+const healthCheckInterval = 5 * time.Second
+
+// minioNode is a single cluster node and its health-checked MinIO client.
+type minioNode struct {
+	endpoint          string
+	client            *minio.Client
+	cancelHealthCheck context.CancelFunc
+}
+
+// EndpointStatus reports the health of a single node of a cluster.
+type EndpointStatus struct {
+	Endpoint string `json:"endpoint"` // Endpoint is the node's host:port.
+	Online   bool   `json:"online"`   // Online is false once a request or health probe to the node has failed.
+	Active   bool   `json:"active"`   // Active is true for the node that served the most recent request.
+}
+
+// ParseEndpoint validates a single endpoint, given either as host:port or as an http:// or https:// URL
+// without a path, and returns its host:port and whether TLS should be used. A URL without a port keeps
+// its scheme's default port; a bare host:port always uses plain HTTP.
+func ParseEndpoint(endpoint string) (host string, secure bool, err error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", false, fmt.Errorf("invalid endpoint %q: scheme must be http or https", endpoint)
+		}
+		if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			return "", false, fmt.Errorf("invalid endpoint %q: expected scheme://host[:port] without a path", endpoint)
+		}
+		if u.Port() != "" {
+			if err := checkPort(u.Port()); err != nil {
+				return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+			}
+		}
+		return u.Host, u.Scheme == "https", nil
+	}
+
+	hostname, port, err := net.SplitHostPort(endpoint)
+	if err != nil || hostname == "" {
+		return "", false, fmt.Errorf("invalid endpoint %q: expected host:port or a URL", endpoint)
+	}
+	if err := checkPort(port); err != nil {
+		return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if strings.ContainsAny(hostname, "/?#@ ") {
+		return "", false, fmt.Errorf("invalid endpoint %q: invalid host name", endpoint)
+	}
+	return endpoint, false, nil
+}
+
+// checkPort reports whether port is a valid TCP port number.
+func checkPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// ParseEndpoints splits a comma separated list of host:port endpoints, ignoring blanks.
+func ParseEndpoints(value string) []string {
+	var endpoints []string
+	for _, endpoint := range strings.Split(value, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// ParseEndpointStrategy validates an endpoint strategy setting. An empty value selects Failover.
+func ParseEndpointStrategy(value string) (EndpointStrategy, error) {
+	switch EndpointStrategy(strings.ToLower(strings.TrimSpace(value))) {
+	case "", Failover:
+		return Failover, nil
+	case RoundRobin:
+		return RoundRobin, nil
+	default:
+		return "", fmt.Errorf("unknown endpoint strategy %q: must be failover or roundrobin", value)
+	}
+}
+
+// Client returns the MinIO client of the node that should serve the next request. With Failover this is
+// the first online node; with RoundRobin the online nodes take turns. If every node is offline the
+// previously active node is returned, so that the caller receives the real connection error.
+func (c *MinioClient) Client() *minio.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := 0
+	if c.Strategy == RoundRobin {
+		start = (c.active + 1) % len(c.nodes)
+	}
+	for i := range c.nodes {
+		n := (start + i) % len(c.nodes)
+		if c.nodes[n].client.IsOnline() {
+			c.active = n
+			return c.nodes[n].client
+		}
+	}
+	return c.nodes[c.active].client
+}
+
+// ActiveEndpoint returns the host:port of the node that served the most recent request.
+func (c *MinioClient) ActiveEndpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nodes[c.active].endpoint
+}
+
+// EndpointStatus returns the health of every configured node.
+func (c *MinioClient) EndpointStatus() []EndpointStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]EndpointStatus, 0, len(c.nodes))
+	for i, node := range c.nodes {
+		statuses = append(statuses, EndpointStatus{
+			Endpoint: node.endpoint,
+			Online:   node.client.IsOnline(),
+			Active:   i == c.active,
+		})
+	}
+	return statuses
+}
+
+// Close stops the background health checks of every node.
+func (c *MinioClient) Close() {
+	for _, node := range c.nodes {
+		if node.cancelHealthCheck != nil {
+			node.cancelHealthCheck()
+		}
+	}
+}
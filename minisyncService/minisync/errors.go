@@ -0,0 +1,180 @@
+package minisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ErrorClass groups storage failures by what the caller can do about them.
+type ErrorClass string
+
+const (
+	// ClassUnknown is a failure that does not fit any other class.
+	ClassUnknown ErrorClass = "unknown"
+
+	// ClassAuth is a rejected access key, secret or signature.
+	ClassAuth ErrorClass = "auth"
+
+	// ClassPermission is a valid identity that is not allowed to perform the operation.
+	ClassPermission ErrorClass = "permission"
+
+	// ClassNetwork is an unreachable, refusing or timed out endpoint.
+	ClassNetwork ErrorClass = "network"
+
+	// ClassNotFound is a missing object or bucket.
+	ClassNotFound ErrorClass = "notFound"
+
+	// ClassQuota is a full disk, an exceeded bucket quota or an object that is too large.
+	ClassQuota ErrorClass = "quota"
+
+	// ClassThrottled is a server asking the client to slow down.
+	ClassThrottled ErrorClass = "throttled"
+
+	// ClassInvalidKey is an object name the server will never accept.
+	ClassInvalidKey ErrorClass = "invalidKey"
+)
+
+// Sentinel errors for each class, for use with errors.Is on errors returned by MinioClient.
+var (
+	ErrAuth       = errors.New("authentication failed")
+	ErrPermission = errors.New("permission denied")
+	ErrNetwork    = errors.New("endpoint unreachable")
+	ErrNotFound   = errors.New("not found")
+	ErrQuota      = errors.New("storage full or quota exceeded")
+	ErrThrottled  = errors.New("request throttled")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// classSentinels maps each class to its sentinel error.
+var classSentinels = map[ErrorClass]error{
+	ClassAuth:       ErrAuth,
+	ClassPermission: ErrPermission,
+	ClassNetwork:    ErrNetwork,
+	ClassNotFound:   ErrNotFound,
+	ClassQuota:      ErrQuota,
+	ClassThrottled:  ErrThrottled,
+	ClassInvalidKey: ErrInvalidKey,
+}
+
+// errorCodeClasses maps S3 and MinIO error codes to their class.
+var errorCodeClasses = map[string]ErrorClass{
+	"InvalidAccessKeyId":           ClassAuth,
+	"SignatureDoesNotMatch":        ClassAuth,
+	"ExpiredToken":                 ClassAuth,
+	"InvalidToken":                 ClassAuth,
+	"AuthorizationHeaderMalformed": ClassAuth,
+	"MissingSecurityHeader":        ClassAuth,
+	"RequestTimeTooSkewed":         ClassAuth,
+
+	"AccessDenied":       ClassPermission,
+	"AllAccessDisabled":  ClassPermission,
+	"AccountProblem":     ClassPermission,
+	"MethodNotAllowed":   ClassPermission,
+	"ObjectLockedByWorm": ClassPermission,
+
+	"NoSuchKey":     ClassNotFound,
+	"NoSuchBucket":  ClassNotFound,
+	"NoSuchVersion": ClassNotFound,
+	"NoSuchUpload":  ClassNotFound,
+
+	"XMinioStorageFull":              ClassQuota,
+	"XMinioAdminBucketQuotaExceeded": ClassQuota,
+	"QuotaExceeded":                  ClassQuota,
+	"EntityTooLarge":                 ClassQuota,
+
+	"SlowDown":                   ClassThrottled,
+	"SlowDownRead":               ClassThrottled,
+	"SlowDownWrite":              ClassThrottled,
+	"RequestLimitExceeded":       ClassThrottled,
+	"TooManyRequests":            ClassThrottled,
+	"XMinioServerNotInitialized": ClassThrottled,
+
+	"InvalidObjectName":         ClassInvalidKey,
+	"XMinioInvalidObjectName":   ClassInvalidKey,
+	"KeyTooLongError":           ClassInvalidKey,
+	"InvalidBucketName":         ClassInvalidKey,
+	"XMinioInvalidResourceName": ClassInvalidKey,
+}
+
+// StorageError is a classified failure of a storage operation.
+type StorageError struct {
+	Op    string     // Op is the operation that failed, such as "upload" or "stat".
+	Key   string     // Key is the object key the operation was performed on.
+	Class ErrorClass // Class is the kind of failure.
+	Err   error      // Err is the underlying error.
+}
+
+// Error returns the operation, key, class and underlying error.
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %v", e.Op, e.Key, e.Class, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error of this error's class, so that
+// errors.Is(err, ErrNotFound) works on any StorageError.
+func (e *StorageError) Is(target error) bool {
+	sentinel, ok := classSentinels[e.Class]
+	return ok && target == sentinel
+}
+
+// Retryable reports whether the operation may succeed if it is tried again later. Auth, permission,
+// not-found and invalid-key failures will not fix themselves and are not retried.
+func (c ErrorClass) Retryable() bool {
+	switch c {
+	case ClassAuth, ClassPermission, ClassNotFound, ClassInvalidKey:
+		return false
+	default:
+		return true
+	}
+}
+
+// Classify returns the class of an error returned by the MinIO client.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.Class
+	}
+
+	resp := minio.ToErrorResponse(err)
+	if class, ok := errorCodeClasses[resp.Code]; ok {
+		return class
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return ClassAuth
+	case http.StatusForbidden:
+		return ClassPermission
+	case http.StatusNotFound:
+		return ClassNotFound
+	case http.StatusInsufficientStorage, http.StatusRequestEntityTooLarge:
+		return ClassQuota
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ClassThrottled
+	}
+
+	if minio.IsNetworkOrHostDown(err, false) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassNetwork
+	}
+	return ClassUnknown
+}
+
+// wrapError classifies err and wraps it in a StorageError for the given operation and key.
+// It returns nil if err is nil.
+func wrapError(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StorageError{Op: op, Key: key, Class: Classify(err), Err: err}
+}
@@ -0,0 +1,62 @@
+package minisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ""},
+		{"storage error", &StorageError{Op: "upload", Key: "a.txt", Class: ClassQuota, Err: errors.New("full")}, ClassQuota},
+		{"wrapped storage error", fmt.Errorf("sync: %w", &StorageError{Class: ClassThrottled, Err: errors.New("slow")}), ClassThrottled},
+		{"bad access key", minio.ErrorResponse{Code: "InvalidAccessKeyId", StatusCode: http.StatusForbidden}, ClassAuth},
+		{"bad signature", minio.ErrorResponse{Code: "SignatureDoesNotMatch", StatusCode: http.StatusForbidden}, ClassAuth},
+		{"access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, ClassPermission},
+		{"locked object", minio.ErrorResponse{Code: "ObjectLockedByWorm", StatusCode: http.StatusBadRequest}, ClassPermission},
+		{"missing key", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}, ClassNotFound},
+		{"missing bucket", minio.ErrorResponse{Code: "NoSuchBucket", StatusCode: http.StatusNotFound}, ClassNotFound},
+		{"storage full", minio.ErrorResponse{Code: "XMinioStorageFull", StatusCode: http.StatusInsufficientStorage}, ClassQuota},
+		{"slow down", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, ClassThrottled},
+		{"invalid name", minio.ErrorResponse{Code: "XMinioInvalidObjectName", StatusCode: http.StatusBadRequest}, ClassInvalidKey},
+		{"unknown code 401", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusUnauthorized}, ClassAuth},
+		{"unknown code 403", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusForbidden}, ClassPermission},
+		{"unknown code 404", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusNotFound}, ClassNotFound},
+		{"unknown code 413", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusRequestEntityTooLarge}, ClassQuota},
+		{"unknown code 429", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusTooManyRequests}, ClassThrottled},
+		{"unknown code 500", minio.ErrorResponse{Code: "Other", StatusCode: http.StatusInternalServerError}, ClassUnknown},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ClassNetwork},
+		{"deadline", context.DeadlineExceeded, ClassNetwork},
+		{"other", errors.New("something else"), ClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorageErrorIs(t *testing.T) {
+	err := wrapError("stat", "a.txt", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = false, want true", err)
+	}
+	if errors.Is(err, ErrAuth) {
+		t.Errorf("errors.Is(%v, ErrAuth) = true, want false", err)
+	}
+	if wrapError("stat", "a.txt", nil) != nil {
+		t.Errorf("wrapError of nil is not nil")
+	}
+}
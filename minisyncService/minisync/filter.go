@@ -0,0 +1,117 @@
+package minisync
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SyncMode controls whether local deletes are replicated to the destinations.
+type SyncMode string
+
+const (
+	// Mirror keeps the destinations identical to the backup folder: local deletes are replicated and
+	// remote objects without a local file are removed by the full sync cycle.
+	Mirror SyncMode = "mirror"
+
+	// Backup only adds and updates objects; nothing is ever deleted from the destinations.
+	Backup SyncMode = "backup"
+)
+
+// ParseSyncMode validates a sync mode setting. An empty value selects Mirror.
+func ParseSyncMode(value string) (SyncMode, error) {
+	switch SyncMode(strings.ToLower(strings.TrimSpace(value))) {
+	case "", Mirror:
+		return Mirror, nil
+	case Backup:
+		return Backup, nil
+	default:
+		return "", fmt.Errorf("unknown sync mode %q: must be %s or %s", value, Mirror, Backup)
+	}
+}
+
+// ParsePatterns splits filter patterns separated by commas or new lines, ignoring blanks.
+func ParsePatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Deletes reports whether the mode replicates deletes.
+func (m SyncMode) Deletes() bool {
+	return m != Backup
+}
+
+// Filter selects the files of a backup folder that are backed up. Patterns use path.Match syntax on
+// slash-separated paths relative to the backup folder. A pattern without a slash matches the name of any
+// file or folder, such as "*.tmp" or "node_modules"; a pattern with a slash matches the whole relative
+// path, such as "docs/*.pdf", and a trailing "/**" matches everything below a folder.
+type Filter struct {
+	Include []string `json:"include,omitempty"` // Include limits the backup to matching files; empty includes everything.
+	Exclude []string `json:"exclude,omitempty"` // Exclude skips matching files and folders, even if they are included.
+}
+
+// Validate checks that every pattern is well formed.
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		_, err := path.Match(strings.TrimSuffix(pattern, "/**"), "")
+		if err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the file at relativePath is backed up.
+func (f Filter) Match(relativePath string) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	for _, pattern := range f.Exclude {
+		if matchPattern(pattern, relativePath) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchPattern(pattern, relativePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the filter selects every file.
+func (f Filter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// matchPattern reports whether a single filter pattern matches the slash-separated relativePath.
+func matchPattern(pattern, relativePath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		elements := strings.Split(relativePath, "/")
+		for i := 1; i < len(elements); i++ {
+			if matched, _ := path.Match(prefix, strings.Join(elements[:i], "/")); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !strings.Contains(pattern, "/") {
+		for _, element := range strings.Split(relativePath, "/") {
+			if matched, _ := path.Match(pattern, element); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	matched, _ := path.Match(pattern, relativePath)
+	return matched
+}
@@ -0,0 +1,90 @@
+package minisync
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		path   string
+		want   bool
+	}{
+		{"empty filter", Filter{}, "docs/report.pdf", true},
+		{"name pattern matches a file", Filter{Exclude: []string{"*.tmp"}}, "docs/draft.tmp", false},
+		{"name pattern matches a folder", Filter{Exclude: []string{"node_modules"}}, "app/node_modules/lib/index.js", false},
+		{"name pattern matches no element", Filter{Exclude: []string{"*.tmp"}}, "docs/report.pdf", true},
+		{"path pattern matches the whole path", Filter{Include: []string{"docs/*.pdf"}}, "docs/report.pdf", true},
+		{"path pattern does not match below", Filter{Include: []string{"docs/*.pdf"}}, "docs/old/report.pdf", false},
+		{"path pattern does not match elsewhere", Filter{Include: []string{"docs/*.pdf"}}, "other/docs/report.pdf", false},
+		{"folder pattern matches below", Filter{Include: []string{"docs/**"}}, "docs/old/report.pdf", true},
+		{"folder pattern does not match the folder name", Filter{Include: []string{"docs/**"}}, "docs", false},
+		{"folder pattern does not match a sibling", Filter{Include: []string{"docs/**"}}, "docsold/report.pdf", false},
+		{"folder pattern with a wildcard", Filter{Exclude: []string{"*/cache/**"}}, "app/cache/data.bin", false},
+		{"not included", Filter{Include: []string{"*.pdf"}}, "notes.txt", false},
+		{"exclude wins over include", Filter{Include: []string{"*.pdf"}, Exclude: []string{"drafts/**"}}, "drafts/report.pdf", false},
+		{"one of several includes", Filter{Include: []string{"*.doc", "*.pdf"}}, "report.pdf", true},
+		{"native separators", Filter{Include: []string{"docs/*.pdf"}}, filepath.Join("docs", "report.pdf"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	tests := []struct {
+		filter Filter
+		valid  bool
+	}{
+		{Filter{}, true},
+		{Filter{Include: []string{"*.pdf", "docs/**"}, Exclude: []string{"node_modules", "[a-z]*.tmp"}}, true},
+		{Filter{Include: []string{"["}}, false},
+		{Filter{Exclude: []string{"docs/[/**"}}, false},
+		{Filter{Exclude: []string{" "}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.filter.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() of %+v error = %v, want valid %v", tt.filter, err, tt.valid)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	got := ParsePatterns("*.tmp, node_modules\n\ndocs/**,\r\n ,*.bak")
+	want := []string{"*.tmp", "node_modules", "docs/**", "*.bak"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePatterns() = %q, want %q", got, want)
+	}
+	if got := ParsePatterns(" \n, "); got != nil {
+		t.Errorf("ParsePatterns() of blanks = %q, want none", got)
+	}
+}
+
+func TestParseSyncMode(t *testing.T) {
+	tests := []struct {
+		value string
+		want  SyncMode
+		valid bool
+	}{
+		{"", Mirror, true},
+		{"mirror", Mirror, true},
+		{" Backup ", Backup, true},
+		{"copy", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseSyncMode(tt.value)
+		if got != tt.want || (err == nil) != tt.valid {
+			t.Errorf("ParseSyncMode(%q) = %q, %v, want %q and valid %v", tt.value, got, err, tt.want, tt.valid)
+		}
+	}
+	if Backup.Deletes() || !Mirror.Deletes() {
+		t.Errorf("Deletes() = %v for backup and %v for mirror, want only mirror to delete", Backup.Deletes(), Mirror.Deletes())
+	}
+}
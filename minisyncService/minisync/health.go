@@ -0,0 +1,113 @@
+package minisync
+
+import (
+	"sync"
+	"time"
+)
+
+// WatcherStatus is a point-in-time view of the health of a folder monitor.
+type WatcherStatus struct {
+	Folder        string    `json:"folder"`        // Folder is the monitored backup folder.
+	Watching      bool      `json:"watching"`      // Watching is true while the monitor is receiving change events.
+	Folders       int       `json:"folders"`       // Folders is the number of folders being watched.
+	Since         time.Time `json:"since"`         // Since is when the monitor started or stopped.
+	Events        int       `json:"events"`        // Events counts the change events handled since start.
+	LastEvent     time.Time `json:"lastEvent"`     // LastEvent is when the most recent change event was handled.
+	LastError     string    `json:"lastError"`     // LastError is the most recent watcher failure.
+	LastErrorTime time.Time `json:"lastErrorTime"` // LastErrorTime is when LastError occurred.
+}
+
+// WatcherHealth records the health of a running MonitorDirectory. It is safe for concurrent use, and the
+// methods of a nil WatcherHealth do nothing.
+type WatcherHealth struct {
+	mu     sync.Mutex
+	status WatcherStatus
+}
+
+// Status returns a snapshot of the monitor's health.
+func (h *WatcherHealth) Status() WatcherStatus {
+	if h == nil {
+		return WatcherStatus{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// started records that folder is being watched.
+func (h *WatcherHealth) started(folder string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = WatcherStatus{Folder: folder, Watching: true, Since: time.Now()}
+}
+
+// watching records how many folders are being watched.
+func (h *WatcherHealth) watching(folders int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Folders = folders
+}
+
+// event records a handled change event.
+func (h *WatcherHealth) event() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Events++
+	h.status.LastEvent = time.Now()
+}
+
+// failed records a watcher error. The monitor keeps running.
+func (h *WatcherHealth) failed(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.LastError = err.Error()
+	h.status.LastErrorTime = time.Now()
+}
+
+// stopped records that the monitor stopped, with the error that stopped it, if any.
+func (h *WatcherHealth) stopped(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Watching = false
+	h.status.Since = time.Now()
+	if err != nil {
+		h.status.LastError = err.Error()
+		h.status.LastErrorTime = time.Now()
+	}
+}
+
+// Heartbeat records when a long-running component last showed that it is making progress, so that a
+// watchdog can tell a stalled component from a busy one. It is safe for concurrent use.
+type Heartbeat struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Beat records progress.
+func (h *Heartbeat) Beat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+}
+
+// Last returns when progress was last recorded.
+func (h *Heartbeat) Last() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
@@ -0,0 +1,343 @@
+package minisync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/logging"
+)
+
+const fileHistoryFileName = "FileHistory.log"
+
+// AuditAction is what happened to a file, as recorded in the file history.
+type AuditAction string
+
+const (
+	// AuditUpload is a new file uploaded to a destination.
+	AuditUpload AuditAction = "upload"
+
+	// AuditUpdate is a changed file uploaded over its remote object.
+	AuditUpdate AuditAction = "update"
+
+	// AuditDelete is a remote object, or every object below a folder, deleted from a destination.
+	AuditDelete AuditAction = "delete"
+
+	// AuditCopy is a remote object downloaded to a folder outside the backup folder.
+	AuditCopy AuditAction = "copy"
+
+	// AuditRestore is a remote object downloaded back into the backup folder.
+	AuditRestore AuditAction = "restore"
+)
+
+// Results of an audited action.
+const (
+	AuditSuccess = "success" // AuditSuccess is an action that completed.
+	AuditFailure = "failure" // AuditFailure is an action that failed; it may be retried later.
+)
+
+// AuditEntry is a single record of the file history.
+type AuditEntry struct {
+	Time        time.Time   `json:"time"`                // Time is when the action finished.
+	Action      AuditAction `json:"action"`              // Action is what happened to the file.
+	Path        string      `json:"path"`                // Path is the object key, or the folder of a folder delete.
+	Folder      bool        `json:"folder,omitempty"`    // Folder is true for a folder delete, which covers every object below Path.
+	Destination string      `json:"destination"`         // Destination is the destination the action was applied to.
+	Size        int64       `json:"size"`                // Size is the size of the file uploaded or downloaded.
+	Hash        string      `json:"hash,omitempty"`      // Hash is the SHA-256 of the file uploaded or downloaded, if it succeeded.
+	LocalPath   string      `json:"localPath,omitempty"` // LocalPath is the file uploaded from or downloaded to.
+	Result      string      `json:"result"`              // Result is AuditSuccess or AuditFailure.
+	Error       string      `json:"error,omitempty"`     // Error is why the action failed.
+	Source      string      `json:"source"`              // Source is where the action was taken, "service" or "gui".
+}
+
+// covers reports whether the entry concerns the object at key, an object below the folder key, or, for a
+// folder delete, a folder containing key. An empty key covers every entry.
+func (e AuditEntry) covers(key string) bool {
+	key = strings.Trim(normalizeKey(key), "/")
+	if key == "" {
+		return true
+	}
+	path := strings.Trim(normalizeKey(e.Path), "/")
+	return path == key || strings.HasPrefix(path, key+"/") || e.Folder && strings.HasPrefix(key, path+"/")
+}
+
+// FileHistory is the append-only audit history of the files of a profile: every upload, update and
+// delete applied to a destination and every file downloaded from it. It is kept as JSON lines in the
+// profile's state folder, where the service and the GUI both append to it; each entry is written with a
+// single append, so their entries never interleave. Like the service log, the history is rotated by the
+// service once it outgrows the size or age limits of the log settings, but its compressed earlier parts are
+// never deleted. FileHistory implements Observer.
+type FileHistory struct {
+	mu       sync.Mutex
+	folder   string
+	source   string
+	rotate   bool // rotate is set for the history that rotates the file, which only the service does.
+	settings logging.Settings
+	file     *logging.File // file is the open history of a rotating history, opened when the first entry is recorded.
+}
+
+// NewFileHistory returns the file history kept in stateFolder, rotated with the limits of settings.
+// Entries are recorded with source as their Source. Only the service rotates the history; other processes
+// use AppendFileHistory. Close it once it is no longer needed.
+func NewFileHistory(stateFolder, source string, settings logging.Settings) *FileHistory {
+	return &FileHistory{folder: stateFolder, source: source, rotate: true, settings: settings}
+}
+
+// AppendFileHistory returns the file history kept in stateFolder for a process other than the service, such
+// as the GUI. It appends to the current history file without ever rotating it, and opens the file for each
+// entry only, so that it never keeps the service from rotating the file. Entries are recorded with source as
+// their Source.
+func AppendFileHistory(stateFolder, source string) *FileHistory {
+	return &FileHistory{folder: stateFolder, source: source}
+}
+
+// SetFolder moves the file history to stateFolder, for example after the log folder changed. Earlier
+// entries stay in the previous folder.
+func (h *FileHistory) SetFolder(stateFolder string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.close()
+	h.folder = stateFolder
+}
+
+// SetLimits applies the rotation limits of settings.
+func (h *FileHistory) SetLimits(settings logging.Settings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings = settings
+	if h.file != nil {
+		h.file.SetLimits(settings)
+	}
+}
+
+// Close closes the history file. Recording another entry opens it again.
+func (h *FileHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.close()
+}
+
+// close closes the history file, if it is open. The caller must hold h.mu.
+func (h *FileHistory) close() error {
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// Record appends entry to the file history, setting its time and source if they are not set.
+func (h *FileHistory) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Source == "" {
+		entry.Source = h.source
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode file history entry: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.rotate {
+		return h.append(append(data, '\n'))
+	}
+	if h.file == nil {
+		h.file, err = logging.OpenArchive(filepath.Join(h.folder, fileHistoryFileName), h.settings)
+		if err != nil {
+			return fmt.Errorf("failed to open file history: %w", err)
+		}
+	}
+
+	_, err = h.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write file history: %w", err)
+	}
+	return nil
+}
+
+// append appends line to the current history file of a history that does not rotate it, opening and closing
+// the file around the write. The caller must hold h.mu.
+func (h *FileHistory) append(line []byte) error {
+	file, err := os.OpenFile(filepath.Join(h.folder, fileHistoryFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open file history: %w", err)
+	}
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file history: %w", err)
+	}
+	return nil
+}
+
+// Applied records an attempt to apply op to a destination. Successful uploads are recorded with the hash
+// computed while the file was uploaded, so recording never reads the file again.
+func (h *FileHistory) Applied(profile, destination string, op Operation, bytes int64, took time.Duration, err error) {
+	entry := AuditEntry{Path: op.RelativePath, Destination: destination, Result: AuditSuccess}
+	switch op.Kind {
+	case OpUpload:
+		entry.Action = AuditUpload
+	case OpUpdate:
+		entry.Action = AuditUpdate
+	case OpDelete:
+		entry.Action = AuditDelete
+	case OpDeleteDirectory:
+		entry.Action, entry.Folder = AuditDelete, true
+	default:
+		return
+	}
+
+	if op.Kind.Uploads() {
+		entry.LocalPath = op.FilePath
+		entry.Size, entry.Hash = bytes, op.Hash
+		if err != nil {
+			if info, statErr := os.Stat(op.FilePath); statErr == nil {
+				entry.Size = info.Size()
+			}
+		}
+	}
+	if err != nil {
+		entry.Result, entry.Error = AuditFailure, err.Error()
+	}
+
+	recordErr := h.Record(entry)
+	if recordErr != nil {
+		replicatorLog.Warn("Failed to record file history", "profile", profile, "destination", destination, "path", op.RelativePath, "error", recordErr)
+	}
+}
+
+// Downloaded records the download of the object at key from a destination to the local file target. The
+// download is a restore if target lies inside backupFolder, and a copy otherwise. Successful downloads are
+// recorded with the size and hash of the downloaded file.
+func (h *FileHistory) Downloaded(destination, backupFolder, key, target string, err error) error {
+	entry := AuditEntry{Action: AuditCopy, Path: key, Destination: destination, LocalPath: target, Result: AuditSuccess}
+	if _, outside := ObjectKey(backupFolder, target); filepath.IsAbs(target) && outside == nil {
+		entry.Action = AuditRestore
+	}
+	if err != nil {
+		entry.Result, entry.Error = AuditFailure, err.Error()
+	} else if info, statErr := os.Stat(target); statErr == nil {
+		entry.Size = info.Size()
+		entry.Hash, _ = hashFile(target)
+	}
+	return h.Record(entry)
+}
+
+// ReadFileHistory returns the entries of the file history in stateFolder, including its rotated parts,
+// that concern the object or folder at key, newest first, and at most limit of them
+// unless limit is 0. An empty key returns every entry. A missing history yields no entries.
+func ReadFileHistory(stateFolder, key string, limit int) ([]AuditEntry, error) {
+	paths, err := historyFiles(stateFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, path := range paths {
+		entries, err = readHistoryFile(path, key, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// historyFiles returns the rotated parts of the file history in stateFolder, oldest first, followed by the
+// current file. A part that is still being compressed is read from its uncompressed file.
+func historyFiles(stateFolder string) ([]string, error) {
+	ext := filepath.Ext(fileHistoryFileName)
+	pattern := filepath.Join(stateFolder, strings.TrimSuffix(fileHistoryFileName, ext)+"-*"+ext)
+	uncompressed, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file history: %w", err)
+	}
+	compressed, err := filepath.Glob(pattern + ".gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file history: %w", err)
+	}
+
+	paths := uncompressed
+	for _, path := range compressed {
+		if _, err := os.Stat(strings.TrimSuffix(path, ".gz")); os.IsNotExist(err) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return append(paths, filepath.Join(stateFolder, fileHistoryFileName)), nil
+}
+
+// readHistoryFile appends the entries of the history file at path that concern key to entries. A missing
+// file adds nothing.
+func readHistoryFile(path, key string, entries []AuditEntry) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file history: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file history %s: %w", filepath.Base(path), err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !entry.covers(key) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file history: %w", err)
+	}
+	return entries, nil
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
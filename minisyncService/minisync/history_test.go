@@ -0,0 +1,174 @@
+package minisync
+
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/logging"
+)
+
+// historyPaths returns the Path of each entry.
+func historyPaths(entries []AuditEntry) []string {
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func TestFileHistoryRecordsOperations(t *testing.T) {
+	stateFolder := t.TempDir()
+	file := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(file, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewFileHistory(stateFolder, "service", logging.Settings{})
+	h.Applied("default", "primary", Operation{Kind: OpUpload, RelativePath: "docs/report.pdf", FilePath: file, Hash: "abc"}, 6, time.Second, nil)
+	h.Applied("default", "primary", Operation{Kind: OpUpdate, RelativePath: "docs/report.pdf", FilePath: file}, 0, time.Second, errors.New("unreachable"))
+	h.Applied("default", "primary", Operation{Kind: OpDeleteDirectory, RelativePath: "docs"}, 0, 0, nil)
+	h.Applied("default", "primary", Operation{Kind: OpDelete, RelativePath: "other.txt"}, 0, 0, nil)
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := ReadFileHistory(stateFolder, "docs/report.pdf", 0)
+	if err != nil {
+		t.Fatalf("ReadFileHistory() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("ReadFileHistory() = %+v, want the folder delete, the update and the upload", entries)
+	}
+	if e := entries[0]; e.Action != AuditDelete || !e.Folder || e.Path != "docs" {
+		t.Errorf("newest entry = %+v, want the delete of folder docs", e)
+	}
+	if e := entries[1]; e.Action != AuditUpdate || e.Result != AuditFailure || e.Error != "unreachable" || e.Size != 6 || e.Hash != "" {
+		t.Errorf("second entry = %+v, want the failed update with the size of the file", e)
+	}
+	if e := entries[2]; e.Action != AuditUpload || e.Result != AuditSuccess || e.Size != 6 || e.Hash != "abc" || e.LocalPath != file || e.Source != "service" {
+		t.Errorf("oldest entry = %+v, want the successful upload", e)
+	}
+
+	entries, err = ReadFileHistory(stateFolder, "", 2)
+	if err != nil {
+		t.Fatalf("ReadFileHistory() error = %v", err)
+	}
+	if got, want := historyPaths(entries), []string{"other.txt", "docs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFileHistory() with limit 2 = %q, want %q", got, want)
+	}
+}
+
+func TestFileHistoryDownloaded(t *testing.T) {
+	stateFolder := t.TempDir()
+	backupFolder := t.TempDir()
+	restored := filepath.Join(backupFolder, "a.txt")
+	copied := filepath.Join(t.TempDir(), "a.txt")
+	for _, file := range []string{restored, copied} {
+		if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := AppendFileHistory(stateFolder, "gui")
+	for _, target := range []string{restored, copied} {
+		if err := h.Downloaded("primary", backupFolder, "a.txt", target, nil); err != nil {
+			t.Fatalf("Downloaded() error = %v", err)
+		}
+	}
+
+	entries, err := ReadFileHistory(stateFolder, "a.txt", 0)
+	if err != nil {
+		t.Fatalf("ReadFileHistory() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadFileHistory() = %+v, want two entries", entries)
+	}
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if e := entries[0]; e.Action != AuditCopy || e.LocalPath != copied || e.Size != 5 || e.Hash != hash || e.Source != "gui" {
+		t.Errorf("newest entry = %+v, want the copy", e)
+	}
+	if e := entries[1]; e.Action != AuditRestore || e.LocalPath != restored {
+		t.Errorf("oldest entry = %+v, want the restore", e)
+	}
+}
+
+func TestAppendFileHistoryKeepsNoFileOpen(t *testing.T) {
+	stateFolder := t.TempDir()
+	h := AppendFileHistory(stateFolder, "gui")
+	if err := h.Record(AuditEntry{Action: AuditCopy, Path: "a.txt"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	// The service rotates the history by renaming it, which fails on Windows while the file is open.
+	path := filepath.Join(stateFolder, fileHistoryFileName)
+	if err := os.Rename(path, filepath.Join(stateFolder, "FileHistory-2024-01-01T00-00-00.log")); err != nil {
+		t.Fatalf("rotating the history: %v", err)
+	}
+	if err := h.Record(AuditEntry{Action: AuditCopy, Path: "b.txt"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Record() after the rotation did not create a new history file: %v", err)
+	}
+
+	entries, err := ReadFileHistory(stateFolder, "", 0)
+	if err != nil {
+		t.Fatalf("ReadFileHistory() error = %v", err)
+	}
+	if got, want := historyPaths(entries), []string{"b.txt", "a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFileHistory() = %q, want %q", got, want)
+	}
+}
+
+func TestFileHistoryNeverDeletesRotatedParts(t *testing.T) {
+	stateFolder := t.TempDir()
+	old := filepath.Join(stateFolder, "FileHistory-2020-01-01T00-00-00.log.gz")
+	file, err := os.Create(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(file)
+	zw.Write([]byte(`{"time":"2020-01-01T00:00:00Z","action":"upload","path":"old.txt","destination":"primary","result":"success","source":"service"}` + "\n"))
+	zw.Close()
+	file.Close()
+	longAgo := time.Now().Add(-400 * 24 * time.Hour)
+	if err := os.Chtimes(old, longAgo, longAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewFileHistory(stateFolder, "service", logging.Settings{MaxSizeMB: 1, KeepDays: 1})
+	path := strings.Repeat("x", 2000)
+	for i := 0; i < 600; i++ {
+		if err := h.Record(AuditEntry{Action: AuditUpload, Path: path, Destination: "primary", Result: AuditSuccess}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("rotation deleted an old part of the history: %v", err)
+	}
+	parts, err := filepath.Glob(filepath.Join(stateFolder, "FileHistory-*.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Errorf("rotated parts = %q, want the old one and a new one", parts)
+	}
+
+	entries, err := ReadFileHistory(stateFolder, "", 0)
+	if err != nil {
+		t.Fatalf("ReadFileHistory() error = %v", err)
+	}
+	if len(entries) != 601 || entries[600].Path != "old.txt" {
+		t.Errorf("ReadFileHistory() returned %d entries, want the 600 recorded and the old one last", len(entries))
+	}
+}
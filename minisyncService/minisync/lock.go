@@ -0,0 +1,183 @@
+package minisync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// RetentionPolicy describes the Object Lock settings applied to an uploaded object.
+// A policy with an empty Mode writes no retention, and a policy without LegalHold writes no legal hold.
+type RetentionPolicy struct {
+	Mode      minio.RetentionMode `json:"mode,omitempty"`      // Mode is the retention mode, either GOVERNANCE or COMPLIANCE.
+	Days      int                 `json:"days,omitempty"`      // Days is the number of days an object version is retained after upload.
+	LegalHold bool                `json:"legalHold,omitempty"` // LegalHold places a legal hold on every uploaded object version.
+}
+
+// RetentionRule applies a RetentionPolicy to every object whose key falls under Prefix.
+type RetentionRule struct {
+	Prefix string          `json:"prefix"` // Prefix is the folder, relative to the backup folder, that the rule applies to.
+	Policy RetentionPolicy `json:"policy"` // Policy is the retention applied to objects under Prefix.
+}
+
+// ObjectLock holds the write-once-read-many configuration for a bucket. When it is set on a MinioClient,
+// the bucket must have Object Lock enabled, uploads carry retention and legal-hold headers, and deletes
+// only ever add delete markers so that earlier object versions remain recoverable.
+type ObjectLock struct {
+	Default RetentionPolicy `json:"default"`         // Default is the policy used when no rule matches an object key.
+	Rules   []RetentionRule `json:"rules,omitempty"` // Rules are per-folder overrides, matched by the longest prefix.
+}
+
+// NewObjectLock builds an ObjectLock from its string settings as they are entered in the configuration form.
+// mode is "", "GOVERNANCE" or "COMPLIANCE", days is the default retention period, legalHold is "true"
+// or "false", and rules is a semicolon separated list of per-folder overrides (see ParseRetentionRules).
+// It returns nil when no Object Lock setting is configured.
+func NewObjectLock(mode, days, legalHold, rules string) (*ObjectLock, error) {
+	if mode == "" && rules == "" && (legalHold == "" || legalHold == "false") {
+		return nil, nil
+	}
+
+	policy, err := parseRetentionPolicy(mode, days, legalHold)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedRules, err := ParseRetentionRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectLock{Default: policy, Rules: parsedRules}, nil
+}
+
+// ParseRetentionRules parses per-folder retention overrides in the form
+// "Folder=MODE:DAYS[:hold];Other=MODE:DAYS", for example "Photos=COMPLIANCE:365:hold;Docs=GOVERNANCE:30".
+func ParseRetentionRules(rules string) ([]RetentionRule, error) {
+	var parsed []RetentionRule
+	for _, entry := range strings.Split(rules, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		prefix, settings, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(prefix) == "" {
+			return nil, fmt.Errorf("invalid retention rule %q: expected Folder=MODE:DAYS", entry)
+		}
+
+		fields := strings.Split(settings, ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid retention rule %q: expected Folder=MODE:DAYS[:hold]", entry)
+		}
+
+		legalHold := "false"
+		if len(fields) == 3 {
+			if !strings.EqualFold(fields[2], "hold") {
+				return nil, fmt.Errorf("invalid retention rule %q: unknown option %q", entry, fields[2])
+			}
+			legalHold = "true"
+		}
+
+		policy, err := parseRetentionPolicy(fields[0], fields[1], legalHold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention rule %q: %w", entry, err)
+		}
+
+		parsed = append(parsed, RetentionRule{Prefix: normalizeKey(strings.Trim(strings.TrimSpace(prefix), `/\`)), Policy: policy})
+	}
+	return parsed, nil
+}
+
+// FormatRetentionRules formats rules in the form accepted by ParseRetentionRules.
+func FormatRetentionRules(rules []RetentionRule) string {
+	entries := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		entry := fmt.Sprintf("%s=%s:%d", rule.Prefix, rule.Policy.Mode, rule.Policy.Days)
+		if rule.Policy.LegalHold {
+			entry += ":hold"
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ";")
+}
+
+// parseRetentionPolicy validates a single mode, retention period and legal hold setting.
+func parseRetentionPolicy(mode, days, legalHold string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+
+	mode = strings.ToUpper(strings.TrimSpace(mode))
+	if mode != "" {
+		policy.Mode = minio.RetentionMode(mode)
+		if !policy.Mode.IsValid() {
+			return policy, fmt.Errorf("unknown retention mode %q: must be GOVERNANCE or COMPLIANCE", mode)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(days))
+		if err != nil || n < 1 {
+			return policy, fmt.Errorf("retention days must be a positive number, got %q", days)
+		}
+		policy.Days = n
+	}
+
+	if legalHold != "" {
+		hold, err := strconv.ParseBool(legalHold)
+		if err != nil {
+			return policy, fmt.Errorf("legal hold must be true or false, got %q", legalHold)
+		}
+		policy.LegalHold = hold
+	}
+
+	return policy, nil
+}
+
+// PolicyFor returns the retention policy for the given object key. The rule with the longest
+// matching folder prefix wins; if no rule matches, the default policy is returned.
+func (l *ObjectLock) PolicyFor(relativePath string) RetentionPolicy {
+	key := normalizeKey(relativePath)
+	policy := l.Default
+	matched := -1
+	for _, rule := range l.Rules {
+		if (key == rule.Prefix || strings.HasPrefix(key, rule.Prefix+"/")) && len(rule.Prefix) > matched {
+			policy = rule.Policy
+			matched = len(rule.Prefix)
+		}
+	}
+	return policy
+}
+
+// putObjectOptions returns the upload options that apply the retention policy for the given object key.
+func (l *ObjectLock) putObjectOptions(relativePath string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{}
+	policy := l.PolicyFor(relativePath)
+	if policy.Mode != "" {
+		opts.Mode = policy.Mode
+		opts.RetainUntilDate = time.Now().UTC().AddDate(0, 0, policy.Days)
+	}
+	if policy.LegalHold {
+		opts.LegalHold = minio.LegalHoldEnabled
+	}
+	return opts
+}
+
+// ensureObjectLock verifies that Object Lock is enabled on the bucket. Object Lock can only be turned on
+// when a bucket is created, so an existing bucket without it cannot be used in WORM mode.
+func ensureObjectLock(client *minio.Client, bucketName string) error {
+	status, _, _, _, err := client.GetObjectLockConfig(context.Background(), bucketName)
+	if err != nil {
+		return fmt.Errorf("bucket %s does not have Object Lock enabled (it can only be enabled when the bucket is created): %w", bucketName, err)
+	}
+	if status != "Enabled" {
+		return fmt.Errorf("bucket %s does not have Object Lock enabled (it can only be enabled when the bucket is created)", bucketName)
+	}
+	return nil
+}
+
+// normalizeKey converts an object key to forward slashes so that rules match regardless of the
+// path separator used when the key was built.
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(key, `\`, "/")
+}
@@ -0,0 +1,93 @@
+package minisync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []RetentionRule
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"blank entries", " ; ;", nil, false},
+		{
+			"single rule",
+			"Docs=GOVERNANCE:30",
+			[]RetentionRule{{Prefix: "Docs", Policy: RetentionPolicy{Mode: minio.Governance, Days: 30}}},
+			false,
+		},
+		{
+			"several rules with legal hold",
+			"Photos=COMPLIANCE:365:hold; Docs=governance:30",
+			[]RetentionRule{
+				{Prefix: "Photos", Policy: RetentionPolicy{Mode: minio.Compliance, Days: 365, LegalHold: true}},
+				{Prefix: "Docs", Policy: RetentionPolicy{Mode: minio.Governance, Days: 30}},
+			},
+			false,
+		},
+		{
+			"Windows folder with slashes",
+			`\Work\Reports\=GOVERNANCE:7:HOLD`,
+			[]RetentionRule{{Prefix: "Work/Reports", Policy: RetentionPolicy{Mode: minio.Governance, Days: 7, LegalHold: true}}},
+			false,
+		},
+		{"missing folder", "=GOVERNANCE:30", nil, true},
+		{"missing settings", "Docs", nil, true},
+		{"missing days", "Docs=GOVERNANCE", nil, true},
+		{"too many fields", "Docs=GOVERNANCE:30:hold:x", nil, true},
+		{"unknown option", "Docs=GOVERNANCE:30:keep", nil, true},
+		{"unknown mode", "Docs=FOREVER:30", nil, true},
+		{"zero days", "Docs=GOVERNANCE:0", nil, true},
+		{"days not a number", "Docs=GOVERNANCE:month", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetentionRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRetentionRules(%q) error = %v, wantErr %v", tt.rules, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRetentionRules(%q) = %+v, want %+v", tt.rules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	defaultPolicy := RetentionPolicy{Mode: minio.Governance, Days: 30}
+	photos := RetentionPolicy{Mode: minio.Compliance, Days: 365}
+	raw := RetentionPolicy{LegalHold: true}
+	lock := &ObjectLock{
+		Default: defaultPolicy,
+		Rules: []RetentionRule{
+			{Prefix: "Photos/Raw", Policy: raw},
+			{Prefix: "Photos", Policy: photos},
+		},
+	}
+
+	tests := []struct {
+		key  string
+		want RetentionPolicy
+	}{
+		{"notes.txt", defaultPolicy},
+		{"Photos", photos},
+		{"Photos/beach.jpg", photos},
+		{`Photos\beach.jpg`, photos},
+		{"Photos/Raw/beach.dng", raw},
+		{`Photos\Raw\beach.dng`, raw},
+		{"Photos/RawExports/beach.jpg", photos},
+		{"PhotosOld/beach.jpg", defaultPolicy},
+		{"Docs/Photos/beach.jpg", defaultPolicy},
+	}
+	for _, tt := range tests {
+		if got := lock.PolicyFor(tt.key); got != tt.want {
+			t.Errorf("PolicyFor(%q) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -2,44 +2,124 @@ package minisync
 
 import (
 	"context"
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mwiater/minisync/minisyncService/logging"
 )
 
+// minioLog is the log of the MinIO clients.
+var minioLog = logging.For(logging.MinIO)
+
 // MinioClient wraps the MinIO client and provides additional context for operations on a specific bucket.
-// It includes the MinIO client instance and the name of the bucket being operated on.
+// It holds one MinIO client per cluster node and the name of the bucket being operated on. Use Client to
+// get the client of the currently active node.
 type MinioClient struct {
-	Client     *minio.Client // Client is the MinIO client instance used to interact with MinIO.
-	BucketName string        // BucketName is the name of the bucket where operations are performed.
+	BucketName string           // BucketName is the name of the bucket where operations are performed.
+	Lock       *ObjectLock      // Lock is the Object Lock configuration, or nil when WORM mode is disabled.
+	Strategy   EndpointStrategy // Strategy selects failover (the default) or round-robin over the nodes.
+
+	mu     sync.Mutex
+	nodes  []*minioNode
+	active int
 }
 
-// NewMinioClient creates a new MinioClient with the specified endpoint, access key, secret key, and bucket name.
-// If the specified bucket does not exist, it attempts to create it. If the bucket already exists, it logs the information.
-func NewMinioClient(endpoint, accessKey, secretKey, bucketName string) (*MinioClient, error) {
-	log.Printf("Creating MinIO client with endpoint: %s", endpoint)
+// ModTimeMetadata is the user metadata that every uploaded object carries with the modification time of the
+// local file it was uploaded from, so that a full sync can tell an unchanged file from a changed one without
+// uploading it again.
+const ModTimeMetadata = "Mtime"
 
-	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: false,
-	})
+// NewMinioClient creates a new MinioClient with the specified endpoints, access key, secret key, and bucket name.
+// Every endpoint is a node of the same cluster and is health-checked in the background; requests go to a healthy node.
+// If the specified bucket does not exist, it attempts to create it. If the bucket already exists, it logs the information.
+// When lock is non-nil, a new bucket is created with Object Lock enabled and an existing bucket must already have it.
+func NewMinioClient(endpoints []string, accessKey, secretKey, bucketName string, lock *ObjectLock) (*MinioClient, error) {
+	c, err := newMinioClient(endpoints, accessKey, secretKey, bucketName, true)
 	if err != nil {
-		log.Printf("Error creating MinIO client with endpoint: %s, accessKey: %s", endpoint, accessKey)
 		return nil, err
 	}
+	c.Lock = lock
 
-	err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{})
+	minioClient := c.Client()
+	err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{ObjectLocking: lock != nil})
 	if err != nil {
 		exists, errBucketExists := minioClient.BucketExists(context.Background(), bucketName)
 		if errBucketExists == nil && exists {
-			log.Printf("We already own %s\n", bucketName)
+			minioLog.Debug("Bucket already exists", "bucket", bucketName)
 		} else {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if lock != nil {
+		err = ensureObjectLock(minioClient, bucketName)
+		if err != nil {
+			c.Close()
 			return nil, err
 		}
+		minioLog.Info("Object Lock enabled", "bucket", bucketName)
 	}
 
-	return &MinioClient{Client: minioClient, BucketName: bucketName}, nil
+	return c, nil
+}
+
+// NewReadOnlyMinioClient creates a MinioClient for browsing, sharing and reporting on an existing bucket. Unlike
+// NewMinioClient it never tries to create the bucket and starts no health checks, so it is cheap to create and
+// needs no Close. Without health checks every node is considered online.
+func NewReadOnlyMinioClient(endpoints []string, accessKey, secretKey, bucketName string) (*MinioClient, error) {
+	return newMinioClient(endpoints, accessKey, secretKey, bucketName, false)
+}
+
+// newMinioClient creates a MinioClient with one node per endpoint, health-checking every node in the
+// background if healthCheck is true.
+func newMinioClient(endpoints []string, accessKey, secretKey, bucketName string, healthCheck bool) (*MinioClient, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no MinIO endpoint configured")
+	}
+
+	c := &MinioClient{BucketName: bucketName, Strategy: Failover}
+	for _, endpoint := range endpoints {
+		minioLog.Info("Creating MinIO client", "endpoint", endpoint, "healthCheck", healthCheck)
+
+		host, secure, err := ParseEndpoint(endpoint)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		minioClient, err := minio.New(host, &minio.Options{
+			Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+			Secure: secure,
+		})
+		if err != nil {
+			minioLog.Error("Failed to create MinIO client", "endpoint", endpoint, "accessKey", accessKey, "error", err)
+			c.Close()
+			return nil, err
+		}
+
+		node := &minioNode{endpoint: endpoint, client: minioClient}
+		if healthCheck {
+			node.cancelHealthCheck, err = minioClient.HealthCheck(healthCheckInterval)
+			if err != nil {
+				minioLog.Warn("Failed to start health check", "endpoint", endpoint, "error", err)
+			}
+			if minioClient.IsOffline() {
+				minioLog.Warn("MinIO endpoint is offline", "endpoint", endpoint)
+			}
+		}
+		c.nodes = append(c.nodes, node)
+	}
+	return c, nil
 }
 
 // CreateFile uploads a new file to MinIO, effectively the same as uploading a file.
@@ -71,14 +151,79 @@ func (c *MinioClient) RenameFile(oldRelativePath, newRelativePath, newFilePath s
 
 // UploadFile uploads a file to the specified bucket in MinIO, preserving the directory structure.
 // The relativePath parameter specifies the path within the bucket, and filePath is the local file path to be uploaded.
+// When Object Lock is enabled, the uploaded version carries the retention and legal hold for its folder.
 func (c *MinioClient) UploadFile(relativePath, filePath string) error {
-	_, err := c.Client.FPutObject(context.Background(), c.BucketName, relativePath, filePath, minio.PutObjectOptions{})
+	_, err := c.UploadFileWithProgress(context.Background(), relativePath, filePath, nil)
 	return err
 }
 
+// UploadFileWithProgress uploads a file like UploadFile until ctx is cancelled. If progress is not nil, it
+// is read from as the file is sent, one byte for every byte uploaded. The object records the modification
+// time of the file in ModTimeMetadata. It returns the hex-encoded SHA-256 of the content uploaded, which is
+// computed as the file is read, so it matches what was stored even if the file changes afterwards.
+func (c *MinioClient) UploadFileWithProgress(ctx context.Context, relativePath, filePath string, progress io.Reader) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", wrapError("upload", relativePath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", wrapError("upload", relativePath, err)
+	}
+
+	opts := minio.PutObjectOptions{}
+	if c.Lock != nil {
+		opts = c.Lock.putObjectOptions(relativePath)
+	}
+	opts.Progress = progress
+	opts.UserMetadata = map[string]string{ModTimeMetadata: info.ModTime().UTC().Format(time.RFC3339Nano)}
+	opts.ContentType = mime.TypeByExtension(filepath.Ext(filePath))
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+
+	hash := sha256.New()
+	_, err = c.Client().PutObject(ctx, c.BucketName, relativePath, io.TeeReader(f, hash), info.Size(), opts)
+	if err != nil {
+		return "", wrapError("upload", relativePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // DeleteFile deletes a file from the specified bucket in MinIO, preserving the directory structure.
 // The relativePath parameter specifies the path within the bucket to the file to be deleted.
+// No version ID is ever passed, so on an Object Lock (versioned) bucket this only adds a delete marker
+// and the retained versions stay in place.
 func (c *MinioClient) DeleteFile(relativePath string) error {
-	err := c.Client.RemoveObject(context.Background(), c.BucketName, relativePath, minio.RemoveObjectOptions{})
-	return err
+	return c.DeleteFileContext(context.Background(), relativePath)
+}
+
+// DeleteFileContext deletes a file like DeleteFile until ctx is cancelled.
+func (c *MinioClient) DeleteFileContext(ctx context.Context, relativePath string) error {
+	err := c.Client().RemoveObject(ctx, c.BucketName, relativePath, minio.RemoveObjectOptions{})
+	return wrapError("delete", relativePath, err)
+}
+
+// UploadedModTime returns the modification time of the local file an object was uploaded from, as recorded
+// in ModTimeMetadata. It reports false for objects uploaded without it, such as by an earlier version.
+func UploadedModTime(info minio.ObjectInfo) (time.Time, bool) {
+	value, ok := info.UserMetadata[ModTimeMetadata]
+	if !ok {
+		return time.Time{}, false
+	}
+	modTime, err := time.Parse(time.RFC3339Nano, value)
+	return modTime, err == nil
+}
+
+// StatObject returns the metadata of the object at relativePath. A missing object is reported as an
+// error matching ErrNotFound.
+func (c *MinioClient) StatObject(relativePath string) (minio.ObjectInfo, error) {
+	return c.StatObjectContext(context.Background(), relativePath)
+}
+
+// StatObjectContext returns the metadata of an object like StatObject until ctx is cancelled.
+func (c *MinioClient) StatObjectContext(ctx context.Context, relativePath string) (minio.ObjectInfo, error) {
+	info, err := c.Client().StatObject(ctx, c.BucketName, relativePath, minio.StatObjectOptions{})
+	return info, wrapError("stat", relativePath, err)
 }
@@ -2,115 +2,191 @@ package minisync
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/minio/minio-go/v7"
+	"github.com/mwiater/minisync/minisyncService/logging"
 )
 
+// monitorLog is the log of the folder watcher.
+var monitorLog = logging.For(logging.Monitor)
+
 // MonitorDirectory monitors the specified directory for changes and synchronizes those changes
 // to MinIO. It watches for changes in both the directory and its subdirectories, responding to
-// events such as file creation, modification, deletion, and renaming.
-func MonitorDirectory(sourceFolder string, minioClient *MinioClient) {
+// events such as file creation, modification, deletion, and renaming. Changes are passed to syncer,
+// which is either a single MinioClient or a Replicator fanning out to several destinations.
+// The monitor's health is recorded in health, which may be nil.
+// It returns when ctx is cancelled, or with an error if the directory cannot be watched.
+func MonitorDirectory(ctx context.Context, sourceFolder string, syncer Syncer, health *WatcherHealth) (err error) {
+	health.started(sourceFolder)
+	defer func() { health.stopped(err) }()
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 	defer watcher.Close()
 
-	err = filepath.Walk(sourceFolder, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			err = watcher.Add(path)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-		return nil
-	})
+	m := &monitor{sourceFolder: sourceFolder, watcher: watcher, syncer: syncer, dirs: map[string]bool{}, health: health, log: monitorLog.With("folder", sourceFolder)}
+	err = m.watchTree(sourceFolder, false)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to watch %s: %w", sourceFolder, err)
 	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
 		case event, ok := <-watcher.Events:
 			if !ok {
-				return
+				return fmt.Errorf("watcher closed unexpectedly")
 			}
-			handleEvent(sourceFolder, event, watcher, minioClient)
+			m.handleEvent(event)
+			health.event()
 		case err, ok := <-watcher.Errors:
 			if !ok {
-				return
+				return fmt.Errorf("watcher closed unexpectedly")
+			}
+			m.log.Warn("Watcher error", "error", err)
+			health.failed(err)
+		}
+	}
+}
+
+// monitor holds the state of a running MonitorDirectory.
+type monitor struct {
+	sourceFolder string
+	watcher      *fsnotify.Watcher
+	syncer       Syncer
+	dirs         map[string]bool // dirs maps watched folders to true and removed folders to false, so that removed folders can be told from files.
+	health       *WatcherHealth
+	log          *slog.Logger
+}
+
+// countWatched reports the number of watched folders to the monitor's health.
+func (m *monitor) countWatched() {
+	watched := 0
+	for _, w := range m.dirs {
+		if w {
+			watched++
+		}
+	}
+	m.health.watching(watched)
+}
+
+// watchTree adds a watcher to root and every folder below it. With queueFiles set, the files found are
+// queued for upload, as they are when a folder with content is moved into the backup folder.
+func (m *monitor) watchTree(root string, queueFiles bool) error {
+	defer m.countWatched()
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			err = m.watcher.Add(path)
+			if err != nil {
+				return err
+			}
+			m.dirs[path] = true
+		} else if queueFiles {
+			relativePath, err := filepath.Rel(m.sourceFolder, path)
+			if err == nil {
+				err = m.syncer.CreateFile(relativePath, path)
 			}
-			log.Println("Error:", err)
+			if err != nil {
+				m.log.Error("Failed to queue upload", "path", path, "error", err)
+			}
+		}
+		return nil
+	})
+}
+
+// unwatchTree drops the watchers of path and every folder below it after they were removed or renamed.
+// The folders stay marked as removed, because a removed folder can be reported both by its own watcher
+// and by its parent's; the second report is ignored by handleEvent.
+func (m *monitor) unwatchTree(path string) {
+	prefix := path + string(filepath.Separator)
+	for dir, watched := range m.dirs {
+		if watched && (dir == path || strings.HasPrefix(dir, prefix)) {
+			m.watcher.Remove(dir)
+			m.dirs[dir] = false
 		}
 	}
+	m.countWatched()
 }
 
 // handleEvent processes file system events and performs the appropriate MinIO operations
 // based on the type of event. It handles file creation, modification, deletion, and renaming
 // while preserving the directory structure in MinIO.
-func handleEvent(sourceFolder string, event fsnotify.Event, watcher *fsnotify.Watcher, minioClient *MinioClient) {
-	relativePath, err := filepath.Rel(sourceFolder, event.Name)
+func (m *monitor) handleEvent(event fsnotify.Event) {
+	relativePath, err := filepath.Rel(m.sourceFolder, event.Name)
 	if err != nil {
-		log.Printf("Failed to get relative path for %s: %v", event.Name, err)
+		m.log.Error("Failed to get relative path", "path", event.Name, "error", err)
+		return
+	}
+
+	watched, known := m.dirs[event.Name]
+	if known && !watched && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(m.dirs, event.Name)
 		return
 	}
 
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
-		log.Println("Created file:", event.Name)
+		m.log.Info("Created file", "path", event.Name)
 		if !isDir(event.Name) {
-			err := minioClient.CreateFile(relativePath, event.Name)
+			err := m.syncer.CreateFile(relativePath, event.Name)
 			if err != nil {
-				log.Printf("Failed to upload file: %v", err)
+				m.log.Error("Failed to queue upload", "path", event.Name, "error", err)
 			}
 		} else {
-			err = watcher.Add(event.Name)
+			err = m.watchTree(event.Name, true)
 			if err != nil {
-				log.Printf("Failed to watch new directory: %v", err)
+				m.log.Error("Failed to watch new directory", "path", event.Name, "error", err)
 			}
 		}
 	case event.Op&fsnotify.Write == fsnotify.Write:
-		log.Println("Modified file:", event.Name)
+		m.log.Info("Modified file", "path", event.Name)
 		if !isDir(event.Name) {
-			err := minioClient.UpdateFile(relativePath, event.Name)
+			err := m.syncer.UpdateFile(relativePath, event.Name)
 			if err != nil {
-				log.Printf("Failed to upload file: %v", err)
+				m.log.Error("Failed to queue upload", "path", event.Name, "error", err)
 			}
 		}
 	case event.Op&fsnotify.Remove == fsnotify.Remove:
-		log.Println("Deleted file or directory:", event.Name)
-		if !isDir(event.Name) {
-			err := minioClient.DeleteFile(relativePath)
+		m.log.Info("Deleted file or directory", "path", event.Name)
+		if !watched {
+			err := m.syncer.DeleteFile(relativePath)
 			if err != nil {
-				log.Printf("Failed to delete file: %v", err)
+				m.log.Error("Failed to queue delete", "path", event.Name, "error", err)
 			}
 		} else {
 			// Handle directory deletion by deleting all files under that directory in MinIO
-			err := minioClient.DeleteDirectory(relativePath)
+			m.unwatchTree(event.Name)
+			err := m.syncer.DeleteDirectory(relativePath)
 			if err != nil {
-				log.Printf("Failed to delete directory %s in MinIO: %v", relativePath, err)
+				m.log.Error("Failed to queue delete of directory", "path", event.Name, "error", err)
 			}
 		}
 	case event.Op&fsnotify.Rename == fsnotify.Rename:
-		log.Println("Renamed file or directory:", event.Name)
-		if !isDir(event.Name) {
-			err := minioClient.DeleteFile(relativePath)
+		m.log.Info("Renamed file or directory", "path", event.Name)
+		if !watched {
+			err := m.syncer.DeleteFile(relativePath)
 			if err != nil {
-				log.Printf("Failed to delete old file after rename: %v", err)
+				m.log.Error("Failed to queue delete of renamed file", "path", event.Name, "error", err)
 			}
 			// Note: In this simplified version, we assume the new file will be handled separately by a Create event.
 		} else {
 			// Handle directory rename by deleting the old directory and expecting the new one to be created
-			err := minioClient.DeleteDirectory(relativePath)
+			m.unwatchTree(event.Name)
+			err := m.syncer.DeleteDirectory(relativePath)
 			if err != nil {
-				log.Printf("Failed to delete old directory after rename: %v", err)
+				m.log.Error("Failed to queue delete of renamed directory", "path", event.Name, "error", err)
 			}
 			// Note: The new directory should trigger a Create event
 		}
@@ -118,28 +194,39 @@ func handleEvent(sourceFolder string, event fsnotify.Event, watcher *fsnotify.Wa
 }
 
 // DeleteDirectory deletes all files in the specified directory from the MinIO bucket.
+// It carries on past individual failures and returns the first one, so that the caller can retry.
 func (c *MinioClient) DeleteDirectory(relativePath string) error {
-	doneCh := make(chan struct{})
-	defer close(doneCh)
+	return c.DeleteDirectoryContext(context.Background(), relativePath)
+}
+
+// DeleteDirectoryContext deletes a directory like DeleteDirectory until ctx is cancelled.
+func (c *MinioClient) DeleteDirectoryContext(ctx context.Context, relativePath string) error {
+	var firstErr error
 
-	objectCh := c.Client.ListObjects(context.Background(), c.BucketName, minio.ListObjectsOptions{
+	objectCh := c.Client().ListObjects(ctx, c.BucketName, minio.ListObjectsOptions{
 		Prefix:    relativePath + "/", // Ensure we're only deleting within this directory
 		Recursive: true,
 	})
 
 	for object := range objectCh {
 		if object.Err != nil {
-			log.Printf("Error listing objects in directory %s: %v", relativePath, object.Err)
+			minioLog.Error("Failed to list objects in directory", "bucket", c.BucketName, "path", relativePath, "error", object.Err)
+			if firstErr == nil {
+				firstErr = wrapError("list", relativePath, object.Err)
+			}
 			continue
 		}
 
-		err := c.DeleteFile(object.Key)
+		err := c.DeleteFileContext(ctx, object.Key)
 		if err != nil {
-			log.Printf("Failed to delete file %s: %v", object.Key, err)
+			minioLog.Error("Failed to delete object", "bucket", c.BucketName, "path", object.Key, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
 	}
 
-	return nil
+	return firstErr
 }
 
 // isDir checks if the specified path is a directory. It returns true if the path
@@ -0,0 +1,841 @@
+package minisync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/logging"
+)
+
+// Syncer is implemented by anything that can mirror local file changes to remote storage.
+// Both MinioClient (a single, synchronous target) and Replicator (a fan-out to queued destinations)
+// satisfy it, so MonitorDirectory does not need to know how many targets are configured.
+type Syncer interface {
+	CreateFile(relativePath, filePath string) error
+	UpdateFile(relativePath, filePath string) error
+	DeleteFile(relativePath string) error
+	DeleteDirectory(relativePath string) error
+}
+
+// OperationKind identifies the kind of change queued for a destination.
+type OperationKind string
+
+const (
+	// OpUpload uploads a new local file, creating the remote object.
+	OpUpload OperationKind = "upload"
+
+	// OpUpdate uploads a changed local file, replacing the remote object.
+	OpUpdate OperationKind = "update"
+
+	// OpDelete deletes a single remote object.
+	OpDelete OperationKind = "delete"
+
+	// OpDeleteDirectory deletes every remote object under a folder.
+	OpDeleteDirectory OperationKind = "deleteDirectory"
+)
+
+const (
+	maxAttempts    = 10              // maxAttempts is how often an operation is tried before it is dropped.
+	statusInterval = 5 * time.Second // statusInterval is how often the status file is rewritten.
+	statusFileName = "MiniSyncStatus.json"
+	recentErrors   = 20 // recentErrors is how many failures each destination remembers.
+)
+
+// Delays between retries of a failed operation. They are variables so that tests can shorten them.
+var (
+	initialBackoff = 2 * time.Second // initialBackoff is the delay before the first retry.
+	maxBackoff     = 5 * time.Minute // maxBackoff caps the exponential delay between retries.
+)
+
+// stopTimeout is how long Stop waits for a worker to return after cancelling its operation in flight.
+const stopTimeout = 30 * time.Second
+
+// replicatorLog is the log of the destination queues and workers.
+var replicatorLog = logging.For(logging.Replicator)
+
+// Operation is a single change waiting to be applied to a destination.
+type Operation struct {
+	ID           string        `json:"id"`             // ID identifies the operation in the log.
+	Kind         OperationKind `json:"kind"`           // Kind is the type of change.
+	RelativePath string        `json:"relativePath"`   // RelativePath is the object key within the bucket.
+	FilePath     string        `json:"filePath"`       // FilePath is the local file for uploads.
+	Queued       time.Time     `json:"queued"`         // Queued is when the change was first queued.
+	Attempts     int           `json:"attempts"`       // Attempts is how often the change has been tried.
+	Hash         string        `json:"hash,omitempty"` // Hash is the SHA-256 of the file as uploaded, set once an upload succeeded.
+}
+
+// Uploads reports whether the operation uploads a local file.
+func (k OperationKind) Uploads() bool {
+	return k == OpUpload || k == OpUpdate
+}
+
+// DestinationConfig describes a backup target as it is stored in the configuration.
+type DestinationConfig struct {
+	Name       string   `json:"name"`                // Name identifies the destination in logs and status output.
+	Endpoints  []string `json:"endpoints"`           // Endpoints are the MinIO host:port nodes of the cluster.
+	BucketName string   `json:"bucketName"`          // BucketName is the bucket objects are written to.
+	AccessKey  string   `json:"accessKey"`           // AccessKey is the MinIO access key.
+	SecretKey  string   `json:"secretKey,omitempty"` // SecretKey is the MinIO secret key. It is kept in the secret store, never in the configuration file.
+}
+
+// String describes the destination for logs without its secret key.
+func (d DestinationConfig) String() string {
+	return fmt.Sprintf("%s (%s/%s, access key %s)", d.Name, strings.Join(d.Endpoints, ","), d.BucketName, d.AccessKey)
+}
+
+// DestinationStatus is a point-in-time view of a destination's queue and health.
+type DestinationStatus struct {
+	Profile        string           `json:"profile"`        // Profile is the profile the destination belongs to.
+	Name           string           `json:"name"`           // Name identifies the destination.
+	Endpoint       string           `json:"endpoint"`       // Endpoint is the host:port of the active cluster node.
+	Endpoints      []EndpointStatus `json:"endpoints"`      // Endpoints is the health of every cluster node.
+	BucketName     string           `json:"bucketName"`     // BucketName is the target bucket.
+	Pending        int              `json:"pending"`        // Pending is the number of queued operations.
+	LagSeconds     float64          `json:"lagSeconds"`     // LagSeconds is the age of the oldest queued operation.
+	Retrying       bool             `json:"retrying"`       // Retrying is true while the head of the queue is backing off.
+	NextRetry      time.Time        `json:"nextRetry"`      // NextRetry is when the next attempt is due while retrying.
+	LastSuccess    time.Time        `json:"lastSuccess"`    // LastSuccess is when an operation last completed.
+	LastError      string           `json:"lastError"`      // LastError is the most recent failure message.
+	LastErrorClass ErrorClass       `json:"lastErrorClass"` // LastErrorClass is the class of LastError.
+	LastErrorTime  time.Time        `json:"lastErrorTime"`  // LastErrorTime is when LastError occurred.
+	Completed      int              `json:"completed"`      // Completed counts operations applied since start.
+	Dropped        int              `json:"dropped"`        // Dropped counts operations given up on since start.
+	NextFullSync   time.Time        `json:"nextFullSync"`   // NextFullSync is when the profile's next full sync cycle is due.
+	Reachable      bool             `json:"reachable"`      // Reachable is true while at least one cluster node is online.
+	LastFullSync   time.Time        `json:"lastFullSync"`   // LastFullSync is when the last successful full sync cycle finished.
+	FullSyncTime   float64          `json:"fullSyncTime"`   // FullSyncTime is how many seconds the last successful full sync cycle took.
+	FullSyncError  string           `json:"fullSyncError"`  // FullSyncError is why the last full sync cycle failed, or empty if it succeeded.
+	UploadsToday   int              `json:"uploadsToday"`   // UploadsToday counts the files uploaded since local midnight.
+	BytesToday     int64            `json:"bytesToday"`     // BytesToday is the size of the files uploaded since local midnight.
+	Transfer       *Transfer        `json:"transfer"`       // Transfer is the upload in progress, or nil.
+	RecentErrors   []ErrorEvent     `json:"recentErrors"`   // RecentErrors are the most recent failures, newest first.
+}
+
+// Transfer is an upload in progress.
+type Transfer struct {
+	RelativePath string    `json:"relativePath"` // RelativePath is the object key being written.
+	Size         int64     `json:"size"`         // Size is the size of the file.
+	Sent         int64     `json:"sent"`         // Sent is how many bytes have been uploaded so far.
+	Started      time.Time `json:"started"`      // Started is when the upload started.
+}
+
+// ErrorEvent is a single failure of a destination.
+type ErrorEvent struct {
+	Time         time.Time  `json:"time"`         // Time is when the failure occurred.
+	Operation    string     `json:"operation"`    // Operation is the kind of operation that failed, or "fullSync".
+	RelativePath string     `json:"relativePath"` // RelativePath is the object key involved, if any.
+	Class        ErrorClass `json:"class"`        // Class is the class of the failure.
+	Message      string     `json:"message"`      // Message is the error message.
+}
+
+// Observer is told about every attempt of a destination to apply an operation, for example to export
+// metrics. It is called from the destination's worker and must not block.
+type Observer interface {
+	// Applied reports an attempt to apply op for a destination of a profile: the number of bytes uploaded,
+	// how long the attempt took and its error, if it failed.
+	Applied(profile, destination string, op Operation, bytes int64, took time.Duration, err error)
+}
+
+// Observers passes every attempt on to each of its observers in turn.
+type Observers []Observer
+
+// Applied calls Applied of every observer.
+func (o Observers) Applied(profile, destination string, op Operation, bytes int64, took time.Duration, err error) {
+	for _, observer := range o {
+		observer.Applied(profile, destination, op, bytes, took, err)
+	}
+}
+
+// Destination is a single backup target with its own queue, worker and retry state, so that a slow
+// or unreachable target never holds up the others.
+type Destination struct {
+	Name string // Name identifies the destination in logs and status output.
+
+	mu       sync.Mutex
+	client   *MinioClient
+	queue    []Operation
+	notify   chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	status   DestinationStatus
+	inFlight bool
+	paused   bool
+	today    string             // today is the local date the daily upload counters belong to.
+	profile  string             // profile is the name of the profile the destination belongs to, passed to observer.
+	observer Observer           // observer is told about every attempt to apply an operation, if set.
+	worker   int                // worker counts the workers started; a worker that is no longer the latest exits.
+	progress time.Time          // progress is when the operation in flight started or last uploaded bytes.
+	cancel   context.CancelFunc // cancel cancels the operation in flight, if any.
+}
+
+// Stall describes a destination worker whose operation in flight stopped making progress.
+type Stall struct {
+	Destination string    // Destination is the name of the destination.
+	Operation   Operation // Operation is the operation that stalled.
+	Since       time.Time // Since is when the operation last made progress.
+}
+
+// NewDestination creates a Destination for the given client. Call Start to begin processing its queue.
+func NewDestination(name string, client *MinioClient) *Destination {
+	return &Destination{
+		Name:   name,
+		client: client,
+		notify: make(chan struct{}, 1),
+		status: DestinationStatus{Name: name, BucketName: client.BucketName},
+	}
+}
+
+// Client returns the client that performs the operations against the destination bucket.
+func (d *Destination) Client() *MinioClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.client
+}
+
+// SetClient replaces the destination's client, for example after its endpoints changed, and returns the
+// previous one for the caller to close. Queued operations are kept and applied with the new client.
+func (d *Destination) SetClient(client *MinioClient) *MinioClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous := d.client
+	d.client = client
+	d.status.BucketName = client.BucketName
+	return previous
+}
+
+// Enqueue adds an operation to the end of the destination's queue and returns its ID, which the log records
+// of the operation carry. If an operation for the same key is already waiting (and not in flight), it is
+// removed in favour of the newer one, which keeps its original queue time; an update replacing a waiting
+// upload stays an upload, because the remote object does not exist yet. The newer operation still goes to
+// the end of the queue, so that it is never applied before an operation queued after the one it replaces,
+// such as the delete of its folder.
+func (d *Destination) Enqueue(kind OperationKind, relativePath, filePath string) string {
+	d.mu.Lock()
+	op := Operation{ID: logging.NewID(), Kind: kind, RelativePath: relativePath, FilePath: filePath, Queued: time.Now()}
+	replaced := ""
+	for i := range d.queue {
+		if i == 0 && d.inFlight {
+			continue
+		}
+		if d.queue[i].RelativePath == relativePath {
+			replaced = d.queue[i].ID
+			op.Queued = d.queue[i].Queued
+			if kind == OpUpdate && d.queue[i].Kind == OpUpload {
+				op.Kind = OpUpload
+			}
+			d.queue = append(d.queue[:i:i], d.queue[i+1:]...)
+			break
+		}
+	}
+	d.queue = append(d.queue, op)
+	log := d.log(op)
+	d.mu.Unlock()
+
+	if replaced != "" {
+		log.Debug("Replaced queued operation", "replaced", replaced)
+	} else {
+		log.Debug("Queued operation")
+	}
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+	return op.ID
+}
+
+// log returns the log of an operation of the destination. The caller must hold d.mu.
+func (d *Destination) log(op Operation) *slog.Logger {
+	return replicatorLog.With("profile", d.profile, "destination", d.Name, "op", op.ID, "kind", op.Kind, "path", op.RelativePath)
+}
+
+// SetPaused pauses or resumes the destination's worker. While paused, changes are still queued but not
+// applied; an operation already in flight completes.
+func (d *Destination) SetPaused(paused bool) {
+	d.mu.Lock()
+	d.paused = paused
+	d.mu.Unlock()
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// observe directs the attempts of the destination to apply operations to observer.
+func (d *Destination) observe(profile string, observer Observer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.profile = profile
+	d.observer = observer
+}
+
+// Queue returns a copy of the operations waiting to be applied, the one in flight first.
+func (d *Destination) Queue() []Operation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Operation(nil), d.queue...)
+}
+
+// Start launches the destination's worker goroutine.
+func (d *Destination) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.start()
+}
+
+// start launches a new worker. The caller must hold d.mu.
+func (d *Destination) start() {
+	d.worker++
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go d.run(d.worker, d.stop, d.done)
+}
+
+// Stop signals the worker to exit, cancels its operation in flight and waits up to stopTimeout for it to
+// return. A worker that does not return in time is abandoned and exits without touching the queue once
+// its operation returns. Queued operations are discarded; the next full sync cycle will queue anything that
+// is still out of date.
+func (d *Destination) Stop() {
+	d.mu.Lock()
+	if d.stop == nil {
+		d.mu.Unlock()
+		return
+	}
+	close(d.stop)
+	d.stop = nil
+	if d.cancel != nil {
+		d.cancel()
+	}
+	done, log := d.done, replicatorLog.With("profile", d.profile, "destination", d.Name)
+	d.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		d.mu.Lock()
+		d.worker++
+		d.mu.Unlock()
+		log.Warn("Worker did not stop in time, abandoning it", "timeout", stopTimeout)
+	}
+}
+
+// restartStalled cancels the operation in flight if it has made no progress for longer than timeout, and
+// replaces the worker with a new one. The stall counts as a failed attempt: the new worker tries the
+// operation again unless it used up its attempts. The abandoned worker exits once its operation returns,
+// without touching the queue. It never waits for the abandoned worker.
+func (d *Destination) restartStalled(timeout time.Duration) (Stall, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop == nil || !d.inFlight || time.Since(d.progress) <= timeout {
+		return Stall{}, false
+	}
+	stall := Stall{Destination: d.Name, Operation: d.queue[0], Since: d.progress}
+	d.cancel()
+	d.cancel = nil
+	d.inFlight = false
+	d.status.Transfer = nil
+	d.queue[0].Attempts++
+	d.recordError(string(stall.Operation.Kind), stall.Operation.RelativePath, ClassNetwork,
+		fmt.Errorf("no progress for %s, restarted the worker", time.Since(stall.Since).Round(time.Second)))
+	if d.queue[0].Attempts >= maxAttempts {
+		d.log(stall.Operation).Error("Giving up on stalled operation", "attempts", d.queue[0].Attempts)
+		d.queue = d.queue[1:]
+		d.status.Dropped++
+		d.status.Retrying = false
+	}
+
+	close(d.stop)
+	d.start()
+	return stall, true
+}
+
+// Status returns a snapshot of the destination's queue and health.
+func (d *Destination) Status() DestinationStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := d.status
+	status.Endpoint = d.client.ActiveEndpoint()
+	status.Endpoints = d.client.EndpointStatus()
+	for _, endpoint := range status.Endpoints {
+		status.Reachable = status.Reachable || endpoint.Online
+	}
+	if d.today != time.Now().Format(time.DateOnly) {
+		status.UploadsToday, status.BytesToday = 0, 0
+	}
+	if d.status.Transfer != nil {
+		transfer := *d.status.Transfer
+		status.Transfer = &transfer
+	}
+	status.RecentErrors = append([]ErrorEvent(nil), d.status.RecentErrors...)
+	status.Pending = len(d.queue)
+	if len(d.queue) > 0 {
+		oldest := d.queue[0].Queued
+		for _, op := range d.queue {
+			if op.Queued.Before(oldest) {
+				oldest = op.Queued
+			}
+		}
+		status.LagSeconds = time.Since(oldest).Seconds()
+	}
+	return status
+}
+
+// run processes the queue in order. A failing operation stays at the head of the queue and is retried
+// with exponential backoff, so later changes to the same destination are never applied out of order.
+func (d *Destination) run(worker int, stop, done chan struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		d.mu.Lock()
+		if len(d.queue) == 0 || d.paused {
+			d.mu.Unlock()
+			select {
+			case <-d.notify:
+				continue
+			case <-stop:
+				return
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		d.inFlight = true
+		d.cancel = cancel
+		d.progress = time.Now()
+		op := d.queue[0]
+		profile, observer, log := d.profile, d.observer, d.log(op)
+		d.mu.Unlock()
+
+		started := time.Now()
+		bytes, hash, err := d.apply(ctx, worker, op)
+		took := time.Since(started)
+		// An operation cancelled by Stop or the watchdog is not an attempt of its own: Stop leaves it to the
+		// next full sync cycle and the watchdog already recorded the stall.
+		cancelled := err != nil && ctx.Err() != nil
+		cancel()
+		op.Hash = hash
+		if observer != nil && !cancelled {
+			observer.Applied(profile, d.Name, op, bytes, took, err)
+		}
+
+		d.mu.Lock()
+		if d.worker != worker {
+			// The watchdog gave up on this worker while the operation was stuck and started a new one.
+			d.mu.Unlock()
+			log.Warn("Abandoned worker finished its operation", "took", took, "error", err)
+			return
+		}
+		d.inFlight = false
+		d.cancel = nil
+		if cancelled {
+			d.mu.Unlock()
+			log.Info("Cancelled operation", "took", took)
+			return
+		}
+		if err == nil {
+			log.Info("Applied operation", "bytes", bytes, "took", took)
+			d.queue = d.queue[1:]
+			d.status.Completed++
+			d.status.LastSuccess = time.Now()
+			d.status.Retrying = false
+			d.mu.Unlock()
+			continue
+		}
+
+		op.Attempts++
+		class := Classify(err)
+		d.recordError(string(op.Kind), op.RelativePath, class, err)
+		if op.Attempts >= maxAttempts || !class.Retryable() || errors.Is(err, fs.ErrNotExist) {
+			log.Error("Giving up on operation", "attempts", op.Attempts, "class", class, "error", err)
+			d.queue = d.queue[1:]
+			d.status.Dropped++
+			d.status.Retrying = false
+			d.mu.Unlock()
+			continue
+		}
+
+		d.queue[0] = op
+		backoff := retryDelay(op.Attempts, class)
+		d.status.Retrying = true
+		d.status.NextRetry = time.Now().Add(backoff)
+		d.mu.Unlock()
+
+		log.Warn("Failed to apply operation, retrying", "attempt", op.Attempts, "backoff", backoff, "class", class, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying an operation that failed for the attempts-th time
+// with an error of class: initialBackoff, doubled for every further attempt and capped at maxBackoff.
+func retryDelay(attempts int, class ErrorClass) time.Duration {
+	backoff := initialBackoff << (attempts - 1)
+	if class == ClassThrottled || class == ClassQuota {
+		// The server is overloaded or full; give it longer to recover than a dropped connection.
+		backoff *= 4
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// apply performs a single queued operation for worker against the destination bucket until ctx is
+// cancelled and returns the number of bytes uploaded and the SHA-256 of the uploaded file. Uploads are
+// reported as the current transfer while they run, and counted in the daily totals once they succeed,
+// unless the worker was abandoned meanwhile.
+func (d *Destination) apply(ctx context.Context, worker int, op Operation) (int64, string, error) {
+	client := d.Client()
+	switch op.Kind {
+	case OpUpload, OpUpdate:
+		info, err := os.Stat(op.FilePath)
+		if err != nil {
+			return 0, "", err
+		}
+		d.mu.Lock()
+		d.status.Transfer = &Transfer{RelativePath: op.RelativePath, Size: info.Size(), Started: time.Now()}
+		d.mu.Unlock()
+
+		hash, err := client.UploadFileWithProgress(ctx, op.RelativePath, op.FilePath, progressReader{d, worker})
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.worker != worker {
+			return 0, "", err
+		}
+		d.status.Transfer = nil
+		if err != nil {
+			return 0, "", err
+		}
+		today := time.Now().Format(time.DateOnly)
+		if d.today != today {
+			d.today = today
+			d.status.UploadsToday, d.status.BytesToday = 0, 0
+		}
+		d.status.UploadsToday++
+		d.status.BytesToday += info.Size()
+		return info.Size(), hash, nil
+	case OpDelete:
+		return 0, "", client.DeleteFileContext(ctx, op.RelativePath)
+	case OpDeleteDirectory:
+		return 0, "", client.DeleteDirectoryContext(ctx, op.RelativePath)
+	default:
+		return 0, "", fmt.Errorf("unknown operation %q", op.Kind)
+	}
+}
+
+// progressReader counts the bytes the MinIO client reports as uploaded by a worker into the current
+// transfer. Once the worker has been abandoned, its progress is no longer counted.
+type progressReader struct {
+	d      *Destination
+	worker int
+}
+
+// Read adds len(p) to the bytes sent of the current transfer.
+func (r progressReader) Read(p []byte) (int, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if r.d.worker != r.worker {
+		return len(p), nil
+	}
+	if r.d.status.Transfer != nil {
+		r.d.status.Transfer.Sent += int64(len(p))
+	}
+	r.d.progress = time.Now()
+	return len(p), nil
+}
+
+// recordError records a failure as the destination's last error and adds it to its recent errors. The
+// caller must hold d.mu.
+func (d *Destination) recordError(operation, relativePath string, class ErrorClass, err error) {
+	now := time.Now()
+	d.status.LastError = err.Error()
+	d.status.LastErrorClass = class
+	d.status.LastErrorTime = now
+
+	event := ErrorEvent{Time: now, Operation: operation, RelativePath: relativePath, Class: class, Message: err.Error()}
+	d.status.RecentErrors = append([]ErrorEvent{event}, d.status.RecentErrors...)
+	if len(d.status.RecentErrors) > recentErrors {
+		d.status.RecentErrors = d.status.RecentErrors[:recentErrors]
+	}
+}
+
+// RecordFullSync records the outcome of a full sync cycle against the destination that started at started.
+func (d *Destination) RecordFullSync(started time.Time, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.status.FullSyncError = err.Error()
+		d.recordError("fullSync", "", Classify(err), err)
+		return
+	}
+	d.status.LastFullSync = time.Now()
+	d.status.FullSyncTime = time.Since(started).Seconds()
+	d.status.FullSyncError = ""
+}
+
+// Replicator fans every change out to all of its destinations. Each destination queues and retries
+// independently. Destinations can be added and removed while the replicator is running. Changes to files
+// the filter does not select are ignored, and deletes are ignored in Backup mode.
+type Replicator struct {
+	Profile  string   // Profile is the name of the profile the replicator belongs to, reported in its status.
+	Observer Observer // Observer is told about every operation of every destination, if set before Start.
+
+	mu           sync.Mutex
+	destinations []*Destination
+	started      bool
+	paused       bool
+	filter       Filter
+	mode         SyncMode
+}
+
+// NewReplicator creates a Replicator in Mirror mode without a filter for the given destinations.
+func NewReplicator(destinations ...*Destination) *Replicator {
+	return &Replicator{destinations: destinations, mode: Mirror}
+}
+
+// SetPolicy replaces the filter and sync mode applied to later changes.
+func (r *Replicator) SetPolicy(filter Filter, mode SyncMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filter = filter
+	r.mode = mode
+}
+
+// Policy returns the filter and sync mode applied to changes.
+func (r *Replicator) Policy() (Filter, SyncMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.filter, r.mode
+}
+
+// Destinations returns the targets every change is replicated to.
+func (r *Replicator) Destinations() []*Destination {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Destination(nil), r.destinations...)
+}
+
+// Destination returns the destination with the given name, or nil.
+func (r *Replicator) Destination(name string) *Destination {
+	for _, d := range r.Destinations() {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Add adds a destination, starting its worker if the replicator is running. Changes made before it was
+// added are not queued on it; the next full sync cycle brings it up to date.
+func (r *Replicator) Add(d *Destination) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.destinations = append(r.destinations, d)
+	d.SetPaused(r.paused)
+	d.observe(r.Profile, r.Observer)
+	if r.started {
+		d.Start()
+	}
+}
+
+// SetPaused pauses or resumes every destination. Destinations added while paused start paused.
+func (r *Replicator) SetPaused(paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = paused
+	for _, d := range r.destinations {
+		d.SetPaused(paused)
+	}
+}
+
+// Remove removes the destination with the given name, so that no more changes are queued on it, and returns
+// it, or nil if there is none. Its worker keeps running until the caller stops it with Stop, which waits for
+// the operation in flight and so must not be called while holding a lock that status requests need.
+func (r *Replicator) Remove(name string) *Destination {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.destinations {
+		if d.Name == name {
+			r.destinations = append(r.destinations[:i:i], r.destinations[i+1:]...)
+			return d
+		}
+	}
+	return nil
+}
+
+// Start launches the worker of every destination.
+func (r *Replicator) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = true
+	for _, d := range r.destinations {
+		d.observe(r.Profile, r.Observer)
+		d.Start()
+	}
+}
+
+// RestartStalled restarts the worker of every destination whose operation in flight has made no progress
+// for longer than timeout, and returns the stalled operations.
+func (r *Replicator) RestartStalled(timeout time.Duration) []Stall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		return nil
+	}
+
+	var stalls []Stall
+	for _, d := range r.destinations {
+		if stall, ok := d.restartStalled(timeout); ok {
+			stalls = append(stalls, stall)
+		}
+	}
+	return stalls
+}
+
+// Stop stops the worker of every destination, cancelling their operations in flight. The destinations are
+// stopped together and without holding the replicator's lock, so that its status stays available.
+func (r *Replicator) Stop() {
+	r.mu.Lock()
+	r.started = false
+	destinations := append([]*Destination(nil), r.destinations...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, d := range destinations {
+		wg.Add(1)
+		go func(d *Destination) {
+			defer wg.Done()
+			d.Stop()
+		}(d)
+	}
+	wg.Wait()
+}
+
+// CreateFile queues an upload of a new file on every destination.
+func (r *Replicator) CreateFile(relativePath, filePath string) error {
+	r.enqueue(OpUpload, relativePath, filePath)
+	return nil
+}
+
+// UpdateFile queues an update of a changed file on every destination.
+func (r *Replicator) UpdateFile(relativePath, filePath string) error {
+	r.enqueue(OpUpdate, relativePath, filePath)
+	return nil
+}
+
+// DeleteFile queues a delete of a file on every destination.
+func (r *Replicator) DeleteFile(relativePath string) error {
+	r.enqueue(OpDelete, relativePath, "")
+	return nil
+}
+
+// DeleteDirectory queues a delete of a folder on every destination.
+func (r *Replicator) DeleteDirectory(relativePath string) error {
+	r.enqueue(OpDeleteDirectory, relativePath, "")
+	return nil
+}
+
+// enqueue adds the operation to every destination's queue, unless the filter or sync mode rules it out.
+// Folder deletes are not filtered, because excluded files are never uploaded in the first place.
+func (r *Replicator) enqueue(kind OperationKind, relativePath, filePath string) {
+	filter, mode := r.Policy()
+	if !kind.Uploads() && !mode.Deletes() {
+		return
+	}
+	if kind != OpDeleteDirectory && !filter.Match(relativePath) {
+		return
+	}
+	for _, d := range r.Destinations() {
+		d.Enqueue(kind, relativePath, filePath)
+	}
+}
+
+// Status returns the status of every destination.
+func (r *Replicator) Status() []DestinationStatus {
+	destinations := r.Destinations()
+	statuses := make([]DestinationStatus, 0, len(destinations))
+	for _, d := range destinations {
+		status := d.Status()
+		status.Profile = r.Profile
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// WriteStatusFile periodically writes the status of every destination as JSON to MiniSyncStatus.json in
+// logFolder, where the GUI reads it. It returns when ctx is cancelled.
+func (r *Replicator) WriteStatusFile(ctx context.Context, logFolder string) {
+	WriteStatusFile(ctx, logFolder, r.Status)
+}
+
+// WriteStatusFile periodically writes the destination statuses returned by status as JSON to
+// MiniSyncStatus.json in logFolder, so that the destinations of several replicators share one file. It
+// returns when ctx is cancelled.
+func WriteStatusFile(ctx context.Context, logFolder string, status func() []DestinationStatus) {
+	path := StatusFilePath(logFolder)
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := json.MarshalIndent(status(), "", "  ")
+		if err != nil {
+			replicatorLog.Error("Failed to encode status", "error", err)
+			continue
+		}
+
+		// Write to a temporary file first so that readers never see a partially written file.
+		tmpPath := path + ".tmp"
+		err = os.WriteFile(tmpPath, data, 0644)
+		if err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+		if err != nil {
+			replicatorLog.Error("Failed to write status file", "path", path, "error", err)
+		}
+	}
+}
+
+// StatusFilePath returns the location of the status file within logFolder.
+func StatusFilePath(logFolder string) string {
+	return filepath.Join(logFolder, statusFileName)
+}
+
+// ReadStatusFile reads the destination statuses last written by the service to logFolder.
+func ReadStatusFile(logFolder string) ([]DestinationStatus, error) {
+	data, err := os.ReadFile(StatusFilePath(logFolder))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status file: %w", err)
+	}
+
+	var statuses []DestinationStatus
+	err = json.Unmarshal(data, &statuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status file: %w", err)
+	}
+	return statuses, nil
+}
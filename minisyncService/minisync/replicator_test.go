@@ -0,0 +1,258 @@
+package minisync
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeS3 returns a client of a fake S3 server that answers bucket location requests itself and passes
+// every other request to handle.
+func newFakeS3(t *testing.T, handle http.HandlerFunc) *MinioClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewReadOnlyMinioClient([]string{server.URL}, "minisync", "secret", "backups")
+	if err != nil {
+		t.Fatalf("NewReadOnlyMinioClient() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// s3Error writes an S3 error response with the given status and code.
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+// shortBackoff shortens the delays between retries for the duration of the test.
+func shortBackoff(t *testing.T) {
+	initial, max := initialBackoff, maxBackoff
+	initialBackoff, maxBackoff = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { initialBackoff, maxBackoff = initial, max })
+}
+
+// waitFor fails the test unless done reports true within five seconds.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// recordingObserver records the error of every attempt it is told about.
+type recordingObserver struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Applied records err.
+func (o *recordingObserver) Applied(profile, destination string, op Operation, bytes int64, took time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.errs = append(o.errs, err)
+}
+
+// attempts returns the errors of the attempts recorded so far.
+func (o *recordingObserver) attempts() []error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]error(nil), o.errs...)
+}
+
+// queued returns the kind and key of every operation in queue.
+func queued(queue []Operation) []string {
+	var ops []string
+	for _, op := range queue {
+		ops = append(ops, string(op.Kind)+" "+op.RelativePath)
+	}
+	return ops
+}
+
+func TestEnqueueCoalesces(t *testing.T) {
+	d := NewDestination("primary", &MinioClient{BucketName: "backups"})
+	d.Enqueue(OpUpload, "a.txt", "/data/a.txt")
+	first := d.Queue()[0]
+	d.Enqueue(OpUpload, "docs/report.pdf", "/data/docs/report.pdf")
+	d.Enqueue(OpDeleteDirectory, "docs", "")
+	d.Enqueue(OpDelete, "b.txt", "")
+	id := d.Enqueue(OpUpdate, "a.txt", "/data/a.txt")
+	d.Enqueue(OpUpdate, "docs/report.pdf", "/data/docs/report.pdf")
+
+	queue := d.Queue()
+	want := []string{"deleteDirectory docs", "delete b.txt", "upload a.txt", "upload docs/report.pdf"}
+	if got := queued(queue); !reflect.DeepEqual(got, want) {
+		t.Fatalf("queue = %q, want %q", got, want)
+	}
+	if a := queue[2]; a.ID != id || a.ID == first.ID || !a.Queued.Equal(first.Queued) {
+		t.Errorf("replacement = %+v, want ID %s and the queue time of %+v", a, id, first)
+	}
+}
+
+func TestEnqueueKeepsOperationInFlight(t *testing.T) {
+	d := NewDestination("primary", &MinioClient{BucketName: "backups"})
+	d.Enqueue(OpUpload, "a.txt", "/data/a.txt")
+	d.mu.Lock()
+	d.inFlight = true
+	d.mu.Unlock()
+	d.Enqueue(OpUpdate, "a.txt", "/data/a.txt")
+	d.Enqueue(OpDelete, "a.txt", "")
+
+	want := []string{"upload a.txt", "delete a.txt"}
+	if got := queued(d.Queue()); !reflect.DeepEqual(got, want) {
+		t.Errorf("queue = %q, want %q", got, want)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		class    ErrorClass
+		want     time.Duration
+	}{
+		{1, ClassNetwork, 2 * time.Second},
+		{2, ClassNetwork, 4 * time.Second},
+		{4, ClassUnknown, 16 * time.Second},
+		{1, ClassThrottled, 8 * time.Second},
+		{3, ClassQuota, 32 * time.Second},
+		{9, ClassNetwork, maxBackoff},
+		{maxAttempts, ClassThrottled, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts, tt.class); got != tt.want {
+			t.Errorf("retryDelay(%d, %s) = %v, want %v", tt.attempts, tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestDestinationRetriesFailedOperation(t *testing.T) {
+	shortBackoff(t)
+	var mu sync.Mutex
+	requests := 0
+	client := newFakeS3(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		failing := requests <= 2
+		mu.Unlock()
+		if failing {
+			s3Error(w, http.StatusBadRequest, "Unavailable")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	observer := &recordingObserver{}
+	d := NewDestination("primary", client)
+	d.observe("default", observer)
+	d.Start()
+	defer d.Stop()
+	d.Enqueue(OpDelete, "a.txt", "")
+
+	waitFor(t, "the delete to complete", func() bool { return d.Status().Completed == 1 })
+	status := d.Status()
+	if status.Pending != 0 || status.Dropped != 0 || status.Retrying || len(status.RecentErrors) != 2 || status.RecentErrors[0].Class != ClassUnknown {
+		t.Errorf("Status() = %+v, want the delete completed after two failures", status)
+	}
+	if attempts := observer.attempts(); len(attempts) != 3 || attempts[0] == nil || attempts[1] == nil || attempts[2] != nil {
+		t.Errorf("observed attempts = %v, want two failures and a success", attempts)
+	}
+}
+
+func TestDestinationDropsOperation(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		code     string
+		attempts int
+	}{
+		{"not retryable", http.StatusForbidden, "AccessDenied", 1},
+		{"out of attempts", http.StatusBadRequest, "Unavailable", maxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shortBackoff(t)
+			var mu sync.Mutex
+			requests := 0
+			client := newFakeS3(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				mu.Unlock()
+				s3Error(w, tt.status, tt.code)
+			})
+
+			d := NewDestination("primary", client)
+			d.Start()
+			defer d.Stop()
+			d.Enqueue(OpDelete, "a.txt", "")
+
+			waitFor(t, "the delete to be dropped", func() bool { return d.Status().Dropped == 1 })
+			if status := d.Status(); status.Pending != 0 || status.Completed != 0 {
+				t.Errorf("Status() = %+v, want only the dropped delete", status)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if requests != tt.attempts {
+				t.Errorf("delete tried %d times, want %d", requests, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestDestinationRestartsStalledWorker(t *testing.T) {
+	stuck := make(chan struct{})
+	var once sync.Once
+	client := newFakeS3(t, func(w http.ResponseWriter, r *http.Request) {
+		first := false
+		once.Do(func() { first = true })
+		if first {
+			close(stuck)
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	observer := &recordingObserver{}
+	d := NewDestination("primary", client)
+	d.observe("default", observer)
+	d.Start()
+	defer d.Stop()
+	d.Enqueue(OpDelete, "a.txt", "")
+	<-stuck
+
+	if _, ok := d.restartStalled(time.Hour); ok {
+		t.Fatalf("restartStalled() restarted a worker that made progress within the timeout")
+	}
+	time.Sleep(time.Millisecond)
+	stall, ok := d.restartStalled(0)
+	if !ok || stall.Destination != "primary" || stall.Operation.RelativePath != "a.txt" {
+		t.Fatalf("restartStalled() = %+v, %v, want the stalled delete", stall, ok)
+	}
+
+	waitFor(t, "the delete to complete", func() bool { return d.Status().Completed == 1 })
+	status := d.Status()
+	if status.Dropped != 0 || len(status.RecentErrors) != 1 || status.RecentErrors[0].Class != ClassNetwork {
+		t.Errorf("Status() = %+v, want the stall recorded and the delete completed", status)
+	}
+	if attempts := observer.attempts(); len(attempts) != 1 || attempts[0] != nil {
+		t.Errorf("observed attempts = %v, want only the successful one", attempts)
+	}
+}
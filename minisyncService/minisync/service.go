@@ -0,0 +1,51 @@
+package minisync
+
+// ServiceStatus represents the status of a service as a string.
+type ServiceStatus string
+
+const (
+	// StatusNotInstalled indicates that the service is not installed on the system.
+	StatusNotInstalled ServiceStatus = "NotInstalled"
+
+	// StatusStopped indicates that the service is installed but currently stopped.
+	StatusStopped ServiceStatus = "Stopped"
+
+	// StatusRunning indicates that the service is currently running.
+	StatusRunning ServiceStatus = "Running"
+
+	// StatusPaused indicates that the service is currently paused.
+	StatusPaused ServiceStatus = "Paused"
+)
+
+// ServiceInfo describes the service to the operating system's service manager.
+type ServiceInfo struct {
+	Name        string // Name is the name the service is registered under.
+	DisplayName string // DisplayName is the name shown in the service manager.
+	Description string // Description explains what the service does.
+}
+
+// ServiceManager installs, controls and queries the MiniSync service through the operating system's
+// service manager: the Service Control Manager on Windows and systemd elsewhere.
+type ServiceManager interface {
+	// Install registers exePath, started with args, as an automatically started service.
+	Install(exePath string, args ...string) error
+	// Uninstall removes the service registration.
+	Uninstall() error
+	// Start starts the service.
+	Start() error
+	// Stop stops the service and waits until it has stopped.
+	Stop() error
+	// Pause suspends the service without stopping it.
+	Pause() error
+	// Continue resumes a paused service.
+	Continue() error
+	// Status returns the current state of the service.
+	Status() (ServiceStatus, error)
+}
+
+// GetServiceStatus returns the status of the service with the given name, one of the predefined statuses
+// (Running, Stopped, Paused, or NotInstalled).
+func GetServiceStatus(serviceName string) (string, error) {
+	status, err := NewServiceManager(ServiceInfo{Name: serviceName}).Status()
+	return string(status), err
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package minisync
+
+// NewServiceManager returns the ServiceManager of this platform for the described service.
+func NewServiceManager(info ServiceInfo) ServiceManager {
+	return NewSystemdManager(info, DefaultUnitDir)
+}
@@ -0,0 +1,235 @@
+package minisync
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultUnitDir is the folder systemd loads system service units from.
+const DefaultUnitDir = "/etc/systemd/system"
+
+// DefaultEnvironmentFile is the file of environment variables, such as the passphrase of the file secret
+// store, that the installed service is started with. It sits next to the configuration file.
+const DefaultEnvironmentFile = "/etc/minisync/minisync.env"
+
+// Pauser pauses and resumes a running service through an API the service offers. systemd can only pause a
+// service by freezing its processes, which would also stop it from noticing and queueing changes.
+type Pauser interface {
+	// SetPaused pauses or resumes syncing.
+	SetPaused(paused bool) error
+	// Paused reports whether syncing is paused.
+	Paused() (bool, error)
+}
+
+// SystemdManager manages a service through systemd. Install writes a unit file to UnitDir, and every other
+// operation runs systemctl, except pausing, which goes through Pauser.
+type SystemdManager struct {
+	Info            ServiceInfo // Info describes the service.
+	UnitDir         string      // UnitDir is the folder the unit file is written to.
+	EnvironmentFile string      // EnvironmentFile is loaded into the environment of the service if it exists; empty for none.
+	Pauser          Pauser      // Pauser pauses and resumes the running service; nil if it cannot be paused.
+
+	// Systemctl runs systemctl with the given arguments and returns its combined output. It can be replaced
+	// to install units somewhere systemd does not look, for example a temporary folder.
+	Systemctl func(args ...string) ([]byte, error)
+}
+
+// NewSystemdManager returns a SystemdManager that writes the unit of the described service to unitDir. The
+// unit loads DefaultEnvironmentFile.
+func NewSystemdManager(info ServiceInfo, unitDir string) *SystemdManager {
+	return &SystemdManager{Info: info, UnitDir: unitDir, EnvironmentFile: DefaultEnvironmentFile, Systemctl: runSystemctl}
+}
+
+// runSystemctl runs the systemctl command.
+func runSystemctl(args ...string) ([]byte, error) {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// UnitName returns the name of the service's unit, such as "MiniSync.service".
+func (m *SystemdManager) UnitName() string {
+	return m.Info.Name + ".service"
+}
+
+// UnitPath returns the path of the service's unit file.
+func (m *SystemdManager) UnitPath() string {
+	return filepath.Join(m.UnitDir, m.UnitName())
+}
+
+// Unit returns the unit file that runs exePath with args. The service starts once the network is up, with
+// the variables of the environment file if there is one, and is restarted if it fails.
+func (m *SystemdManager) Unit(exePath string, args ...string) string {
+	command := []string{systemdQuote(exePath)}
+	for _, arg := range args {
+		command = append(command, systemdQuote(arg))
+	}
+
+	var unit strings.Builder
+	unit.WriteString("[Unit]\n")
+	fmt.Fprintf(&unit, "Description=%s\n", strings.ReplaceAll(m.description(), "%", "%%"))
+	unit.WriteString("Wants=network-online.target\n")
+	unit.WriteString("After=network-online.target\n")
+	unit.WriteString("\n[Service]\n")
+	unit.WriteString("Type=simple\n")
+	if m.EnvironmentFile != "" {
+		fmt.Fprintf(&unit, "EnvironmentFile=-%s\n", strings.ReplaceAll(m.EnvironmentFile, "%", "%%"))
+	}
+	fmt.Fprintf(&unit, "ExecStart=%s\n", strings.Join(command, " "))
+	unit.WriteString("Restart=on-failure\n")
+	unit.WriteString("RestartSec=10\n")
+	unit.WriteString("\n[Install]\n")
+	unit.WriteString("WantedBy=multi-user.target\n")
+	return unit.String()
+}
+
+// description returns the one-line description of the unit.
+func (m *SystemdManager) description() string {
+	switch {
+	case m.Info.DisplayName != "" && m.Info.Description != "":
+		return m.Info.DisplayName + " - " + m.Info.Description
+	case m.Info.DisplayName != "":
+		return m.Info.DisplayName
+	case m.Info.Description != "":
+		return m.Info.Description
+	}
+	return m.Info.Name
+}
+
+// Install writes the unit file, reloads systemd and enables the service so that it starts at boot.
+func (m *SystemdManager) Install(exePath string, args ...string) error {
+	path := m.UnitPath()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("service %s already exists", m.Info.Name)
+	} else if err != nil {
+		return fmt.Errorf("failed to create unit file: %w", err)
+	}
+	_, err = file.WriteString(m.Unit(exePath, args...))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+
+	_, err = m.Systemctl("daemon-reload")
+	if err == nil {
+		_, err = m.Systemctl("enable", m.UnitName())
+	}
+	if err != nil {
+		os.Remove(path)
+		m.Systemctl("daemon-reload")
+		return err
+	}
+	return nil
+}
+
+// Uninstall disables the service, removes its unit file and reloads systemd. A running service keeps
+// running until it is stopped.
+func (m *SystemdManager) Uninstall() error {
+	path := m.UnitPath()
+	_, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", m.Info.Name)
+	}
+
+	_, err = m.Systemctl("disable", m.UnitName())
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	_, err = m.Systemctl("daemon-reload")
+	return err
+}
+
+// Start starts the service.
+func (m *SystemdManager) Start() error {
+	_, err := m.Systemctl("start", m.UnitName())
+	return err
+}
+
+// Stop stops the service. systemctl waits until it has stopped.
+func (m *SystemdManager) Stop() error {
+	_, err := m.Systemctl("stop", m.UnitName())
+	return err
+}
+
+// Pause asks the running service to pause syncing. It keeps running and queueing changes.
+func (m *SystemdManager) Pause() error {
+	return m.setPaused(true)
+}
+
+// Continue asks a paused service to resume syncing.
+func (m *SystemdManager) Continue() error {
+	return m.setPaused(false)
+}
+
+// setPaused pauses or resumes the running service through Pauser.
+func (m *SystemdManager) setPaused(paused bool) error {
+	if m.Pauser == nil {
+		return fmt.Errorf("service %s cannot be paused", m.Info.Name)
+	}
+	return m.Pauser.SetPaused(paused)
+}
+
+// Status asks systemd for the load and active state of the service, and a running service whether it is
+// paused. A running service that does not answer, for example because it is still starting, is reported
+// as running.
+func (m *SystemdManager) Status() (ServiceStatus, error) {
+	output, err := m.Systemctl("show", "--property=LoadState,ActiveState", m.UnitName())
+	if err != nil {
+		return "", err
+	}
+	status, err := parseSystemdStatus(output)
+	if err != nil || status != StatusRunning || m.Pauser == nil {
+		return status, err
+	}
+	if paused, err := m.Pauser.Paused(); err == nil && paused {
+		return StatusPaused, nil
+	}
+	return StatusRunning, nil
+}
+
+// parseSystemdStatus maps the output of `systemctl show` to a ServiceStatus. A service that is starting,
+// reloading or stopping is reported in the state it is moving to.
+func parseSystemdStatus(output []byte) (ServiceStatus, error) {
+	properties := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			properties[key] = value
+		}
+	}
+
+	if properties["LoadState"] == "not-found" {
+		return StatusNotInstalled, nil
+	}
+	switch properties["ActiveState"] {
+	case "active", "activating", "reloading":
+		return StatusRunning, nil
+	case "inactive", "failed", "deactivating":
+		return StatusStopped, nil
+	}
+	return "", fmt.Errorf("unable to determine service status")
+}
+
+// systemdQuote quotes a command line word for ExecStart, escaping the characters systemd would otherwise
+// expand as specifiers or variables.
+func systemdQuote(word string) string {
+	word = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(word)
+	return `"` + word + `"`
+}
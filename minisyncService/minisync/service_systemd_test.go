@@ -0,0 +1,266 @@
+package minisync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSystemctl records the systemctl commands run by a SystemdManager and fails the ones listed in fail.
+type fakeSystemctl struct {
+	calls []string         // calls are the commands run, with their arguments joined by spaces.
+	fail  map[string]error // fail maps a command to the error it returns.
+}
+
+// run stands in for runSystemctl.
+func (f *fakeSystemctl) run(args ...string) ([]byte, error) {
+	command := strings.Join(args, " ")
+	f.calls = append(f.calls, command)
+	return nil, f.fail[command]
+}
+
+// newTestManager returns a SystemdManager that writes its unit to a temporary folder and runs a fake
+// systemctl.
+func newTestManager(t *testing.T) (*SystemdManager, *fakeSystemctl) {
+	t.Helper()
+	systemctl := &fakeSystemctl{fail: map[string]error{}}
+	m := NewSystemdManager(ServiceInfo{Name: "MiniSync", DisplayName: "MiniSync", Description: "Syncs folders"}, t.TempDir())
+	m.Systemctl = systemctl.run
+	return m, systemctl
+}
+
+func TestSystemdUnit(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.Info.Description = "Syncs 100% of files"
+
+	want := `[Unit]
+Description=MiniSync - Syncs 100%% of files
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+EnvironmentFile=-/etc/minisync/minisync.env
+ExecStart="/opt/mini sync/minisync" "run" "-config" "$$HOME/%%h.json" "say \"hi\" \\"
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`
+	got := m.Unit("/opt/mini sync/minisync", "run", "-config", "$HOME/%h.json", `say "hi" \`)
+	if got != want {
+		t.Errorf("Unit() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSystemdUnitDescription(t *testing.T) {
+	tests := []struct {
+		info ServiceInfo
+		want string
+	}{
+		{ServiceInfo{Name: "MiniSync", DisplayName: "MiniSync", Description: "Syncs folders"}, "MiniSync - Syncs folders"},
+		{ServiceInfo{Name: "MiniSync", DisplayName: "MiniSync"}, "MiniSync"},
+		{ServiceInfo{Name: "MiniSync", Description: "Syncs folders"}, "Syncs folders"},
+		{ServiceInfo{Name: "MiniSync"}, "MiniSync"},
+	}
+	for _, tt := range tests {
+		m := &SystemdManager{Info: tt.info}
+		if !strings.Contains(m.Unit("/usr/bin/minisync"), "\nDescription="+tt.want+"\n") {
+			t.Errorf("Unit() with %+v does not have description %q", tt.info, tt.want)
+		}
+	}
+}
+
+func TestSystemdInstallUninstall(t *testing.T) {
+	m, systemctl := newTestManager(t)
+
+	err := m.Install("/usr/bin/minisync", "run")
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(m.UnitDir, "MiniSync.service"))
+	if err != nil {
+		t.Fatalf("unit file not written: %v", err)
+	}
+	if string(data) != m.Unit("/usr/bin/minisync", "run") {
+		t.Errorf("unit file =\n%s\nwant\n%s", data, m.Unit("/usr/bin/minisync", "run"))
+	}
+	if want := []string{"daemon-reload", "enable MiniSync.service"}; !reflect.DeepEqual(systemctl.calls, want) {
+		t.Errorf("Install() ran %q, want %q", systemctl.calls, want)
+	}
+
+	err = m.Install("/usr/bin/minisync", "run")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second Install() error = %v, want already exists", err)
+	}
+
+	systemctl.calls = nil
+	err = m.Uninstall()
+	if err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if _, err := os.Stat(m.UnitPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unit file still exists after Uninstall(): %v", err)
+	}
+	if want := []string{"disable MiniSync.service", "daemon-reload"}; !reflect.DeepEqual(systemctl.calls, want) {
+		t.Errorf("Uninstall() ran %q, want %q", systemctl.calls, want)
+	}
+
+	err = m.Uninstall()
+	if err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("second Uninstall() error = %v, want not installed", err)
+	}
+}
+
+func TestSystemdInstallEnableFails(t *testing.T) {
+	m, systemctl := newTestManager(t)
+	enableErr := errors.New("enable failed")
+	systemctl.fail["enable MiniSync.service"] = enableErr
+
+	err := m.Install("/usr/bin/minisync")
+	if !errors.Is(err, enableErr) {
+		t.Fatalf("Install() error = %v, want %v", err, enableErr)
+	}
+	if _, err := os.Stat(m.UnitPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unit file left behind after a failed Install(): %v", err)
+	}
+	if want := []string{"daemon-reload", "enable MiniSync.service", "daemon-reload"}; !reflect.DeepEqual(systemctl.calls, want) {
+		t.Errorf("Install() ran %q, want %q", systemctl.calls, want)
+	}
+}
+
+func TestSystemdUninstallDisableFails(t *testing.T) {
+	m, systemctl := newTestManager(t)
+	err := m.Install("/usr/bin/minisync")
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	disableErr := errors.New("disable failed")
+	systemctl.fail["disable MiniSync.service"] = disableErr
+
+	err = m.Uninstall()
+	if !errors.Is(err, disableErr) {
+		t.Fatalf("Uninstall() error = %v, want %v", err, disableErr)
+	}
+	if _, err := os.Stat(m.UnitPath()); err != nil {
+		t.Errorf("unit file removed although disabling failed: %v", err)
+	}
+}
+
+// fakePauser records whether the service was paused and fails with err, if not nil.
+type fakePauser struct {
+	paused bool
+	err    error
+}
+
+// SetPaused records paused.
+func (p *fakePauser) SetPaused(paused bool) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.paused = paused
+	return nil
+}
+
+// Paused returns the recorded state.
+func (p *fakePauser) Paused() (bool, error) {
+	return p.paused, p.err
+}
+
+func TestSystemdPauseContinue(t *testing.T) {
+	m, systemctl := newTestManager(t)
+	err := m.Pause()
+	if err == nil || !strings.Contains(err.Error(), "cannot be paused") {
+		t.Errorf("Pause() without a Pauser error = %v, want cannot be paused", err)
+	}
+
+	pauser := &fakePauser{}
+	m.Pauser = pauser
+	if err := m.Pause(); err != nil || !pauser.paused {
+		t.Errorf("Pause() error = %v, paused = %v, want the service paused", err, pauser.paused)
+	}
+	if err := m.Continue(); err != nil || pauser.paused {
+		t.Errorf("Continue() error = %v, paused = %v, want the service resumed", err, pauser.paused)
+	}
+	if len(systemctl.calls) != 0 {
+		t.Errorf("Pause() and Continue() ran %q, want no systemctl commands", systemctl.calls)
+	}
+
+	pauser.err = errors.New("not running")
+	if err := m.Pause(); !errors.Is(err, pauser.err) {
+		t.Errorf("Pause() error = %v, want %v", err, pauser.err)
+	}
+}
+
+func TestSystemdStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		pauser *fakePauser
+		want   ServiceStatus
+	}{
+		{"running without a Pauser", "LoadState=loaded\nActiveState=active\n", nil, StatusRunning},
+		{"running", "LoadState=loaded\nActiveState=active\n", &fakePauser{}, StatusRunning},
+		{"paused", "LoadState=loaded\nActiveState=active\n", &fakePauser{paused: true}, StatusPaused},
+		{"not answering", "LoadState=loaded\nActiveState=activating\n", &fakePauser{paused: true, err: errors.New("not running")}, StatusRunning},
+		{"stopped", "LoadState=loaded\nActiveState=inactive\n", &fakePauser{paused: true}, StatusStopped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewSystemdManager(ServiceInfo{Name: "MiniSync"}, t.TempDir())
+			var calls []string
+			m.Systemctl = func(args ...string) ([]byte, error) {
+				calls = append(calls, strings.Join(args, " "))
+				return []byte(tt.output), nil
+			}
+			if tt.pauser != nil {
+				m.Pauser = tt.pauser
+			}
+
+			got, err := m.Status()
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Status() = %q, want %q", got, tt.want)
+			}
+			if want := []string{"show --property=LoadState,ActiveState MiniSync.service"}; !reflect.DeepEqual(calls, want) {
+				t.Errorf("Status() ran %q, want %q", calls, want)
+			}
+		})
+	}
+}
+
+func TestParseSystemdStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    ServiceStatus
+		wantErr bool
+	}{
+		{"not installed", "LoadState=not-found\nActiveState=inactive\n", StatusNotInstalled, false},
+		{"running", "LoadState=loaded\nActiveState=active\n", StatusRunning, false},
+		{"starting", "LoadState=loaded\nActiveState=activating\n", StatusRunning, false},
+		{"reloading", "LoadState=loaded\nActiveState=reloading\n", StatusRunning, false},
+		{"stopped", "LoadState=loaded\nActiveState=inactive\n", StatusStopped, false},
+		{"failed", "LoadState=loaded\nActiveState=failed\n", StatusStopped, false},
+		{"stopping", "LoadState=loaded\nActiveState=deactivating\n", StatusStopped, false},
+		{"unknown state", "LoadState=loaded\nActiveState=maintenance\n", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSystemdStatus([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSystemdStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSystemdStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
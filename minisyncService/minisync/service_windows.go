@@ -0,0 +1,189 @@
+package minisync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// windowsService manages a service through the Windows Service Control Manager.
+type windowsService struct {
+	info ServiceInfo
+}
+
+// NewServiceManager returns the ServiceManager of this platform for the described service.
+func NewServiceManager(info ServiceInfo) ServiceManager {
+	return &windowsService{info: info}
+}
+
+// Install registers the service with the Service Control Manager and registers its event log source.
+func (s *windowsService) Install(exePath string, args ...string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(s.info.Name)
+	if err == nil {
+		service.Close()
+		return fmt.Errorf("service %s already exists", s.info.Name)
+	}
+
+	service, err = m.CreateService(s.info.Name, exePath, mgr.Config{
+		DisplayName: s.info.DisplayName,
+		StartType:   mgr.StartAutomatic,
+		Description: s.info.Description,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	err = eventlog.InstallAsEventCreate(s.info.Name, eventlog.Info|eventlog.Warning|eventlog.Error)
+	if err != nil {
+		service.Delete()
+		return fmt.Errorf("setupEventLogSource() failed: %s", err)
+	}
+	return nil
+}
+
+// Uninstall removes the service from the Service Control Manager together with its event log source.
+func (s *windowsService) Uninstall() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(s.info.Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", s.info.Name)
+	}
+	defer service.Close()
+
+	err = service.Delete()
+	if err != nil {
+		return err
+	}
+
+	err = eventlog.Remove(s.info.Name)
+	if err != nil {
+		return fmt.Errorf("RemoveEventLogSource() failed: %s", err)
+	}
+	return nil
+}
+
+// Start starts the service.
+func (s *windowsService) Start() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(s.info.Name)
+	if err != nil {
+		return fmt.Errorf("could not access service: %v", err)
+	}
+	defer service.Close()
+
+	err = service.Start("is", "manual-started")
+	if err != nil {
+		return fmt.Errorf("could not start service: %v", err)
+	}
+	return nil
+}
+
+// Stop stops the service.
+func (s *windowsService) Stop() error {
+	return s.control(svc.Stop, svc.Stopped)
+}
+
+// Pause pauses the service.
+func (s *windowsService) Pause() error {
+	return s.control(svc.Pause, svc.Paused)
+}
+
+// Continue resumes the service after it has been paused.
+func (s *windowsService) Continue() error {
+	return s.control(svc.Continue, svc.Running)
+}
+
+// control sends a control command to the service, such as stop, pause, or continue. It waits until the
+// service reaches the desired state or a timeout occurs.
+func (s *windowsService) control(c svc.Cmd, to svc.State) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(s.info.Name)
+	if err != nil {
+		return fmt.Errorf("could not access service: %v", err)
+	}
+	defer service.Close()
+
+	status, err := service.Control(c)
+	if err != nil {
+		return fmt.Errorf("could not send control=%d: %v", c, err)
+	}
+
+	timeout := time.Now().Add(10 * time.Second)
+	for status.State != to {
+		if timeout.Before(time.Now()) {
+			return fmt.Errorf("timeout waiting for service to go to state=%d", to)
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = service.Query()
+		if err != nil {
+			return fmt.Errorf("could not retrieve service status: %v", err)
+		}
+	}
+	return nil
+}
+
+// Status queries the state of the service. Only query access is requested, so that the GUI can show the
+// status without administrator rights. A service that is starting, stopping, pausing or resuming is
+// reported in the state it is moving to.
+func (s *windowsService) Status() (ServiceStatus, error) {
+	m, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to service manager: %w", err)
+	}
+	defer windows.CloseServiceHandle(m)
+
+	name, err := windows.UTF16PtrFromString(s.info.Name)
+	if err != nil {
+		return "", err
+	}
+	service, err := windows.OpenService(m, name, windows.SERVICE_QUERY_STATUS)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		return StatusNotInstalled, nil
+	} else if err != nil {
+		return "", fmt.Errorf("could not access service: %w", err)
+	}
+	defer windows.CloseServiceHandle(service)
+
+	var status windows.SERVICE_STATUS
+	err = windows.QueryServiceStatus(service, &status)
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve service status: %w", err)
+	}
+
+	switch svc.State(status.CurrentState) {
+	case svc.Running, svc.StartPending, svc.ContinuePending:
+		return StatusRunning, nil
+	case svc.Paused, svc.PausePending:
+		return StatusPaused, nil
+	case svc.Stopped, svc.StopPending:
+		return StatusStopped, nil
+	}
+	return "", fmt.Errorf("unable to determine service status")
+}
@@ -0,0 +1,118 @@
+package minisync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultShareExpiry is how long a share link is valid when no expiry is given.
+	DefaultShareExpiry = 24 * time.Hour
+
+	// MaxShareExpiry is the longest validity S3 allows for a presigned URL.
+	MaxShareExpiry = 7 * 24 * time.Hour
+
+	shareAuditFileName = "ShareLinks.log"
+)
+
+// ShareLink is a time-limited presigned GET URL for a backed-up object.
+type ShareLink struct {
+	Profile  string    `json:"profile"`  // Profile is the profile whose bucket the object is in.
+	Key      string    `json:"key"`      // Key is the object key the link downloads.
+	URL      string    `json:"url"`      // URL is the presigned download link.
+	Issued   time.Time `json:"issued"`   // Issued is when the link was created.
+	Expires  time.Time `json:"expires"`  // Expires is when the link stops working.
+	IssuedBy string    `json:"issuedBy"` // IssuedBy is the local user that created the link.
+	Source   string    `json:"source"`   // Source is where the link was created, "gui" or "cli".
+}
+
+// ParseShareExpiry parses a share link expiry such as "90m", "24h" or "7d". An empty value selects
+// DefaultShareExpiry. The expiry must be between one minute and MaxShareExpiry.
+func ParseShareExpiry(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultShareExpiry, nil
+	}
+
+	var expiry time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		d, err := time.ParseDuration(days + "h")
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiry %q: %w", value, err)
+		}
+		expiry = d * 24
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expiry %q: %w", value, err)
+		}
+		expiry = d
+	}
+
+	if expiry < time.Minute || expiry > MaxShareExpiry {
+		return 0, fmt.Errorf("expiry must be between 1m and %s, got %s", MaxShareExpiry, expiry)
+	}
+	return expiry, nil
+}
+
+// ObjectKey resolves a local path or an object key to an object key. An absolute path must lie inside
+// backupFolder and is converted the same way the watcher builds keys; anything else is taken as a key.
+func ObjectKey(backupFolder, pathOrKey string) (string, error) {
+	if !filepath.IsAbs(pathOrKey) {
+		return pathOrKey, nil
+	}
+
+	relativePath, err := filepath.Rel(backupFolder, pathOrKey)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not inside the backup folder %s", pathOrKey, backupFolder)
+	}
+	return relativePath, nil
+}
+
+// ShareLink creates a presigned GET URL for the object at key that expires after the given duration.
+// The object must exist; a missing object is reported as an error matching ErrNotFound.
+func (c *MinioClient) ShareLink(key string, expiry time.Duration) (*ShareLink, error) {
+	_, err := c.StatObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := time.Now()
+	u, err := c.Client().PresignedGetObject(context.Background(), c.BucketName, key, expiry, nil)
+	if err != nil {
+		return nil, wrapError("presign", key, err)
+	}
+
+	issuedBy := ""
+	if current, err := user.Current(); err == nil {
+		issuedBy = current.Username
+	}
+
+	return &ShareLink{Key: key, URL: u.String(), Issued: issued, Expires: issued.Add(expiry), IssuedBy: issuedBy}, nil
+}
+
+// RecordShareLink appends the link as a JSON line to the share link audit log in logFolder.
+func RecordShareLink(logFolder string, link *ShareLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to encode share link: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(logFolder, shareAuditFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open share link audit log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write share link audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package minisync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	usageHistoryFileName = "UsageHistory.json"
+
+	// maxUsageHistory is the number of snapshots kept in, and returned from, the usage history.
+	maxUsageHistory = 365
+)
+
+// usageAges are the age buckets of a usage report, from youngest to oldest.
+var usageAges = []struct {
+	name   string
+	maxAge time.Duration
+}{
+	{"< 1 day", 24 * time.Hour},
+	{"1-7 days", 7 * 24 * time.Hour},
+	{"7-30 days", 30 * 24 * time.Hour},
+	{"30-365 days", 365 * 24 * time.Hour},
+	{"> 1 year", 1<<63 - 1},
+}
+
+// UsageGroup is the number and total size of the objects in one group of a usage report.
+type UsageGroup struct {
+	Name    string `json:"name"`    // Name is the folder, extension or age bucket.
+	Objects int64  `json:"objects"` // Objects is the number of objects in the group.
+	Bytes   int64  `json:"bytes"`   // Bytes is the total size of the objects in the group.
+}
+
+// UsageSnapshot is the total usage at a point in time, as kept in the usage history.
+type UsageSnapshot struct {
+	Time    time.Time        `json:"time"`    // Time is when the snapshot was taken.
+	Objects int64            `json:"objects"` // Objects is the total number of objects.
+	Bytes   int64            `json:"bytes"`   // Bytes is the total size of all objects.
+	Folders map[string]int64 `json:"folders"` // Folders is the size of each top-level folder.
+}
+
+// UsageReport breaks down the storage used by a bucket by top-level folder, file extension and age.
+type UsageReport struct {
+	Generated   time.Time       `json:"generated"`   // Generated is when the report was built.
+	Bucket      string          `json:"bucket"`      // Bucket is the bucket that was listed.
+	Objects     int64           `json:"objects"`     // Objects is the total number of objects.
+	Bytes       int64           `json:"bytes"`       // Bytes is the total size of all objects.
+	ByFolder    []UsageGroup    `json:"byFolder"`    // ByFolder is sorted by size, largest first.
+	ByExtension []UsageGroup    `json:"byExtension"` // ByExtension is sorted by size, largest first.
+	ByAge       []UsageGroup    `json:"byAge"`       // ByAge is ordered from youngest to oldest.
+	History     []UsageSnapshot `json:"history"`     // History holds earlier snapshots, oldest first.
+}
+
+// UsageReport lists every object in the bucket and builds a usage report from the listing.
+func (c *MinioClient) UsageReport() (*UsageReport, error) {
+	report := &UsageReport{Generated: time.Now(), Bucket: c.BucketName}
+	folders := map[string]*UsageGroup{}
+	extensions := map[string]*UsageGroup{}
+	ages := make([]UsageGroup, len(usageAges))
+	for i, age := range usageAges {
+		ages[i].Name = age.name
+	}
+
+	objectCh := c.Client().ListObjects(context.Background(), c.BucketName, minio.ListObjectsOptions{Recursive: true})
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, wrapError("list", "", object.Err)
+		}
+
+		report.Objects++
+		report.Bytes += object.Size
+
+		key := normalizeKey(object.Key)
+		folder := "(root)"
+		if top, _, ok := strings.Cut(key, "/"); ok {
+			folder = top
+		}
+		addUsage(folders, folder, object.Size)
+
+		extension := strings.ToLower(path.Ext(key))
+		if extension == "" {
+			extension = "(none)"
+		}
+		addUsage(extensions, extension, object.Size)
+
+		age := report.Generated.Sub(object.LastModified)
+		for i := range usageAges {
+			if age < usageAges[i].maxAge {
+				ages[i].Objects++
+				ages[i].Bytes += object.Size
+				break
+			}
+		}
+	}
+
+	report.ByFolder = sortedUsage(folders)
+	report.ByExtension = sortedUsage(extensions)
+	report.ByAge = ages
+	return report, nil
+}
+
+// Snapshot returns the totals of the report for the usage history.
+func (r *UsageReport) Snapshot() UsageSnapshot {
+	folders := make(map[string]int64, len(r.ByFolder))
+	for _, group := range r.ByFolder {
+		folders[group.Name] = group.Bytes
+	}
+	return UsageSnapshot{Time: r.Generated, Objects: r.Objects, Bytes: r.Bytes, Folders: folders}
+}
+
+// RecordUsage appends the report's snapshot to the usage history in logFolder and sets the report's
+// History to the snapshots recorded before it.
+func RecordUsage(logFolder string, report *UsageReport) error {
+	history, err := ReadUsageHistory(logFolder)
+	if err != nil {
+		return err
+	}
+	report.History = history
+
+	data, err := json.Marshal(report.Snapshot())
+	if err != nil {
+		return fmt.Errorf("failed to encode usage snapshot: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(logFolder, usageHistoryFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage history: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write usage history: %w", err)
+	}
+	return nil
+}
+
+// ReadUsageHistory returns the most recent usage snapshots recorded in logFolder, oldest first.
+// A missing history file yields no snapshots.
+func ReadUsageHistory(logFolder string) ([]UsageSnapshot, error) {
+	f, err := os.Open(filepath.Join(logFolder, usageHistoryFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage history: %w", err)
+	}
+	defer f.Close()
+
+	var history []UsageSnapshot
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var snapshot UsageSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			continue
+		}
+		history = append(history, snapshot)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage history: %w", err)
+	}
+
+	if len(history) > maxUsageHistory {
+		history = history[len(history)-maxUsageHistory:]
+	}
+	return history, nil
+}
+
+// addUsage adds an object of the given size to the named group.
+func addUsage(groups map[string]*UsageGroup, name string, size int64) {
+	group, ok := groups[name]
+	if !ok {
+		group = &UsageGroup{Name: name}
+		groups[name] = group
+	}
+	group.Objects++
+	group.Bytes += size
+}
+
+// sortedUsage returns the groups sorted by size, largest first.
+func sortedUsage(groups map[string]*UsageGroup) []UsageGroup {
+	sorted := make([]UsageGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bytes != sorted[j].Bytes {
+			return sorted[i].Bytes > sorted[j].Bytes
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
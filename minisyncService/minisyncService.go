@@ -2,358 +2,484 @@ package main
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/logging"
 	"github.com/mwiater/minisync/minisyncService/minisync"
-	"golang.org/x/sys/windows/registry"
-	"golang.org/x/sys/windows/svc"
-	"golang.org/x/sys/windows/svc/debug"
-	"golang.org/x/sys/windows/svc/eventlog"
-	"golang.org/x/sys/windows/svc/mgr"
 )
 
-// Constants related to the service configuration.
-const (
-	serviceName        = "MiniSync"                                       // The internal name of the Windows service.
-	serviceDisplayName = "MiniSync Service"                               // The display name of the service.
-	serviceDescription = "A service to sync files from Windows to MinIO." // The description of the service.
-)
+// serviceName is the internal name of the service.
+const serviceName = config.ServiceName
 
-// myService represents the Windows service and its behavior.
-type myService struct{}
+// serviceInfo describes the service to the operating system's service manager.
+var serviceInfo = minisync.ServiceInfo{
+	Name:        serviceName,
+	DisplayName: "MiniSync Service",
+	Description: "A service to sync local folders to MinIO.",
+}
 
-// Execute is the main entry point for the service execution. It handles various control requests
-// like start, stop, pause, continue, and shutdown. It also manages the service's state and logs
-// important events.
-func (m *myService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
-	s <- svc.Status{State: svc.StartPending}
-	s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+// eventLog receives the service's lifecycle events: the Windows event log when running as a Windows
+// service, and the standard log otherwise.
+type eventLog interface {
+	Info(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Error(eid uint32, msg string) error
+}
 
-	elog, err := eventlog.Open(serviceName)
-	if err != nil {
-		return false, 1
-	}
-	defer elog.Close()
-
-	elog.Info(1, "Starting: minisyncService")
-	go minisyncService(elog)
-
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case c := <-r:
-			switch c.Cmd {
-			case svc.Interrogate:
-				s <- c.CurrentStatus
-			case svc.Stop, svc.Shutdown:
-				elog.Info(1, serviceName+" stopping")
-				s <- svc.Status{State: svc.StopPending}
-				return false, 0
-			case svc.Pause:
-				s <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
-				ticker.Stop()
-			case svc.Continue:
-				s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
-				ticker = time.NewTicker(2 * time.Second)
-			default:
-				elog.Warning(1, "unexpected control request")
-			}
-		case <-ticker.C:
-			elog.Info(1, "Tick")
-		}
-	}
+// stdLog is an eventLog that writes events to the service log.
+type stdLog struct{}
+
+// Info logs an informational event.
+func (stdLog) Info(eid uint32, msg string) error {
+	serviceLog.Info(msg, "event", eid)
+	return nil
 }
 
-// compareFiles checks if the local file and the remote file are identical by comparing their sizes and modification times.
-// Returns true if the files are identical, otherwise false.
+// Warning logs a warning event.
+func (stdLog) Warning(eid uint32, msg string) error {
+	serviceLog.Warn(msg, "event", eid)
+	return nil
+}
+
+// Error logs an error event.
+func (stdLog) Error(eid uint32, msg string) error {
+	serviceLog.Error(msg, "event", eid)
+	return nil
+}
+
+// compareFiles checks if the local file and the remote file are identical. Files of different sizes never
+// are. Otherwise the modification time of the local file is compared with the one recorded when the object
+// was uploaded. Objects uploaded without it are identical if they were uploaded after the local file last
+// changed or, failing that, if their ETag is the MD5 of the local file. Uploading an unchanged file again
+// would add a version that, on an Object Lock bucket, can never be deleted, so files are only reported as
+// changed when one of these checks says so. Returns true if the files are identical, otherwise false.
 func compareFiles(localPath string, remoteObject *minio.ObjectInfo) bool {
 	localFileInfo, err := os.Stat(localPath)
 	if err != nil {
-		log.Printf("Failed to stat local file %s: %v", localPath, err)
+		logging.For(logging.FullSync).Warn("Failed to stat local file", "path", localPath, "error", err)
 		return false
 	}
 
-	if localFileInfo.Size() == remoteObject.Size && localFileInfo.ModTime().Equal(remoteObject.LastModified) {
+	if localFileInfo.Size() != remoteObject.Size {
+		return false
+	}
+	if modTime, ok := minisync.UploadedModTime(*remoteObject); ok {
+		return localFileInfo.ModTime().Equal(modTime)
+	}
+	if !remoteObject.LastModified.Before(localFileInfo.ModTime()) {
 		return true
 	}
 
-	return false
+	// A multipart ETag is not the MD5 of the object, so it cannot be compared with the local file.
+	etag := strings.Trim(remoteObject.ETag, `"`)
+	if len(etag) != md5.Size*2 {
+		return false
+	}
+	sum, err := md5File(localPath)
+	if err != nil {
+		logging.For(logging.FullSync).Warn("Failed to hash local file", "path", localPath, "error", err)
+		return false
+	}
+	return strings.EqualFold(sum, etag)
 }
 
-// minisyncService initializes the Minisync service by loading environment variables, setting up logging,
-// and starting directory monitoring and file synchronization tasks with MinIO.
-func minisyncService(elog *eventlog.Log) {
-	MINISYNC_BACKUPFOLDER, _ := fetchEnvironmentVariable("MINISYNC_BACKUPFOLDER")
-	MINISYNC_LOGFOLDER, _ := fetchEnvironmentVariable("MINISYNC_LOGFOLDER")
-	MINISYNC_MINIO_ENDPOINT, _ := fetchEnvironmentVariable("MINISYNC_MINIO_ENDPOINT")
-	MINISYNC_MINIO_BUCKETNAME, _ := fetchEnvironmentVariable("MINISYNC_MINIO_BUCKETNAME")
-	MINISYNC_MINIO_BACKUPFREQUENCYSECONDS, _ := fetchEnvironmentVariable("MINISYNC_MINIO_BACKUPFREQUENCYSECONDS")
-	MINISYNC_MINIO_ACCESS_KEY, _ := fetchEnvironmentVariable("MINISYNC_MINIO_ACCESS_KEY")
-	MINISYNC_MINIO_SECRET_KEY, _ := fetchEnvironmentVariable("MINISYNC_MINIO_SECRET_KEY")
+// md5File returns the hex-encoded MD5 of the file at path.
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-	elog.Info(1, "Set: logFile")
+	hash := md5.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	logFile, err := os.OpenFile(MINISYNC_LOGFOLDER+"\\MiniSync.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// minisyncService loads and validates the configuration file and starts the sync engine with it, which
+// runs until ctx is cancelled. Changes to the configuration file are applied while the service keeps
+// running.
+func minisyncService(ctx context.Context, elog eventLog) *engine {
+	path := config.DefaultPath()
+	cfg, err := config.Load(path)
 	if err != nil {
-		elog.Info(1, "Failed to open log file")
-		log.Fatalf("Failed to open log file: %v", err)
+		elog.Error(1, "Failed to load configuration: "+err.Error())
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	log.SetOutput(logFile)
-	log.Println("Starting MiniSync service...")
-	log.Printf("Connecting to MinIO server at %s with access key %s", MINISYNC_MINIO_ENDPOINT, MINISYNC_MINIO_ACCESS_KEY)
-	log.Println("Set: minioClient")
+	err = cfg.Validate()
+	if err != nil {
+		elog.Error(1, "Invalid configuration: "+err.Error())
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	elog.Info(1, "Set: minioClient")
-	minioClient, err := minisync.NewMinioClient(MINISYNC_MINIO_ENDPOINT, MINISYNC_MINIO_ACCESS_KEY, MINISYNC_MINIO_SECRET_KEY, MINISYNC_MINIO_BUCKETNAME)
+	e, err := runEngine(ctx, cfg, path, false, elog)
 	if err != nil {
-		elog.Info(1, "Failed to create Minio client")
-		log.Fatalf("Failed to create Minio client: %v", err)
+		elog.Error(1, "Failed to start: "+err.Error())
+		log.Fatalf("Failed to start: %v", err)
 	}
+	return e
+}
 
-	go minisync.MonitorDirectory(MINISYNC_BACKUPFOLDER, minioClient)
+// runEngine starts directory monitoring and file synchronization tasks with MinIO for every profile of
+// cfg, and stops them when ctx is cancelled; the engine's done channel is closed once they have stopped. If
+// path is not empty, changes to the configuration file at path are applied while the engine keeps running.
+// With console set the log stays on standard output.
+func runEngine(ctx context.Context, cfg *config.Config, path string, console bool, elog eventLog) (*engine, error) {
+	elog.Info(1, "Starting engine")
+	e, err := startEngine(cfg, console, func(ctx context.Context, log *slog.Logger, beat func(), profile config.Profile, destination *minisync.Destination) error {
+		elog.Info(1, "Starting full sync cycle of profile "+profile.Name)
+		log.Info("Starting full sync cycle")
+		started := time.Now()
+		err := fullSync(ctx, log, beat, profile, destination)
+		if ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			log.Error("Full sync cycle failed", "took", time.Since(started), "error", err)
+			elog.Info(1, "Full sync cycle failed for destination "+destination.Name+" of profile "+profile.Name)
+		} else {
+			log.Info("Full sync cycle completed", "took", time.Since(started))
+			elog.Info(1, "Full sync cycle completed for destination "+destination.Name+" of profile "+profile.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	backupFrequencySeconds, _ := strconv.Atoi(MINISYNC_MINIO_BACKUPFREQUENCYSECONDS)
-	ticker := time.NewTicker(time.Duration(backupFrequencySeconds) * time.Second)
-	for range ticker.C {
-		elog.Info(1, "Starting full sync cycle")
-		err := filepath.Walk(MINISYNC_BACKUPFOLDER, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
+	if path != "" {
+		err = watchConfig(ctx, path, func() {
+			cfg, err := config.Load(path)
+			if err == nil {
+				err = cfg.Validate()
 			}
-
-			relativePath, err := filepath.Rel(MINISYNC_BACKUPFOLDER, path)
 			if err != nil {
-				log.Printf("Failed to get relative path for %s: %v", path, err)
-				return err
+				serviceLog.Warn("Ignoring configuration change", "error", err)
+				elog.Warning(1, "Ignoring configuration change: "+err.Error())
+				return
 			}
+			serviceLog.Info("Configuration changed, applying")
+			elog.Info(1, "Applying configuration change")
+			e.apply(cfg)
+		})
+		if err != nil {
+			serviceLog.Warn("Configuration changes will only be applied after a restart", "error", err)
+		}
+	}
 
-			if info.IsDir() {
-				log.Printf("Found directory: %s", relativePath)
-				return nil
-			}
+	go func() {
+		<-ctx.Done()
+		elog.Info(1, "Stopping engine")
+		e.stop()
+		close(e.done)
+	}()
+	return e, nil
+}
 
-			// Check if the file exists on MinIO
-			remoteObject, err := minioClient.Client.StatObject(context.Background(), minioClient.BucketName, relativePath, minio.StatObjectOptions{})
-			if err != nil {
-				if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-					// File does not exist on remote, upload it
-					log.Printf("Uploading new file %s to MinIO", relativePath)
-					err = minioClient.CreateFile(relativePath, path)
-					if err != nil {
-						log.Printf("Failed to upload file %s: %v", path, err)
-						return err
-					}
-				} else {
-					// Some other error occurred
-					log.Printf("Failed to stat remote file %s: %v", relativePath, err)
-					return err
-				}
-			} else {
-				// File exists on remote, compare it with the local file
-				if compareFiles(path, &remoteObject) {
-					// Files are identical, do nothing
-					log.Printf("File %s is identical on local and remote, skipping", relativePath)
-				} else {
-					// Files are not identical, update the remote file
-					log.Printf("Updating file %s on MinIO", relativePath)
-					err = minioClient.UpdateFile(relativePath, path)
-					if err != nil {
-						log.Printf("Failed to update file %s: %v", path, err)
-						return err
-					}
-				}
-			}
+// watchdog checks the liveness of the engine's components, restarting those that stalled, and reports every
+// stall to elog. It then retries profiles and destinations that failed to connect.
+func watchdog(e *engine, elog eventLog) {
+	for _, incident := range e.checkLiveness() {
+		message := "Restarted stalled " + incident.Component + " of profile " + incident.Profile
+		if incident.Destination != "" {
+			message += ", destination " + incident.Destination
+		}
+		elog.Warning(1, message+": "+incident.Problem)
+	}
+	e.retry()
+}
+
+// fullSync compares the backup folder of a profile with the bucket of a single destination and queues
+// uploads for new or changed files and, in mirror mode, deletes for remote files that no longer exist
+// locally. Files the profile's filter does not select are left alone on both sides. Each destination is
+// compared on its own, so an unreachable destination only fails its own cycle. Files that are already in
+// sync are only logged at the debug level. beat is called for every file and remote object compared. The
+// cycle ends early once ctx is cancelled.
+func fullSync(ctx context.Context, log *slog.Logger, beat func(), profile config.Profile, destination *minisync.Destination) error {
+	backupFolder := profile.BackupFolder
+	minioClient := destination.Client()
+	err := filepath.Walk(backupFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		beat()
+
+		relativePath, err := filepath.Rel(backupFolder, path)
+		if err != nil {
+			log.Error("Failed to get relative path", "path", path, "error", err)
+			return err
+		}
 
+		if info.IsDir() {
+			log.Debug("Found directory", "path", relativePath)
 			return nil
-		})
+		}
+		if !profile.Filter.Match(relativePath) {
+			return nil
+		}
 
+		// Check if the file exists on MinIO
+		remoteObject, err := minioClient.StatObjectContext(ctx, relativePath)
 		if err != nil {
-			log.Printf("Failed to walk directory: %v", err)
-			elog.Info(1, "Failed to walk directory")
+			if errors.Is(err, minisync.ErrNotFound) {
+				// File does not exist on remote, upload it
+				id := destination.Enqueue(minisync.OpUpload, relativePath, path)
+				log.Info("Queued upload of new file", "path", relativePath, "op", id)
+			} else {
+				// Some other error occurred
+				log.Error("Failed to stat remote file", "path", relativePath, "error", err)
+				return err
+			}
 		} else {
-			log.Println("Full sync cycle completed")
-			elog.Info(1, "Full sync cycle completed")
+			// File exists on remote, compare it with the local file
+			if compareFiles(path, &remoteObject) {
+				// Files are identical, do nothing
+				log.Debug("File is identical on local and remote, skipping", "path", relativePath)
+			} else {
+				// Files are not identical, update the remote file
+				id := destination.Enqueue(minisync.OpUpdate, relativePath, path)
+				log.Info("Queued update of changed file", "path", relativePath, "op", id)
+			}
 		}
 
-		// Check for files on the remote that don't exist locally and delete them
-		doneCh := make(chan struct{})
-		defer close(doneCh)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk directory: %w", err)
+	}
 
-		objectCh := minioClient.Client.ListObjects(context.Background(), minioClient.BucketName, minio.ListObjectsOptions{
-			Prefix:    "", // Change prefix if you want to limit the scope
-			Recursive: true,
-		})
+	if !profile.Mode.Deletes() {
+		return nil
+	}
 
-		for object := range objectCh {
-			if object.Err != nil {
-				log.Printf("Error listing objects: %v", object.Err)
-				continue
-			}
+	// Check for files on the remote that don't exist locally and delete them
+	objectCh := minioClient.Client().ListObjects(ctx, minioClient.BucketName, minio.ListObjectsOptions{
+		Prefix:    "", // Change prefix if you want to limit the scope
+		Recursive: true,
+	})
 
-			localPath := filepath.Join(MINISYNC_BACKUPFOLDER, object.Key)
-			if _, err := os.Stat(localPath); os.IsNotExist(err) {
-				// File exists on remote but not locally, delete it
-				log.Printf("Deleting remote file %s that does not exist locally", object.Key)
-				err = minioClient.DeleteFile(object.Key)
-				if err != nil {
-					log.Printf("Failed to delete remote file %s: %v", object.Key, err)
-				}
-			}
+	for object := range objectCh {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		beat()
+		if object.Err != nil {
+			log.Error("Failed to list objects", "error", object.Err)
+			continue
+		}
+
+		if !profile.Filter.Match(object.Key) {
+			continue
+		}
+		localPath := filepath.Join(backupFolder, object.Key)
+		if _, err := os.Stat(localPath); os.IsNotExist(err) {
+			// File exists on remote but not locally, delete it
+			id := destination.Enqueue(minisync.OpDelete, object.Key, "")
+			log.Info("Queued delete of remote file that does not exist locally", "path", object.Key, "op", id)
 		}
 	}
+
+	return nil
 }
 
-// runService runs the Minisync service, either in debug mode or as a standard Windows service.
-func runService(name string, isDebug bool) {
-	var err error
-	if isDebug {
-		err = debug.Run(name, &myService{})
-	} else {
-		err = svc.Run(name, &myService{})
+// shareFile creates a presigned download link for a backed-up file of a profile, given either its local
+// path or its object key, records it in the share link audit log and prints it.
+func shareFile(args []string) error {
+	flags := flag.NewFlagSet("share", flag.ExitOnError)
+	profileName := flags.String("profile", "", "profile the file belongs to (default: the first profile)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		usage()
 	}
+	pathOrKey, expiryValue := flags.Arg(0), flags.Arg(1)
+
+	cfg, profile, err := loadProfile(*profileName)
 	if err != nil {
-		log.Fatalf("%s service failed: %v", name, err)
+		return err
 	}
-}
 
-// installService installs the Minisync service on the local machine. It sets up the service configuration
-// and registers it with the Windows Service Manager.
-func installService(name, exepath string) error {
-	m, err := mgr.Connect()
+	expiry, err := minisync.ParseShareExpiry(expiryValue)
 	if err != nil {
 		return err
 	}
-	defer m.Disconnect()
 
-	s, err := m.OpenService(name)
-	if err == nil {
-		s.Close()
-		return fmt.Errorf("service %s already exists", name)
+	key, err := minisync.ObjectKey(profile.BackupFolder, pathOrKey)
+	if err != nil {
+		return err
 	}
 
-	s, err = m.CreateService(name, exepath, mgr.Config{
-		DisplayName: serviceDisplayName,
-		StartType:   mgr.StartAutomatic,
-		Description: serviceDescription,
-	}, "is", "auto-started")
+	minioClient, err := profile.NewReadOnlyMinioClient(profile.Primary)
 	if err != nil {
 		return err
 	}
-	defer s.Close()
 
-	err = eventlog.InstallAsEventCreate(name, eventlog.Info|eventlog.Warning|eventlog.Error)
+	link, err := minioClient.ShareLink(key, expiry)
 	if err != nil {
-		s.Delete()
-		return fmt.Errorf("setupEventLogSource() failed: %s", err)
+		return err
 	}
-	return nil
-}
+	link.Source = "cli"
+	link.Profile = profile.Name
 
-// uninstallService removes the Minisync service from the local machine, including its registration
-// with the Windows Service Manager and associated event logs.
-func uninstallService(name string) error {
-	m, err := mgr.Connect()
+	err = minisync.RecordShareLink(cfg.LogFolder, link)
 	if err != nil {
 		return err
 	}
-	defer m.Disconnect()
 
-	s, err := m.OpenService(name)
+	fmt.Printf("%s\n(expires %s)\n", link.URL, link.Expires.Format(time.RFC1123))
+	return nil
+}
+
+// usageReport builds a storage usage report for the backup bucket of a profile, records it in the
+// profile's usage history and prints it as a table, or as JSON with -json.
+func usageReport(args []string) error {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	profileName := flags.String("profile", "", "profile to report on (default: the first profile)")
+	flags.Parse(args)
+
+	cfg, profile, err := loadProfile(*profileName)
 	if err != nil {
-		return fmt.Errorf("service %s is not installed", name)
+		return err
 	}
-	defer s.Close()
-
-	err = s.Delete()
+	stateFolder, err := cfg.StateFolder(profile.Name)
 	if err != nil {
 		return err
 	}
 
-	err = eventlog.Remove(name)
+	minioClient, err := profile.NewReadOnlyMinioClient(profile.Primary)
 	if err != nil {
-		return fmt.Errorf("RemoveEventLogSource() failed: %s", err)
+		return err
 	}
-	return nil
-}
 
-// startService starts the Minisync service using the Windows Service Manager.
-func startService(name string) error {
-	m, err := mgr.Connect()
+	report, err := minioClient.UsageReport()
 	if err != nil {
 		return err
 	}
-	defer m.Disconnect()
 
-	s, err := m.OpenService(name)
+	err = minisync.RecordUsage(stateFolder, report)
 	if err != nil {
-		return fmt.Errorf("could not access service: %v", err)
+		return err
 	}
-	defer s.Close()
 
-	err = s.Start("is", "manual-started")
-	if err != nil {
-		return fmt.Errorf("could not start service: %v", err)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Bucket %s: %d objects, %d bytes\n", report.Bucket, report.Objects, report.Bytes)
+	for _, section := range []struct {
+		title  string
+		groups []minisync.UsageGroup
+	}{
+		{"Folder", report.ByFolder},
+		{"Extension", report.ByExtension},
+		{"Age", report.ByAge},
+	} {
+		fmt.Fprintf(w, "\n%s\tObjects\tBytes\n", section.title)
+		for _, group := range section.groups {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", group.Name, group.Objects, group.Bytes)
+		}
 	}
-	return nil
+	if len(report.History) > 0 {
+		previous := report.History[len(report.History)-1]
+		fmt.Fprintf(w, "\nChange since %s\t%+d\t%+d\n", previous.Time.Format(time.DateTime), report.Objects-previous.Objects, report.Bytes-previous.Bytes)
+	}
+	return w.Flush()
 }
 
-// controlService sends a control command to the Minisync service, such as stop, pause, or continue.
-// It waits until the service reaches the desired state or a timeout occurs.
-func controlService(name string, c svc.Cmd, to svc.State) error {
-	m, err := mgr.Connect()
+// fileHistory prints the file history of a profile for a backed-up file or folder, given either its local
+// path or its object key, newest first, as a table or as JSON with -json. Without a path it prints the
+// history of every file.
+func fileHistory(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the history as JSON")
+	limit := flags.Int("limit", 50, "print at most this many entries, 0 for all")
+	profileName := flags.String("profile", "", "profile the file belongs to (default: the first profile)")
+	flags.Parse(args)
+
+	cfg, profile, err := loadProfile(*profileName)
 	if err != nil {
 		return err
 	}
-	defer m.Disconnect()
-
-	s, err := m.OpenService(name)
+	key, err := minisync.ObjectKey(profile.BackupFolder, flags.Arg(0))
 	if err != nil {
-		return fmt.Errorf("could not access service: %v", err)
+		return err
+	}
+	stateFolder, err := cfg.StateFolder(profile.Name)
+	if err != nil {
+		return err
 	}
-	defer s.Close()
 
-	status, err := s.Control(c)
+	entries, err := minisync.ReadFileHistory(stateFolder, key, *limit)
 	if err != nil {
-		return fmt.Errorf("could not send control=%d: %v", c, err)
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No history recorded.")
+		return nil
 	}
 
-	timeout := time.Now().Add(10 * time.Second)
-	for status.State != to {
-		if timeout.Before(time.Now()) {
-			return fmt.Errorf("timeout waiting for service to go to state=%d", to)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Time\tAction\tPath\tDestination\tBytes\tSHA-256\tResult\n")
+	for _, entry := range entries {
+		path, result := entry.Path, entry.Result
+		if entry.Folder {
+			path += "/"
 		}
-		time.Sleep(300 * time.Millisecond)
-		status, err = s.Query()
-		if err != nil {
-			return fmt.Errorf("could not retrieve service status: %v", err)
+		if entry.Error != "" {
+			result += ": " + entry.Error
+		}
+		hash := entry.Hash
+		if len(hash) > 12 {
+			hash = hash[:12]
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", entry.Time.Local().Format(time.DateTime), entry.Action, path, entry.Destination, entry.Size, hash, result)
 	}
-	return nil
+	return w.Flush()
 }
 
-// stopService stops the Minisync service using the Windows Service Manager.
-func stopService(name string) error {
-	return controlService(name, svc.Stop, svc.Stopped)
-}
-
-// pauseService pauses the Minisync service using the Windows Service Manager.
-func pauseService(name string) error {
-	return controlService(name, svc.Pause, svc.Paused)
-}
-
-// continueService resumes the Minisync service after it has been paused.
-func continueService(name string) error {
-	return controlService(name, svc.Continue, svc.Running)
+// loadProfile loads the configuration and returns it together with the profile with the given name, or
+// the first profile if name is empty.
+func loadProfile(name string) (*config.Config, *config.Profile, error) {
+	cfg, err := config.Load(config.DefaultPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	profile := cfg.Profile(name)
+	if profile == nil {
+		return nil, nil, fmt.Errorf("there is no profile named %q", name)
+	}
+	return cfg, profile, nil
 }
 
 // usage displays the command-line usage information for the Minisync service management commands.
@@ -366,18 +492,17 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  stop      Stop the service\n")
 	fmt.Fprintf(os.Stderr, "  pause     Pause the service\n")
 	fmt.Fprintf(os.Stderr, "  continue  Resume the service\n")
+	fmt.Fprintf(os.Stderr, "  run       Run the sync engine in the foreground, logging to stdout: run [-config file] or run -folder dir -endpoint host:port -bucket name [options]\n")
+	fmt.Fprintf(os.Stderr, "  share     Print a presigned download link: share [-profile name] <path-or-key> [expiry, e.g. 24h or 7d]\n")
+	fmt.Fprintf(os.Stderr, "  usage     Print the storage used per folder, file type and age: usage [-profile name] [-json]\n")
+	fmt.Fprintf(os.Stderr, "  history   Print the uploads, updates, deletes, copies and restores of a file or folder: history [-profile name] [-limit n] [-json] [path-or-key]\n")
 	os.Exit(2)
 }
 
 // main is the entry point for the Minisync service application. It determines whether the application
 // is running as a Windows service or in interactive mode and executes the appropriate commands.
 func main() {
-	isWindowsService, err := svc.IsWindowsService()
-	if err != nil {
-		log.Fatalf("failed to determine if we are running in an interactive session: %v", err)
-	}
-	if isWindowsService {
-		runService(serviceName, false)
+	if runAsService() {
 		return
 	}
 
@@ -392,19 +517,31 @@ func main() {
 		log.Fatalf("failed to get executable path: %v", err)
 	}
 
+	manager := newServiceManager()
 	switch cmd {
 	case "install":
-		err = installService(serviceName, exepath)
+		err = manager.Install(exepath, serviceArgs...)
+		if err == nil {
+			err = installEnvironment()
+		}
 	case "uninstall":
-		err = uninstallService(serviceName)
+		err = manager.Uninstall()
 	case "start":
-		err = startService(serviceName)
+		err = manager.Start()
 	case "stop":
-		err = stopService(serviceName)
+		err = manager.Stop()
 	case "pause":
-		err = pauseService(serviceName)
+		err = manager.Pause()
 	case "continue":
-		err = continueService(serviceName)
+		err = manager.Continue()
+	case "run":
+		err = runForeground(os.Args[2:])
+	case "share":
+		err = shareFile(os.Args[2:])
+	case "usage":
+		err = usageReport(os.Args[2:])
+	case "history":
+		err = fileHistory(os.Args[2:])
 	default:
 		usage()
 	}
@@ -412,20 +549,3 @@ func main() {
 		log.Fatalf("failed to %s %s: %v", cmd, serviceName, err)
 	}
 }
-
-// fetchEnvironmentVariable retrieves the value of an environment variable from the Windows registry.
-// It opens the registry key, fetches the variable value, and returns it. If the variable is not found,
-// an error is returned.
-func fetchEnvironmentVariable(name string) (string, error) {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.QUERY_VALUE)
-	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
-	}
-	defer key.Close()
-
-	value, _, err := key.GetStringValue(name)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch environment variable %s: %w", name, err)
-	}
-	return value, nil
-}
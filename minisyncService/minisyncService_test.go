@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+func TestCompareFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.Local)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := map[string]string{minisync.ModTimeMetadata: modTime.UTC().Format(time.RFC3339Nano)}
+	md5 := `"5d41402abc4b2a76b9719d911017c592"`
+
+	tests := []struct {
+		name   string
+		object minio.ObjectInfo
+		want   bool
+	}{
+		{"same size and recorded time", minio.ObjectInfo{Size: 5, UserMetadata: uploaded}, true},
+		{"different size", minio.ObjectInfo{Size: 6, UserMetadata: uploaded}, false},
+		{"different recorded time", minio.ObjectInfo{Size: 5, UserMetadata: map[string]string{
+			minisync.ModTimeMetadata: modTime.Add(time.Second).UTC().Format(time.RFC3339Nano),
+		}}, false},
+		{"recorded time wins over a later upload", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(time.Hour), UserMetadata: map[string]string{
+			minisync.ModTimeMetadata: modTime.Add(-time.Hour).UTC().Format(time.RFC3339Nano),
+		}}, false},
+		{"uploaded after the change", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(time.Hour)}, true},
+		{"uploaded before the change with the same MD5", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(-time.Hour), ETag: md5}, true},
+		{"uploaded before the change with an uppercase MD5", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(-time.Hour), ETag: strings.ToUpper(md5)}, true},
+		{"uploaded before the change with another MD5", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(-time.Hour), ETag: `"00000000000000000000000000000000"`}, false},
+		{"uploaded before the change in parts", minio.ObjectInfo{Size: 5, LastModified: modTime.Add(-time.Hour), ETag: `"5d41402abc4b2a76b9719d911017c592-2"`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareFiles(path, &tt.object); got != tt.want {
+				t.Errorf("compareFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing local file", func(t *testing.T) {
+		object := minio.ObjectInfo{Size: 5, UserMetadata: uploaded}
+		if compareFiles(filepath.Join(t.TempDir(), "missing.txt"), &object) {
+			t.Errorf("compareFiles() = true, want false")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/logging"
+	"github.com/mwiater/minisync/minisyncService/metrics"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// Environment variables the run command reads the MinIO credentials from, so that they do not show up in
+// the process list.
+const (
+	accessKeyEnv = "MINISYNC_ACCESS_KEY"
+	secretKeyEnv = "MINISYNC_SECRET_KEY"
+)
+
+// runForeground runs the sync engine in the foreground until it receives SIGINT or SIGTERM, logging to
+// standard output. The configuration is read from a file, which is watched for changes, or, if -folder is
+// given, built from the command line flags alone.
+func runForeground(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	path := flags.String("config", config.DefaultPath(), "configuration file, applied again whenever it changes")
+	folder := flags.String("folder", "", "back up this folder with the settings given as flags instead of a configuration file")
+	endpoint := flags.String("endpoint", "", "host:port or URL of the MinIO server, comma-separated for a cluster")
+	bucket := flags.String("bucket", "", "MinIO bucket name")
+	accessKey := flags.String("access-key", os.Getenv(accessKeyEnv), "MinIO access key (default $"+accessKeyEnv+")")
+	mode := flags.String("mode", string(minisync.Mirror), "mirror or backup")
+	include := flags.String("include", "", "comma-separated patterns of the files to back up")
+	exclude := flags.String("exclude", "", "comma-separated patterns of the files to leave out")
+	frequency := flags.Int("frequency", 300, "seconds between full sync cycles")
+	schedule := flags.String("schedule", "", "cron expression for the full sync cycles, replaces -frequency")
+	syncOnStart := flags.Bool("sync-on-start", false, "run a full sync cycle right away")
+	logFolder := flags.String("log-folder", filepath.Join(os.TempDir(), "minisync"), "folder for the status and history files")
+	metricsAddress := flags.String("metrics-address", metrics.DefaultAddress, "IP address or host name to serve Prometheus metrics on")
+	metricsPort := flags.Int("metrics-port", 0, "serve Prometheus metrics on this port, 0 to turn them off")
+	logFormat := flags.String("log-format", logging.TextFormat, "text or json")
+	logLevel := flags.String("log-level", "info", "debug, info, warn or error")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s run [-config file] | [-folder dir -endpoint host:port -bucket name [options]]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "The secret key is read from $%s when -folder is given.\n", secretKeyEnv)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	log.SetOutput(os.Stdout)
+
+	var cfg *config.Config
+	var err error
+	watched := ""
+	if *folder != "" {
+		cfg, err = flagConfig(*folder, *logFolder)
+		if err != nil {
+			return err
+		}
+		cfg.MetricsAddress = *metricsAddress
+		cfg.MetricsPort = *metricsPort
+		cfg.Logging = logging.Settings{Format: *logFormat, Level: *logLevel}
+		p := &cfg.Profiles[0]
+		p.Mode, err = minisync.ParseSyncMode(*mode)
+		if err != nil {
+			return err
+		}
+		p.Primary.Endpoints = minisync.ParseEndpoints(*endpoint)
+		p.Primary.BucketName = *bucket
+		p.Primary.AccessKey = *accessKey
+		p.Primary.SecretKey = os.Getenv(secretKeyEnv)
+		p.Filter = minisync.Filter{Include: minisync.ParsePatterns(*include), Exclude: minisync.ParsePatterns(*exclude)}
+		p.BackupFrequencySeconds = *frequency
+		p.Schedule = *schedule
+		p.SyncOnStart = *syncOnStart
+	} else {
+		cfg, err = config.Load(*path)
+		if err != nil {
+			return err
+		}
+		watched = *path
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	e, err := runEngine(ctx, cfg, watched, true, stdLog{})
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			serviceLog.Info("Stopped")
+			return nil
+		case <-ticker.C:
+			watchdog(e, stdLog{})
+		}
+	}
+}
+
+// flagConfig returns a configuration with a single profile that backs up folder, with the log folder
+// created if needed. Both folders are made absolute.
+func flagConfig(folder, logFolder string) (*config.Config, error) {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+	logFolder, err = filepath.Abs(logFolder)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(logFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log folder: %w", err)
+	}
+
+	cfg := config.Default()
+	cfg.LogFolder = logFolder
+	cfg.Profiles[0].BackupFolder = folder
+	return cfg, nil
+}
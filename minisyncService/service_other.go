@@ -0,0 +1,101 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/control"
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// serviceArgs are the arguments the installed service is started with: systemd runs the sync engine in
+// the foreground and takes care of stopping and restarting it.
+var serviceArgs = []string{"run"}
+
+// runAsService returns false: outside of Windows the service manager starts the run command instead.
+func runAsService() bool {
+	return false
+}
+
+// newServiceManager returns the systemd manager of the service. It pauses and resumes the running service
+// through its control API, as the Service Control Manager does on Windows.
+func newServiceManager() minisync.ServiceManager {
+	manager := minisync.NewSystemdManager(serviceInfo, minisync.DefaultUnitDir)
+	manager.Pauser = controlPauser{}
+	return manager
+}
+
+// controlPauser pauses and resumes the running service through its control API.
+type controlPauser struct{}
+
+// SetPaused pauses or resumes syncing.
+func (controlPauser) SetPaused(paused bool) error {
+	client, err := dialControl()
+	if err != nil {
+		return err
+	}
+	if paused {
+		return client.Pause()
+	}
+	return client.Resume()
+}
+
+// Paused reports whether syncing is paused.
+func (controlPauser) Paused() (bool, error) {
+	client, err := dialControl()
+	if err != nil {
+		return false, err
+	}
+	status, err := client.Status()
+	if err != nil {
+		return false, err
+	}
+	return status.Paused, nil
+}
+
+// dialControl connects to the control API the service published in the log folder of the configuration.
+func dialControl() (*control.Client, error) {
+	cfg, err := config.Load(config.DefaultPath())
+	if err != nil {
+		return nil, err
+	}
+	return control.Dial(cfg.LogFolder)
+}
+
+// installEnvironment writes the passphrase of the file secret store, if it is set, to the environment file
+// the systemd unit loads, so that the installed service can open the store. The file is readable by its
+// owner only. An existing file is left alone.
+func installEnvironment() error {
+	passphrase := os.Getenv(config.PassphraseEnv)
+	if passphrase == "" {
+		return nil
+	}
+
+	path := minisync.DefaultEnvironmentFile
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create environment file: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to create environment file: %w", err)
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(passphrase)
+	_, err = fmt.Fprintf(file, "%s=\"%s\"\n", config.PassphraseEnv, quoted)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write environment file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mwiater/minisync/minisyncService/minisync"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/debug"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// serviceArgs are the arguments the Service Control Manager starts the service with.
+var serviceArgs = []string{"is", "auto-started"}
+
+// newServiceManager returns the Service Control Manager's manager of the service, which passes pause and
+// continue requests on to the running service.
+func newServiceManager() minisync.ServiceManager {
+	return minisync.NewServiceManager(serviceInfo)
+}
+
+// installEnvironment does nothing on Windows, where the service keeps its secret keys in the keyring store
+// by default.
+func installEnvironment() error {
+	return nil
+}
+
+// myService represents the Windows service and its behavior.
+type myService struct{}
+
+// Execute is the main entry point for the service execution. It handles various control requests
+// like start, stop, pause, continue, and shutdown. It also manages the service's state and logs
+// important events.
+func (m *myService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	s <- svc.Status{State: svc.StartPending}
+	s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return false, 1
+	}
+	defer elog.Close()
+
+	elog.Info(1, "Starting: minisyncService")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan *engine, 1)
+	go func() {
+		started <- minisyncService(ctx, elog)
+	}()
+	var e *engine
+	paused := false
+
+	// The watchdog keeps running while paused: paused destinations finish the operation in flight, and the
+	// folder monitor keeps queueing changes.
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e = <-started:
+			// The service may have been paused while the engine was starting.
+			e.SetPaused(paused)
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				elog.Info(1, serviceName+" stopping")
+				s <- svc.Status{State: svc.StopPending}
+				cancel()
+				if e != nil {
+					<-e.done
+				}
+				return false, 0
+			case svc.Pause:
+				paused = true
+				if e != nil {
+					e.SetPaused(true)
+				}
+				s <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
+			case svc.Continue:
+				paused = false
+				if e != nil {
+					e.SetPaused(false)
+				}
+				s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+			default:
+				elog.Warning(1, "unexpected control request")
+			}
+		case <-ticker.C:
+			if e != nil {
+				watchdog(e, elog)
+			}
+		}
+	}
+}
+
+// runService runs the Minisync service, either in debug mode or as a standard Windows service.
+func runService(name string, isDebug bool) {
+	var err error
+	if isDebug {
+		err = debug.Run(name, &myService{})
+	} else {
+		err = svc.Run(name, &myService{})
+	}
+	if err != nil {
+		log.Fatalf("%s service failed: %v", name, err)
+	}
+}
+
+// runAsService runs the service and returns true if the process was started by the Service Control
+// Manager. It returns false in an interactive session.
+func runAsService() bool {
+	isWindowsService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Fatalf("failed to determine if we are running in an interactive session: %v", err)
+	}
+	if isWindowsService {
+		runService(serviceName, false)
+	}
+	return isWindowsService
+}
@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"syscall"
-	"unsafe"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/mwiater/minisync/minisyncService/config"
+	"github.com/mwiater/minisync/minisyncService/control"
 	"github.com/mwiater/minisync/minisyncService/minisync"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"golang.org/x/sys/windows/registry"
 )
 
 // minisyncService contains the embedded binary for the Minisync service.
@@ -23,14 +27,34 @@ import (
 var minisyncService embed.FS
 
 // Config represents the structure of the form data used to configure the Minisync service.
+// It is converted to and from the configuration file by toConfig and fromConfig.
 type Config struct {
-	BackupFolder           string `json:"backupFolder"`
-	LogFolder              string `json:"logFolder"`
-	MinioEndpoint          string `json:"minioEndpoint"`
-	MinioKey               string `json:"minioKey"`
-	MinioSecret            string `json:"minioSecret"`
-	MinioBucketName        string `json:"miniobucketName"`
-	BackupFrequencySeconds string `json:"backupFrequencySeconds"`
+	LogFolder string        `json:"logFolder"`
+	Profiles  []ProfileForm `json:"profiles"`
+}
+
+// ProfileForm is the form data of a single profile. OriginalName is the name the profile was saved under,
+// so that a renamed profile keeps its settings and secret keys.
+type ProfileForm struct {
+	OriginalName           string                       `json:"originalName"`
+	Name                   string                       `json:"name"`
+	BackupFolder           string                       `json:"backupFolder"`
+	Mode                   string                       `json:"mode"`
+	Include                string                       `json:"include"`
+	Exclude                string                       `json:"exclude"`
+	MinioEndpoint          string                       `json:"minioEndpoint"`
+	MinioEndpointStrategy  string                       `json:"minioEndpointStrategy"`
+	MinioKey               string                       `json:"minioKey"`
+	MinioSecret            string                       `json:"minioSecret"`
+	MinioBucketName        string                       `json:"miniobucketName"`
+	BackupFrequencySeconds string                       `json:"backupFrequencySeconds"`
+	Schedule               string                       `json:"schedule"`
+	SyncOnStart            string                       `json:"syncOnStart"`
+	ObjectLockMode         string                       `json:"objectLockMode"`
+	ObjectLockDays         string                       `json:"objectLockDays"`
+	ObjectLockLegalHold    string                       `json:"objectLockLegalHold"`
+	ObjectLockRules        string                       `json:"objectLockRules"`
+	Destinations           []minisync.DestinationConfig `json:"destinations"`
 }
 
 // App represents the main application struct.
@@ -70,9 +94,58 @@ func (a *App) BrowseFolder() (string, error) {
 	})
 }
 
+// BrowseFile opens a dialog allowing the user to select a file, starting in the backup folder of the
+// given profile. The selected file path is returned.
+func (a *App) BrowseFile(profileName string) (string, error) {
+	options := runtime.OpenDialogOptions{Title: "Select File"}
+	if _, profile, err := loadProfile(profileName); err == nil {
+		options.DefaultDirectory = profile.BackupFolder
+	}
+	return runtime.OpenFileDialog(a.ctx, options)
+}
+
+// ShareLink creates a time-limited presigned download link for a backed-up file of a profile, given either
+// its local path or its object key, and an expiry such as "1h", "24h" or "7d". Every issued link is
+// recorded in the share link audit log in the log folder.
+func (a *App) ShareLink(profileName, pathOrKey string, expiry string) (*minisync.ShareLink, error) {
+	cfg, profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := minisync.ParseShareExpiry(expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := minisync.ObjectKey(profile.BackupFolder, pathOrKey)
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := minioClient.ShareLink(key, duration)
+	if err != nil {
+		return nil, err
+	}
+	link.Source = "gui"
+	link.Profile = profile.Name
+
+	err = minisync.RecordShareLink(cfg.LogFolder, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
 // GetServiceStatus retrieves the current status of the Minisync service.
 func (a *App) GetServiceStatus() (string, error) {
-	serviceStatus, err := minisync.GetServiceStatus("MiniSync")
+	serviceStatus, err := minisync.GetServiceStatus(config.ServiceName)
 	if err != nil {
 		log.Fatalf("Error getting MiniSync status: %v", err)
 		return "", err
@@ -81,6 +154,30 @@ func (a *App) GetServiceStatus() (string, error) {
 	return serviceStatus, nil
 }
 
+// GetSyncStatus returns the state of the running service: the watcher health and schedule of every
+// profile, and the queue, transfers, daily totals and recent errors of every backup destination. If the
+// service does not answer, it falls back to the destination statuses in the status file it last wrote.
+func (a *App) GetSyncStatus() (*control.Status, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := control.Dial(cfg.LogFolder)
+	if err == nil {
+		var status *control.Status
+		status, err = client.Status()
+		if err == nil {
+			return status, nil
+		}
+	}
+	destinations, err := minisync.ReadStatusFile(cfg.LogFolder)
+	if err != nil {
+		return nil, err
+	}
+	return &control.Status{Destinations: destinations}, nil
+}
+
 // ServiceControl manages the Minisync service by executing commands such as start, stop, install, and uninstall.
 func (a *App) ServiceControl(command string) string {
 	exePath, err := os.Executable()
@@ -96,42 +193,9 @@ func (a *App) ServiceControl(command string) string {
 	return result
 }
 
-// runCommand executes the specified command on the given file and passes the necessary environment variables.
+// runCommand executes the specified command on the given file.
 func runCommand(fileName string, command string) string {
-	var cmd *exec.Cmd
-	if command == "install" || command == "start" {
-		key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.QUERY_VALUE)
-		if err != nil {
-			log.Fatalf("Failed to open registry key: %v", err)
-		}
-		defer key.Close()
-
-		MINISYNC_BACKUPFOLDER, _ := fetchEnvironmentVariable("MINISYNC_BACKUPFOLDER")
-		MINISYNC_LOGFOLDER, _ := fetchEnvironmentVariable("MINISYNC_LOGFOLDER")
-		MINISYNC_MINIO_ENDPOINT, _ := fetchEnvironmentVariable("MINISYNC_MINIO_ENDPOINT")
-		MINISYNC_MINIO_BUCKETNAME, _ := fetchEnvironmentVariable("MINISYNC_MINIO_BUCKETNAME")
-		MINISYNC_MINIO_BACKUPFREQUENCYSECONDS, _ := fetchEnvironmentVariable("MINISYNC_MINIO_BACKUPFREQUENCYSECONDS")
-		MINISYNC_MINIO_ACCESS_KEY, _ := fetchEnvironmentVariable("MINISYNC_MINIO_ACCESS_KEY")
-		MINISYNC_MINIO_SECRET_KEY, _ := fetchEnvironmentVariable("MINISYNC_MINIO_SECRET_KEY")
-
-		if MINISYNC_BACKUPFOLDER == "" || MINISYNC_LOGFOLDER == "" || MINISYNC_MINIO_ENDPOINT == "" || MINISYNC_MINIO_BUCKETNAME == "" || MINISYNC_MINIO_BACKUPFREQUENCYSECONDS == "" || MINISYNC_MINIO_ACCESS_KEY == "" || MINISYNC_MINIO_SECRET_KEY == "" {
-			log.Fatal("One or more environment variables are not set")
-		}
-
-		env := append(os.Environ(),
-			"MINISYNC_BACKFOLDER="+MINISYNC_BACKUPFOLDER,
-			"MINISYNC_LOGFOLDER="+MINISYNC_LOGFOLDER,
-			"MINISYNC_MINIO_ENDPOINT="+MINISYNC_MINIO_ENDPOINT,
-			"MINISYNC_MINIO_BUCKETNAME="+MINISYNC_MINIO_BUCKETNAME,
-			"MINISYNC_MINIO_BACKUPFREQUENCYSECONDS="+MINISYNC_MINIO_BACKUPFREQUENCYSECONDS,
-			"MINISYNC_MINIO_ACCESS_KEY="+MINISYNC_MINIO_ACCESS_KEY,
-			"MINISYNC_MINIO_SECRET_KEY="+MINISYNC_MINIO_SECRET_KEY,
-		)
-		cmd = exec.Command(fileName, command)
-		cmd.Env = env
-	} else {
-		cmd = exec.Command(fileName, command)
-	}
+	cmd := exec.Command(fileName, command)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -148,187 +212,314 @@ func runCommand(fileName string, command string) string {
 	return string(output)
 }
 
-// SubmitForm handles the form submission from the frontend, updating environment variables and managing the Minisync service.
-func (a *App) SubmitForm(config Config) (string, error) {
+// GetConfig returns the saved configuration for pre-filling the form. If MiniSync has not been
+// configured yet, the defaults are returned.
+func (a *App) GetConfig() (Config, error) {
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, config.ErrNotConfigured) {
+		return Config{}, err
+	}
+	return fromConfig(cfg), nil
+}
 
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.QUERY_VALUE)
+// SubmitForm handles the form submission from the frontend, saving the configuration file and managing the
+// Minisync service. A running service watches the configuration file and applies the change itself; the
+// service is only installed when it is not installed yet, and started when it is stopped.
+func (a *App) SubmitForm(form Config) (string, error) {
+	cfg, err := toConfig(form)
 	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
+		return "", err
 	}
-	defer key.Close()
 
-	exists, err := keyExists(`SYSTEM\CurrentControlSet\Control\Session Manager\Environment`)
+	err = config.Save(config.DefaultPath(), cfg)
 	if err != nil {
-		log.Fatalf("Error checking if key exists: %v", err)
-	}
-	if !exists {
-		log.Println("Key does not exist, creating it.")
-	} else {
-		log.Println("Key exists.")
+		return "", err
 	}
 
-	envVars := map[string]string{
-		"MINISYNC_BACKFOLDER":                   config.BackupFolder,
-		"MINISYNC_LOGFOLDER":                    config.LogFolder,
-		"MINISYNC_MINIO_ENDPOINT":               config.MinioEndpoint,
-		"MINISYNC_MINIO_BUCKETNAME":             config.MinioBucketName,
-		"MINISYNC_MINIO_BACKUPFREQUENCYSECONDS": config.BackupFrequencySeconds,
-		"MINISYNC_MINIO_ACCESS_KEY":             config.MinioKey,
-		"MINISYNC_MINIO_SECRET_KEY":             config.MinioSecret,
+	log.Printf("Configuration saved to %s.", config.DefaultPath())
+
+	serviceStatus, err := a.GetServiceStatus()
+	if err != nil {
+		return "", err
 	}
 
-	for key, value := range envVars {
-		err := setEnvironmentVariable(key, value)
+	switch minisync.ServiceStatus(serviceStatus) {
+	case minisync.StatusRunning:
+		log.Println("Service is running and will apply the new configuration.")
+	case minisync.StatusNotInstalled:
+		exePath, err := saveMinisyncService("MiniSyncService.exe")
 		if err != nil {
-			log.Printf("Error setting key %s: %v", key, err)
+			return "", fmt.Errorf("failed to save service binary: %w", err)
 		}
+		runCommand(exePath, "install")
+		runCommand(exePath, "start")
+	case minisync.StatusPaused:
+		a.ServiceControl("continue")
+	default:
+		a.ServiceControl("start")
 	}
 
-	// TO DO: NEED TO FIX / REMOVE
-	if 1 == 2 {
-		const HWND_BROADCAST = 0xFFFF
-		const WM_SETTINGCHANGE = 0x001A
-		const SMTO_ABORTIFHUNG = 0x0002
+	return a.GetServiceStatus()
+}
 
-		user32 := syscall.NewLazyDLL("user32.dll")
-		sendMessageTimeout := user32.NewProc("SendMessageTimeoutW")
+// UninstallMinisyncService removes the Minisync configuration file.
+func UninstallMinisyncService() {
+	err := config.Remove(config.DefaultPath())
+	if err != nil {
+		log.Printf("Failed to remove configuration: %v", err)
+	}
+}
 
-		envPtr, err := syscall.UTF16PtrFromString("Environment")
-		if err != nil {
-			log.Fatalf("Failed to convert string to UTF16 pointer: %v", err)
-		}
+// loadConfig loads the configuration file shared with the service.
+func loadConfig() (*config.Config, error) {
+	return config.Load(config.DefaultPath())
+}
 
-		result, _, err := sendMessageTimeout.Call(
-			uintptr(HWND_BROADCAST),
-			uintptr(WM_SETTINGCHANGE),
-			uintptr(0),
-			uintptr(unsafe.Pointer(envPtr)),
-			uintptr(SMTO_ABORTIFHUNG),
-			uintptr(5000),
-		)
-
-		if result == 0 {
-			log.Fatalf("Failed to broadcast environment change: %v", err)
-		}
+// loadProfile loads the configuration and returns it together with the profile with the given name, or
+// the first profile if name is empty.
+func loadProfile(name string) (*config.Config, *config.Profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	profile := cfg.Profile(name)
+	if profile == nil {
+		return nil, nil, fmt.Errorf("there is no profile named %q", name)
 	}
+	return cfg, profile, nil
+}
 
-	log.Println("System environment variables updated successfully.")
+// profileField matches the configuration paths of profile settings, such as "profiles[1].primary.bucketName".
+var profileField = regexp.MustCompile(`^(profiles\[\d+\]\.)(.+)$`)
+
+// formFields maps configuration paths of profile settings reported by config.Validate to the ids of the
+// setup form's inputs. Paths of additional destinations, such as "destinations[0].bucketName", are
+// resolved by the frontend.
+var formFields = map[string]string{
+	"name":               "profileName",
+	"filter":             "include",
+	"endpointStrategy":   "minioEndpointStrategy",
+	"primary.endpoints":  "minioEndpoint",
+	"primary.bucketName": "minioBucketName",
+	"primary.accessKey":  "minioKey",
+	"primary.secretKey":  "minioSecret",
+}
 
-	exePath, err := saveMinisyncService("MiniSyncService.exe")
+// ValidateForm checks the form without saving it and returns the problems found, keyed by form field.
+// It returns nil when the form can be submitted.
+func (a *App) ValidateForm(form Config) []config.FieldError {
+	_, err := toConfig(form)
+	var errs config.ValidationErrors
+	if errors.As(err, &errs) {
+		return errs
+	}
 	if err != nil {
-		log.Fatalf("Failed to save child binary: %v", err)
+		return []config.FieldError{{Message: err.Error()}}
 	}
+	return nil
+}
 
-	runCommand(exePath, "stop")
-	runCommand(exePath, "uninstall")
-	runCommand(exePath, "install")
-	runCommand(exePath, "start")
+// toConfig converts the submitted form to a validated configuration. Values that cannot be parsed and
+// settings rejected by config.Validate are returned together as a config.ValidationErrors keyed by form
+// field, with the settings of profile i prefixed by "profiles[i].".
+func toConfig(form Config) (*config.Config, error) {
+	var errs config.ValidationErrors
 
-	serviceStatus, err := a.GetServiceStatus()
+	// Start from the saved configuration, so that settings the form does not show are kept. It is only
+	// read, since validating the form must not change the file.
+	saved, err := config.Read(config.DefaultPath())
 	if err != nil {
-		log.Fatalf("Error unmarshalling .env file: %v", err)
+		saved = config.Default()
+	}
+	cfg := *saved
+	cfg.LogFolder = strings.TrimSpace(form.LogFolder)
+	cfg.Profiles = nil
+	for _, pf := range form.Profiles {
+		p := config.DefaultProfile(pf.OriginalName)
+		if previous := saved.Profile(pf.OriginalName); pf.OriginalName != "" && previous != nil {
+			p = previous
+		}
+		cfg.Profiles = append(cfg.Profiles, *p)
 	}
 
-	return serviceStatus, nil
-}
-
-// UninstallMinisyncService uninstalls the Minisync service and removes related environment variables.
-func UninstallMinisyncService() {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.SET_VALUE)
+	// Secret keys are never sent to the frontend, so a blank secret keeps the stored one. The profiles
+	// still carry the names their secrets were stored under.
+	for i, pf := range form.Profiles {
+		cfg.Profiles[i].Primary.SecretKey = pf.MinioSecret
+		cfg.Profiles[i].Destinations = pf.Destinations
+	}
+	err = config.ResolveSecrets(config.DefaultPath(), &cfg)
 	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
-	}
-	defer key.Close()
-
-	log.Println("Unsetting environment variables:")
-	unsetEnvironmentVariable("MINISYNC_BACKUPFOLDER")
-	unsetEnvironmentVariable("MINISYNC_LOGFOLDER")
-	unsetEnvironmentVariable("MINISYNC_MINIO_ENDPOINT")
-	unsetEnvironmentVariable("MINISYNC_MINIO_BUCKETNAME")
-	unsetEnvironmentVariable("MINISYNC_MINIO_BACKUPFREQUENCYSECONDS")
-	unsetEnvironmentVariable("MINISYNC_MINIO_ACCESS_KEY")
-	unsetEnvironmentVariable("MINISYNC_MINIO_SECRET_KEY")
+		return nil, err
+	}
+
+	for i, pf := range form.Profiles {
+		profileErrs := toProfile(pf, &cfg.Profiles[i])
+		for _, e := range profileErrs {
+			e.Field = fmt.Sprintf("profiles[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+
+	var invalid config.ValidationErrors
+	if errors.As(cfg.Validate(), &invalid) {
+		for _, e := range invalid {
+			if match := profileField.FindStringSubmatch(e.Field); match != nil {
+				if field, ok := formFields[match[2]]; ok {
+					e.Field = match[1] + field
+				}
+			}
+			errs = append(errs, e)
+		}
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
 }
 
-// saveMinisyncService writes the embedded Minisync service executable to a file.
-// It returns the full path to the saved executable or an error if the operation fails.
-func saveMinisyncService(fileName string) (string, error) {
-	exePath, err := os.Executable()
+// toProfile copies the form data of a profile into p, whose secret keys have already been resolved, and
+// returns the values that cannot be parsed, keyed by form field.
+func toProfile(form ProfileForm, p *config.Profile) config.ValidationErrors {
+	var errs config.ValidationErrors
+
+	p.Name = strings.TrimSpace(form.Name)
+	p.BackupFolder = strings.TrimSpace(form.BackupFolder)
+	p.Primary.Endpoints = minisync.ParseEndpoints(form.MinioEndpoint)
+	p.Primary.BucketName = strings.TrimSpace(form.MinioBucketName)
+	p.Primary.AccessKey = form.MinioKey
+	p.Filter = minisync.Filter{Include: minisync.ParsePatterns(form.Include), Exclude: minisync.ParsePatterns(form.Exclude)}
+
+	seconds, err := strconv.Atoi(strings.TrimSpace(form.BackupFrequencySeconds))
 	if err != nil {
-		return "", fmt.Errorf("failed to get executable path: %w", err)
+		errs.Add("backupFrequencySeconds", "must be a whole number of seconds")
+	} else {
+		p.BackupFrequencySeconds = seconds
 	}
-	dir := filepath.Dir(exePath)
+	p.Schedule = strings.TrimSpace(form.Schedule)
+	p.SyncOnStart = form.SyncOnStart == "true"
 
-	exePath = filepath.Join(dir, fileName)
-
-	binaryData, err := minisyncService.ReadFile("bin/MiniSyncService.exe")
+	mode, err := minisync.ParseSyncMode(form.Mode)
 	if err != nil {
-		return "", fmt.Errorf("failed to read embedded binary file: %w", err)
+		errs.Add("mode", "%v", err)
+	} else {
+		p.Mode = mode
 	}
 
-	err = os.WriteFile(exePath, binaryData, 0755)
+	strategy, err := minisync.ParseEndpointStrategy(form.MinioEndpointStrategy)
 	if err != nil {
-		return "", fmt.Errorf("failed to write the binary file: %w", err)
+		errs.Add("minioEndpointStrategy", "%v", err)
+	} else {
+		p.EndpointStrategy = strategy
 	}
 
-	return exePath, nil
+	if _, err := minisync.ParseRetentionRules(form.ObjectLockRules); err != nil {
+		errs.Add("objectLockRules", "%v", err)
+	} else if p.ObjectLock, err = minisync.NewObjectLock(form.ObjectLockMode, form.ObjectLockDays, form.ObjectLockLegalHold, form.ObjectLockRules); err != nil {
+		errs.Add("objectLockDays", "%v", err)
+	}
+	return errs
 }
 
-// setEnvironmentVariable sets the specified environment variable in the Windows registry.
-func setEnvironmentVariable(name, value string) error {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.SET_VALUE)
-	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
+// fromConfig converts a configuration to the form shown in the frontend. Secret keys are left out.
+func fromConfig(cfg *config.Config) Config {
+	form := Config{LogFolder: cfg.LogFolder}
+	for _, p := range cfg.Profiles {
+		form.Profiles = append(form.Profiles, fromProfile(p))
 	}
-	defer key.Close()
+	return form
+}
 
-	err = key.SetStringValue(name, value)
-	if err != nil {
-		return fmt.Errorf("failed to set environment variable %s: %w", name, err)
+// fromProfile converts a profile to its form data. Secret keys are left out.
+func fromProfile(p config.Profile) ProfileForm {
+	form := ProfileForm{
+		OriginalName:           p.Name,
+		Name:                   p.Name,
+		BackupFolder:           p.BackupFolder,
+		Mode:                   string(p.Mode),
+		Include:                strings.Join(p.Filter.Include, ", "),
+		Exclude:                strings.Join(p.Filter.Exclude, ", "),
+		MinioEndpoint:          strings.Join(p.Primary.Endpoints, ","),
+		MinioEndpointStrategy:  string(p.EndpointStrategy),
+		MinioKey:               p.Primary.AccessKey,
+		MinioBucketName:        p.Primary.BucketName,
+		BackupFrequencySeconds: strconv.Itoa(p.BackupFrequencySeconds),
+		Schedule:               p.Schedule,
+		SyncOnStart:            strconv.FormatBool(p.SyncOnStart),
 	}
-	return nil
+	for _, d := range p.Destinations {
+		d.SecretKey = ""
+		form.Destinations = append(form.Destinations, d)
+	}
+
+	if p.ObjectLock != nil {
+		form.ObjectLockMode = string(p.ObjectLock.Default.Mode)
+		if p.ObjectLock.Default.Days > 0 {
+			form.ObjectLockDays = strconv.Itoa(p.ObjectLock.Default.Days)
+		}
+		form.ObjectLockLegalHold = strconv.FormatBool(p.ObjectLock.Default.LegalHold)
+		form.ObjectLockRules = minisync.FormatRetentionRules(p.ObjectLock.Rules)
+	}
+	return form
 }
 
-// fetchEnvironmentVariable retrieves the specified environment variable from the Windows registry.
-func fetchEnvironmentVariable(name string) (string, error) {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.QUERY_VALUE)
-	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
+// minioClients caches the read-only client of every profile by profile name, together with the settings it
+// was created with, so that browsing does not create a new client for every request.
+var minioClients struct {
+	mu      sync.Mutex
+	clients map[string]cachedMinioClient
+}
+
+// cachedMinioClient is a read-only client and the settings it was created with.
+type cachedMinioClient struct {
+	settings string
+	client   *minisync.MinioClient
+}
+
+// newMinioClient returns a read-only client for the primary destination of the given profile. The client is
+// cached per profile and created again once the profile's destination settings change.
+func newMinioClient(p *config.Profile) (*minisync.MinioClient, error) {
+	d := p.Primary
+	settings := fmt.Sprintf("%q %q %q %q %q", strings.Join(d.Endpoints, ","), d.BucketName, d.AccessKey, d.SecretKey, p.EndpointStrategy)
+
+	minioClients.mu.Lock()
+	defer minioClients.mu.Unlock()
+	if cached, ok := minioClients.clients[p.Name]; ok && cached.settings == settings {
+		return cached.client, nil
 	}
-	defer key.Close()
 
-	value, _, err := key.GetStringValue(name)
+	client, err := p.NewReadOnlyMinioClient(d)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch environment variable %s: %w", name, err)
+		return nil, err
 	}
-	return value, nil
+	if minioClients.clients == nil {
+		minioClients.clients = make(map[string]cachedMinioClient)
+	}
+	minioClients.clients[p.Name] = cachedMinioClient{settings: settings, client: client}
+	return client, nil
 }
 
-// unsetEnvironmentVariable removes the specified environment variable from the Windows registry.
-func unsetEnvironmentVariable(name string) {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.SET_VALUE)
+// saveMinisyncService writes the embedded Minisync service executable to a file.
+// It returns the full path to the saved executable or an error if the operation fails.
+func saveMinisyncService(fileName string) (string, error) {
+	exePath, err := os.Executable()
 	if err != nil {
-		log.Fatalf("Failed to open registry key: %v", err)
+		return "", fmt.Errorf("failed to get executable path: %w", err)
 	}
-	defer key.Close()
+	dir := filepath.Dir(exePath)
+
+	exePath = filepath.Join(dir, fileName)
 
-	err = key.DeleteValue(name)
+	binaryData, err := minisyncService.ReadFile("bin/MiniSyncService.exe")
 	if err != nil {
-		log.Printf("Failed to unset environment variable %s: %v", name, err)
-	} else {
-		log.Printf("Unset environment variable %s successfully", name)
+		return "", fmt.Errorf("failed to read embedded binary file: %w", err)
 	}
-}
 
-// keyExists checks if the specified registry key exists.
-func keyExists(path string) (bool, error) {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	err = os.WriteFile(exePath, binaryData, 0755)
 	if err != nil {
-		if err == registry.ErrNotExist {
-			return false, nil
-		}
-		return false, fmt.Errorf("failed to open registry key: %w", err)
+		return "", fmt.Errorf("failed to write the binary file: %w", err)
 	}
-	key.Close()
-	return true, nil
+
+	return exePath, nil
 }
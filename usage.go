@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/mwiater/minisync/minisyncService/minisync"
+)
+
+// GetUsageReport lists the backup bucket of a profile and returns the storage used per top-level folder,
+// file extension and age, together with the earlier reports kept in the profile's usage history.
+func (a *App) GetUsageReport(profileName string) (*minisync.UsageReport, error) {
+	cfg, profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := newMinioClient(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := minioClient.UsageReport()
+	if err != nil {
+		return nil, err
+	}
+
+	stateFolder, err := cfg.StateFolder(profile.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = minisync.RecordUsage(stateFolder, report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}